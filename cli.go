@@ -0,0 +1,617 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kylycht/exchange/internal/logging"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+	"github.com/kylycht/exchange/storage/persistence"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	formatTable   = "table"          // aligned columns for humans
+	formatJSON    = "json"           // indented JSON for scripts
+	lookupTimeout = time.Second * 30 // timeout of one-shot upstream lookups
+)
+
+// secrets are masked by check-config
+var secrets = map[string]bool{"AdminToken": true, "DBPassword": true, "ExchangeAPIKey": true, "RedisPassword": true}
+
+// commands holds dependencies of the command line interface,
+// constructors are replaced by fakes in tests
+type commands struct {
+	stdout      io.Writer                                               // destination of the command output
+	openStorage func(cfg Config) (storage.Storage, func() error, error) // opens currency storage and returns its closer
+	newExchange func(cfg Config) (service.Exchange, error)              // creates rates provider
+	httpClient  *http.Client                                            // client of the running server
+}
+
+// newCLI creates command line interface writing results to stdout
+func newCLI(stdout io.Writer) *cli.App {
+	c := &commands{
+		stdout:      stdout,
+		openStorage: openStorage,
+		newExchange: newExchangeClient,
+		httpClient:  &http.Client{Timeout: lookupTimeout},
+	}
+
+	return c.app()
+}
+
+func (c *commands) app() *cli.App {
+	return &cli.App{
+		Name:           "exchange",
+		Usage:          "crypto-to-fiat and fiat-to-crypto converter",
+		DefaultCommand: "serve",
+		Writer:         c.stdout,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config", Aliases: []string{"c"}, Value: "config.yaml", Usage: "configuration file", EnvVars: []string{"EXCHANGE_CONFIG"}},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: formatTable, Usage: "output format, table or json"},
+		},
+		Before: func(ctx *cli.Context) error {
+			switch ctx.String("output") {
+			case formatTable, formatJSON:
+				return nil
+			}
+
+			return fmt.Errorf("output must be either %s or %s", formatTable, formatJSON)
+		},
+		Commands: []*cli.Command{
+			{
+				Name:   "serve",
+				Usage:  "run http server",
+				Action: c.serve,
+			},
+			{
+				Name:      "convert",
+				Usage:     "convert amount at the current rate",
+				ArgsUsage: "FROM TO AMOUNT",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "server", Usage: "url of the running server, provider is queried directly when empty"},
+				},
+				Action: c.convert,
+			},
+			{
+				Name:  "currencies",
+				Usage: "manage currencies",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "list known currencies",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "available", Usage: "only currencies served at the moment"},
+						},
+						Action: c.listCurrencies,
+					},
+					{
+						Name:      "add",
+						Usage:     "add new currency",
+						ArgsUsage: "SYMBOL",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "name", Required: true, Usage: "name of the currency, e.g. BITCOIN"},
+							&cli.StringFlag{Name: "type", Required: true, Usage: "FIAT, CRYPTO, METAL, STABLECOIN or COMMODITY"},
+							&cli.IntFlag{Name: "decimals", Value: -1, Usage: "minor unit decimals, default of the type when negative"},
+							&cli.StringFlag{Name: "display-symbol", Usage: "symbol used for display, e.g. ₿"},
+							&cli.StringSliceFlag{Name: "alias", Usage: "alternative symbol, e.g. XBT"},
+							&cli.StringSliceFlag{Name: "chain", Usage: "network token is issued on, e.g. ERC20"},
+							&cli.BoolFlag{Name: "disabled", Usage: "add currency unavailable for conversions"},
+						},
+						Action: c.addCurrency,
+					},
+					{
+						Name:      "disable",
+						Usage:     "make currency unavailable for conversions",
+						ArgsUsage: "SYMBOL",
+						Action:    c.disableCurrency,
+					},
+				},
+			},
+			{
+				Name:  "rates",
+				Usage: "inspect upstream rates",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "dump",
+						Usage:  "fetch rates of every available currency from the provider",
+						Action: c.dumpRates,
+					},
+				},
+			},
+			{
+				Name:   "migrate",
+				Usage:  "create or upgrade database schema",
+				Action: c.migrate,
+			},
+			{
+				Name:   "check-config",
+				Usage:  "validate configuration and print effective settings",
+				Action: c.checkConfig,
+			},
+		},
+	}
+}
+
+// config reads and validates configuration
+// file given by the global flag
+func (c *commands) config(ctx *cli.Context) (Config, error) {
+	cfg, err := ReadConfig(ctx.String("config"))
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, logging.Configure(cfg.LogLevel, cfg.LogFormat, os.Stderr)
+}
+
+func (c *commands) serve(ctx *cli.Context) error {
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	return New(cfg)
+}
+
+func (c *commands) convert(ctx *cli.Context) error {
+	if ctx.NArg() != 3 {
+		return fmt.Errorf("expected FROM TO AMOUNT, got %d arguments", ctx.NArg())
+	}
+
+	from := strings.ToUpper(ctx.Args().Get(0))
+	to := strings.ToUpper(ctx.Args().Get(1))
+
+	amount, err := strconv.ParseFloat(ctx.Args().Get(2), 64)
+	if err != nil || amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("invalid amount: %q", ctx.Args().Get(2))
+	}
+
+	var conversion model.Conversion
+	if server := ctx.String("server"); server != "" {
+		conversion, err = c.convertRemote(ctx.Context, server, from, to, amount)
+	} else {
+		conversion, err = c.convertDirect(ctx, from, to, amount)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.write(ctx, conversion,
+		[]string{"FROM", "TO", "AMOUNT", "MID RATE", "RATE", "GROSS", "FEE", "NET", "RATE TIME"},
+		[][]string{{
+			conversion.From,
+			conversion.To,
+			formatFloat(conversion.Amount),
+			formatFloat(conversion.MidRate),
+			formatFloat(conversion.Rate),
+			formatFloat(conversion.Gross),
+			formatFloat(conversion.Fee),
+			formatFloat(conversion.Net),
+			conversion.RateTime.Format(time.RFC3339),
+		}},
+	)
+}
+
+// convertRemote prices conversion by the running server
+func (c *commands) convertRemote(ctx context.Context, server, from, to string, amount float64) (model.Conversion, error) {
+	conversion := model.Conversion{}
+
+	u, err := url.Parse(strings.TrimSuffix(server, "/") + "/convert")
+	if err != nil {
+		return conversion, err
+	}
+
+	u.RawQuery = url.Values{
+		"from":   {from},
+		"to":     {to},
+		"amount": {strconv.FormatFloat(amount, 'f', -1, 64)},
+	}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return conversion, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return conversion, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return conversion, fmt.Errorf("server responded with %d: %s", resp.StatusCode, body)
+	}
+
+	return conversion, json.NewDecoder(resp.Body).Decode(&conversion)
+}
+
+// oneOff returns configuration of the provider for one-off lookups,
+// recording is left to the server so that the fixtures keep its timeline
+func oneOff(cfg Config) Config {
+	if cfg.ExchangeProvider == "record" {
+		cfg.ExchangeProvider = "fastforex"
+	}
+
+	return cfg
+}
+
+// convertDirect converts at the mid rate obtained from the provider,
+// pricing rules are applied only by the server. Rate is looked up
+// at the fiat endpoint falling back to the crypto one
+func (c *commands) convertDirect(ctx *cli.Context, from, to string, amount float64) (model.Conversion, error) {
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return model.Conversion{}, err
+	}
+
+	exchangeClient, err := c.newExchange(oneOff(cfg))
+	if err != nil {
+		return model.Conversion{}, err
+	}
+
+	lookupCtx, cancelFn := context.WithTimeout(ctx.Context, lookupTimeout)
+	defer cancelFn()
+
+	rate := 0.0
+
+	rateInfo, err := exchangeClient.GetRate(lookupCtx, from, to)
+	if err == nil {
+		rate = rateInfo.Rate
+	}
+
+	if rate == 0 {
+		rates, cryptoErr := exchangeClient.GetCryptoRates(lookupCtx, []string{from + "/" + to})
+		if cryptoErr != nil {
+			return model.Conversion{}, fmt.Errorf("no rate obtained for pair %s/%s: %v, %v", from, to, err, cryptoErr)
+		}
+
+		for _, r := range rates {
+			rate = r.Rate
+		}
+	}
+
+	if rate == 0 {
+		return model.Conversion{}, fmt.Errorf("no rate obtained for pair %s/%s", from, to)
+	}
+
+	return model.Conversion{
+		From:     from,
+		To:       to,
+		Amount:   amount,
+		MidRate:  rate,
+		Rate:     rate,
+		Gross:    amount * rate,
+		Net:      amount * rate,
+		RateTime: time.Now().UTC(),
+	}, nil
+}
+
+// currencyView is currency as printed by the commands
+type currencyView struct {
+	Symbol        string   `json:"symbol"`
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	Decimals      int      `json:"decimals"`
+	DisplaySymbol string   `json:"display_symbol,omitempty"`
+	Available     bool     `json:"available"`
+	Aliases       []string `json:"aliases"`
+	Chains        []string `json:"chains"`
+}
+
+func (c *commands) listCurrencies(ctx *cli.Context) error {
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	db, closeFn, err := c.openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	var currencies []model.Currency
+	if ctx.Bool("available") {
+		currencies, err = db.Load(ctx.Context)
+	} else {
+		currencies, err = db.List(ctx.Context)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	views := make([]currencyView, 0, len(currencies))
+	rows := make([][]string, 0, len(currencies))
+
+	for _, currency := range currencies {
+		v := currencyView{
+			Symbol:        currency.Symbol,
+			Name:          currency.Name,
+			Type:          string(currency.CurrencyType),
+			Decimals:      currency.Decimals,
+			DisplaySymbol: currency.DisplaySymbol,
+			Available:     currency.IsAvailable,
+			Aliases:       append([]string{}, currency.Aliases...),
+			Chains:        append([]string{}, currency.Chains...),
+		}
+
+		views = append(views, v)
+		rows = append(rows, []string{
+			v.Symbol,
+			v.Name,
+			v.Type,
+			strconv.Itoa(v.Decimals),
+			v.DisplaySymbol,
+			strconv.FormatBool(v.Available),
+			strings.Join(v.Aliases, ","),
+			strings.Join(v.Chains, ","),
+		})
+	}
+
+	if err := c.write(ctx, views, []string{"SYMBOL", "NAME", "TYPE", "DECIMALS", "DISPLAY", "AVAILABLE", "ALIASES", "CHAINS"}, rows); err != nil {
+		return err
+	}
+
+	// rows of types this version does not support are not served
+	if r, ok := db.(storage.Rejecter); ok {
+		if rejected := r.Rejected(); len(rejected) > 0 {
+			fmt.Fprintf(ctx.App.ErrWriter, "skipped currencies of unknown type: %s\n", strings.Join(rejected, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (c *commands) addCurrency(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected SYMBOL, got %d arguments", ctx.NArg())
+	}
+
+	currencyType, err := model.ParseCurrencyType(ctx.String("type"))
+	if err != nil {
+		return err
+	}
+
+	currency := model.Currency{
+		Name:          ctx.String("name"),
+		Symbol:        strings.ToUpper(ctx.Args().First()),
+		CurrencyType:  currencyType,
+		IsAvailable:   !ctx.Bool("disabled"),
+		Decimals:      ctx.Int("decimals"),
+		DisplaySymbol: ctx.String("display-symbol"),
+		Aliases:       upper(ctx.StringSlice("alias")),
+		Chains:        upper(ctx.StringSlice("chain")),
+	}
+
+	if currency.Decimals < 0 {
+		currency.Decimals = model.DefaultDecimals(currencyType)
+	}
+
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	db, closeFn, err := c.openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := db.AddCurrency(ctx.Context, currency); err != nil {
+		return fmt.Errorf("currency %s: %w", currency.Symbol, err)
+	}
+
+	return c.status(ctx, currency.Symbol, "added")
+}
+
+func (c *commands) disableCurrency(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected SYMBOL, got %d arguments", ctx.NArg())
+	}
+
+	symbol := strings.ToUpper(ctx.Args().First())
+
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	db, closeFn, err := c.openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := db.DisableCurrency(ctx.Context, symbol); err != nil {
+		return fmt.Errorf("currency %s: %w", symbol, err)
+	}
+
+	return c.status(ctx, symbol, "disabled")
+}
+
+// rateView is rate as printed by the commands
+type rateView struct {
+	Base   string  `json:"base"`
+	Target string  `json:"target"`
+	Rate   float64 `json:"rate"`
+}
+
+func (c *commands) dumpRates(ctx *cli.Context) error {
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	db, closeFn, err := c.openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	currencies, err := db.Load(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	exchangeClient, err := c.newExchange(oneOff(cfg))
+	if err != nil {
+		return err
+	}
+
+	lookupCtx, cancelFn := context.WithTimeout(ctx.Context, lookupTimeout)
+	defer cancelFn()
+
+	lookup := exchangeClient.GetAllRates(lookupCtx, currencies)
+	if lookup.LookupErr != nil {
+		return lookup.LookupErr
+	}
+
+	for pair, err := range lookup.PairErrors {
+		fmt.Fprintf(ctx.App.ErrWriter, "%s: %v\n", pair, err)
+	}
+
+	views := []rateView{}
+	for base, targets := range lookup.Rates {
+		for target, rate := range targets {
+			views = append(views, rateView{Base: base, Target: target, Rate: rate})
+		}
+	}
+
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Base != views[j].Base {
+			return views[i].Base < views[j].Base
+		}
+		return views[i].Target < views[j].Target
+	})
+
+	rows := make([][]string, 0, len(views))
+	for _, v := range views {
+		rows = append(rows, []string{v.Base, v.Target, formatFloat(v.Rate)})
+	}
+
+	return c.write(ctx, views, []string{"BASE", "TARGET", "RATE"}, rows)
+}
+
+func (c *commands) migrate(ctx *cli.Context) error {
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	dbConn, err := openDB(ctx.Context, cfg)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	if err := persistence.Migrate(ctx.Context, dbConn); err != nil {
+		return err
+	}
+
+	return c.status(ctx, cfg.DBName, "migrated")
+}
+
+// checkConfig prints effective settings of the valid
+// configuration, secrets are masked
+func (c *commands) checkConfig(ctx *cli.Context) error {
+	cfg, err := c.config(ctx)
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]interface{})
+	rows := [][]string{}
+
+	v := reflect.ValueOf(cfg)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := strings.ToLower(field.Name)
+
+		value := v.Field(i).Interface()
+		if secrets[field.Name] && !v.Field(i).IsZero() {
+			value = "***"
+		}
+
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+
+		settings[key] = value
+		rows = append(rows, []string{key, fmt.Sprint(value)})
+	}
+
+	return c.write(ctx, settings, []string{"SETTING", "VALUE"}, rows)
+}
+
+// status reports outcome of the command changing the state
+func (c *commands) status(ctx *cli.Context, subject, status string) error {
+	return c.write(ctx,
+		map[string]string{"subject": subject, "status": status},
+		[]string{"SUBJECT", "STATUS"},
+		[][]string{{subject, status}},
+	)
+}
+
+// write prints v as JSON or header and rows
+// as table depending on the output flag
+func (c *commands) write(ctx *cli.Context, v interface{}, header []string, rows [][]string) error {
+	if ctx.String("output") == formatJSON {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// openStorage opens currency storage of the configured database
+func openStorage(cfg Config) (storage.Storage, func() error, error) {
+	dbConn, err := openDB(context.Background(), cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return persistence.New(dbConn), dbConn.Close, nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func upper(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		result = append(result, strings.ToUpper(v))
+	}
+
+	return result
+}
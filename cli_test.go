@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+)
+
+const testConfig = `httpport: ":3000"
+dbhost: localhost
+dbname: rates
+dbpassword: secret
+exchangeapikey: key
+`
+
+// run executes command line against fake storage and exchange
+func run(t *testing.T, db *fake.Storage, exchange *fake.Exchange, args ...string) (string, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	c := &commands{
+		stdout: stdout,
+		openStorage: func(Config) (storage.Storage, func() error, error) {
+			return db, func() error { return nil }, nil
+		},
+		newExchange: func(Config) (service.Exchange, error) {
+			return exchange, nil
+		},
+		httpClient: http.DefaultClient,
+	}
+
+	err := c.app().Run(append([]string{"exchange", "--config", path}, args...))
+
+	return stdout.String(), err
+}
+
+func TestCurrencies(t *testing.T) {
+	db := fake.NewStorage(model.Currency{Name: "US DOLLAR", Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true, Decimals: 2})
+
+	if _, err := run(t, db, nil, "currencies", "add", "--name", "BITCOIN", "--type", "crypto", "--alias", "xbt", "btc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, db, nil, "currencies", "add", "--name", "BITCOIN", "--type", "crypto", "BTC"); !errors.Is(err, storage.ErrAlreadyExists) {
+		t.Fatalf("expected %v, got %v", storage.ErrAlreadyExists, err)
+	}
+
+	if _, err := run(t, db, nil, "currencies", "add", "--name", "GOLD", "--type", "gem", "XAU"); err == nil {
+		t.Fatal("expected unknown currency type to be rejected")
+	}
+
+	if _, err := run(t, db, nil, "currencies", "disable", "usd"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(t, db, nil, "currencies", "disable", "EUR"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected %v, got %v", storage.ErrNotFound, err)
+	}
+
+	out, err := run(t, db, nil, "-o", "json", "currencies", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var currencies []currencyView
+	if err := json.Unmarshal([]byte(out), &currencies); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(currencies) != 2 || currencies[0].Available || currencies[1].Symbol != "BTC" || currencies[1].Decimals != 8 ||
+		!currencies[1].Available || len(currencies[1].Aliases) != 1 || currencies[1].Aliases[0] != "XBT" {
+		t.Errorf("unexpected currencies: %+v", currencies)
+	}
+
+	out, err = run(t, db, nil, "currencies", "list", "--available")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "SYMBOL") || !strings.HasPrefix(lines[1], "BTC ") {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+}
+
+func TestConvertDirect(t *testing.T) {
+	exchange := fake.NewExchange(map[string]float64{"USD/BTC": 0.00002})
+
+	out, err := run(t, nil, exchange, "-o", "json", "convert", "usd", "btc", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversion := model.Conversion{}
+	if err := json.Unmarshal([]byte(out), &conversion); err != nil {
+		t.Fatal(err)
+	}
+
+	if conversion.From != "USD" || conversion.To != "BTC" || conversion.MidRate != 0.00002 || conversion.Net != 0.002 {
+		t.Errorf("unexpected conversion: %+v", conversion)
+	}
+
+	if _, err := run(t, nil, exchange, "convert", "BTC", "EUR", "1"); err == nil {
+		t.Error("expected unknown pair to fail")
+	}
+
+	for _, amount := range []string{"abc", "-1", "NaN", "Inf", "1e400"} {
+		if _, err := run(t, nil, exchange, "convert", "USD", "BTC", amount); err == nil {
+			t.Errorf("expected invalid amount %s to fail", amount)
+		}
+	}
+}
+
+func TestOneOffNotRecorded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.csv")
+	cfg := Config{ExchangeProvider: "record", ExchangeAPIKey: "key", FixturesPath: path}
+
+	if _, err := newExchangeClient(oneOff(cfg)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no fixtures written, got %v", err)
+	}
+}
+
+func TestConvertServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/convert" || r.URL.Query().Get("from") != "BTC" || r.URL.Query().Get("amount") != "1.5" {
+			http.Error(w, "invalid conversion for pair", http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(model.Conversion{From: "BTC", To: "USD", Amount: 1.5, MidRate: 60000, Rate: 59940, Gross: 89910, Fee: 1, Net: 89909})
+	}))
+	defer server.Close()
+
+	out, err := run(t, nil, nil, "convert", "--server", server.URL, "btc", "usd", "1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out, "89909") {
+		t.Errorf("expected net amount in the output, got:\n%s", out)
+	}
+
+	if _, err := run(t, nil, nil, "convert", "--server", server.URL, "ETH", "USD", "1"); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected server error, got %v", err)
+	}
+}
+
+func TestDumpRates(t *testing.T) {
+	db := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+
+	out, err := run(t, db, exchange, "--output", "json", "rates", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rates []rateView
+	if err := json.Unmarshal([]byte(out), &rates); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 2 || rates[0] != (rateView{Base: "BTC", Target: "USD", Rate: 60000}) || rates[1].Base != "USD" {
+		t.Errorf("unexpected rates: %+v", rates)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	out, err := run(t, nil, nil, "-o", "json", "check-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(out), &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	if settings["dbpassword"] != "***" || settings["exchangeapikey"] != "***" || settings["dbname"] != "rates" {
+		t.Errorf("unexpected settings: %v", settings)
+	}
+
+	if _, err := run(t, nil, nil, "-o", "xml", "check-config"); err == nil {
+		t.Error("expected unknown output format to be rejected")
+	}
+}
@@ -1,11 +1,288 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kylycht/exchange/internal/logging"
+	"github.com/kylycht/exchange/service/reconcile"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
 type Config struct {
-	HTTPPort       string
-	DBUsername     string
-	DBPassword     string
-	DBPort         string
-	DBHost         string
-	DBName         string
-	ExchangeAPIKey string
+	HTTPPort         string
+	DBUsername       string
+	DBPassword       string
+	DBPort           string
+	DBHost           string
+	DBName           string
+	ExchangeAPIKey   string
+	ExchangeBaseURL  string        // overrides fastforex API url
+	ExchangeProvider string        // fastforex(default), replay or record
+	FixturesPath     string        // fixtures file used by replay and record providers
+	ReplaySpeed      float64       // replay speed multiplier
+	ReplayLoop       bool          // restart replay once fixtures are exhausted
+	QuoteTTL         time.Duration // time quote stays valid, e.g. 30s
+	QuoteTolerance   float64       // max relative rate deviation on quote accept, e.g. 0.01
+	LedgerMode       string        // all(default), flagged or off
+	LedgerBufferSize int           // conversion records queued before new ones are dropped
+	HistoryInterval  time.Duration // min time between rate snapshots kept for historical valuation, e.g. 1h
+
+	AnomalyMaxDeviation       float64 // max relative change of the rate between refreshes, e.g. 0.2
+	AnomalyMaxInverseMismatch float64 // max relative mismatch of the rate and inverted opposite rate, e.g. 0.05
+	AnomalyAlertAfter         int     // consecutive anomalies of the pair before alert
+	AnomalyConfirmAfter       int     // consecutive consistent anomalies accepted as the new rate level
+	AnomalyAlertURL           string  // repeated anomalies are posted to as JSON, off by default
+	ReconcilePolicy           string  // none(default), c2f or f2c side of the pair served as obtained
+
+	SnapshotStore  string        // off(default), file or db keeps the latest rates for warm start
+	SnapshotPath   string        // file the snapshot is kept in by the file store
+	SnapshotMaxAge time.Duration // snapshots and rates older than that are not served, e.g. 24h, zero for any age
+
+	RefreshInterval     time.Duration            // refresh interval of pairs without override, 1m by default
+	RefreshIntervals    map[string]time.Duration // overrides by pair or symbol, e.g. BTC/USD: 10s, THB: 1h
+	RefreshJitter       float64                  // max relative deviation of refresh interval, 0.1 by default
+	RefreshMaxPairs     int                      // max pairs refreshed at once, recently requested first
+	RefreshRecentWindow time.Duration            // sliding window requests are counted in, 5m by default
+	RefreshColdInterval time.Duration            // refresh interval of pairs not requested within the window, off by default
+	RefreshHotThreshold int                      // requests within the window which make the pair hot, 1 by default
+	CurrencyFeed        bool                     // apply currency changes on database notification instead of the next reload
+
+	CacheBackend  string        // memory(default), redis or postgres shares rates refreshed by the elected leader
+	RedisAddr     string        // address of redis used by redis cache backend, e.g. localhost:6379
+	RedisPassword string        // password of redis
+	RedisDB       int           // database of redis
+	LeaderTTL     time.Duration // redis leadership expires unless renewed within, 15s by default
+	InstanceID    string        // id of the replica in redis election, hostname and pid by default
+
+	DBSSLMode         string        // disable(default), require, verify-ca or verify-full
+	DBSSLRootCert     string        // CA certificate the server certificate is verified by
+	DBSSLCert         string        // client certificate, along with dbsslkey
+	DBSSLKey          string        // key of the client certificate
+	DBConnectTimeout  time.Duration // timeout of establishing single connection, e.g. 5s
+	DBConnectRetries  int           // startup ping retries with exponential backoff from 1s, 5 by default
+	DBMaxOpenConns    int           // max connections of the pool, unlimited by default
+	DBMaxIdleConns    int           // max idle connections kept by the pool, 2 by default
+	DBConnMaxLifetime time.Duration // connections are reestablished once that old, e.g. 30m
+	DBConnMaxIdleTime time.Duration // idle connections are closed once idle for that long, e.g. 5m
+
+	LogLevel  string // trace, debug, info(default), warn or error
+	LogFormat string // json(default) or console
+
+	TraceEndpoint    string  // OTLP/HTTP endpoint spans are exported to, e.g. localhost:4318, off by default
+	TraceInsecure    bool    // export spans over plain HTTP
+	TraceSampleRatio float64 // ratio of new traces sampled, 1 by default
+
+	AdminToken string // bearer token of /conversions and /admin routes, they are rejected while empty
+}
+
+// ReadConfig reads configuration from the yaml file
+func ReadConfig(path string) (Config, error) {
+	cfg := Config{}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// DSN returns connection string of the database
+func (c Config) DSN() string {
+	params := url.Values{}
+
+	params.Set("sslmode", "disable")
+	if c.DBSSLMode != "" {
+		params.Set("sslmode", c.DBSSLMode)
+	}
+
+	for key, value := range map[string]string{"sslrootcert": c.DBSSLRootCert, "sslcert": c.DBSSLCert, "sslkey": c.DBSSLKey} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	if c.DBConnectTimeout > 0 {
+		params.Set("connect_timeout", strconv.Itoa(int(math.Ceil(c.DBConnectTimeout.Seconds()))))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(c.DBUsername, c.DBPassword),
+		Host:     c.DBHost + ":" + c.DBPort,
+		Path:     "/" + c.DBName,
+		RawQuery: params.Encode(),
+	}
+
+	return dsn.String()
+}
+
+// traceSampleRatio returns ratio of new traces sampled
+func (c Config) traceSampleRatio() float64 {
+	if c.TraceSampleRatio == 0 {
+		return 1
+	}
+
+	return c.TraceSampleRatio
+}
+
+// dbConnectRetries returns retries of the startup ping
+func (c Config) dbConnectRetries() int {
+	if c.DBConnectRetries == 0 {
+		return 5
+	}
+
+	return c.DBConnectRetries
+}
+
+// leaderTTL returns lease of the leadership
+func (c Config) leaderTTL() time.Duration {
+	if c.LeaderTTL == 0 {
+		return time.Second * 15
+	}
+
+	return c.LeaderTTL
+}
+
+// instanceID returns id of the replica in the election
+func (c Config) instanceID() string {
+	if c.InstanceID != "" {
+		return c.InstanceID
+	}
+
+	hostname, _ := os.Hostname()
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// Validate reports every invalid or missing setting
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.HTTPPort == "" {
+		errs = append(errs, errors.New("httpport is required"))
+	}
+
+	if c.DBHost == "" || c.DBName == "" {
+		errs = append(errs, errors.New("dbhost and dbname are required"))
+	}
+
+	switch c.ExchangeProvider {
+	case "", "fastforex":
+		if c.ExchangeAPIKey == "" {
+			errs = append(errs, errors.New("exchangeapikey is required by fastforex provider"))
+		}
+	case "replay", "record":
+		if c.FixturesPath == "" {
+			errs = append(errs, fmt.Errorf("fixturespath is required by %s provider", c.ExchangeProvider))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown exchange provider: %s", c.ExchangeProvider))
+	}
+
+	switch c.DBSSLMode {
+	case "", "disable", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("unknown db ssl mode: %s", c.DBSSLMode))
+	}
+
+	if (c.DBSSLCert == "") != (c.DBSSLKey == "") {
+		errs = append(errs, errors.New("dbsslcert and dbsslkey are required together"))
+	}
+
+	if c.DBConnectTimeout < 0 || c.DBConnectRetries < 0 || c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 || c.DBConnMaxLifetime < 0 || c.DBConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("db connect, pool sizes and connection lifetimes must not be negative"))
+	}
+
+	if c.LogLevel != "" {
+		if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+			errs = append(errs, fmt.Errorf("unknown log level: %s", c.LogLevel))
+		}
+	}
+
+	switch c.LogFormat {
+	case "", logging.FormatJSON, logging.FormatConsole:
+	default:
+		errs = append(errs, fmt.Errorf("unknown log format: %s", c.LogFormat))
+	}
+
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		errs = append(errs, errors.New("tracesampleratio must be within [0, 1]"))
+	}
+
+	switch c.LedgerMode {
+	case "", "all", "flagged", "off":
+	default:
+		errs = append(errs, fmt.Errorf("unknown ledger mode: %s", c.LedgerMode))
+	}
+
+	switch c.SnapshotStore {
+	case "", "off", "db":
+	case "file":
+		if c.SnapshotPath == "" {
+			errs = append(errs, errors.New("snapshotpath is required by file snapshot store"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown snapshot store: %s", c.SnapshotStore))
+	}
+
+	switch c.CacheBackend {
+	case "", "memory", "postgres":
+	case "redis":
+		if c.RedisAddr == "" {
+			errs = append(errs, errors.New("redisaddr is required by redis cache backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown cache backend: %s", c.CacheBackend))
+	}
+
+	// leadership is renewed every 5s
+	if c.LeaderTTL != 0 && c.LeaderTTL < time.Second*10 {
+		errs = append(errs, errors.New("leaderttl must be at least 10s"))
+	}
+
+	if _, err := reconcile.ParsePolicy(c.ReconcilePolicy); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.AnomalyAlertURL != "" {
+		if u, err := url.Parse(c.AnomalyAlertURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid anomaly alert url: %s", c.AnomalyAlertURL))
+		}
+	}
+
+	if c.QuoteTolerance < 0 || c.ReplaySpeed < 0 || c.AnomalyMaxDeviation < 0 || c.AnomalyMaxInverseMismatch < 0 {
+		errs = append(errs, errors.New("quotetolerance, replayspeed and anomaly thresholds must not be negative"))
+	}
+
+	if c.QuoteTTL < 0 || c.HistoryInterval < 0 || c.LedgerBufferSize < 0 || c.SnapshotMaxAge < 0 {
+		errs = append(errs, errors.New("quotettl, historyinterval, ledgerbuffersize and snapshotmaxage must not be negative"))
+	}
+
+	if c.RefreshInterval < 0 || c.RefreshRecentWindow < 0 || c.RefreshMaxPairs < 0 || c.RefreshColdInterval < 0 || c.RefreshHotThreshold < 0 {
+		errs = append(errs, errors.New("refresh intervals, window, max pairs and hot threshold must not be negative"))
+	}
+
+	for key, interval := range c.RefreshIntervals {
+		if interval <= 0 {
+			errs = append(errs, fmt.Errorf("refresh interval of %s must be positive", key))
+		}
+	}
+
+	if c.RefreshJitter < 0 || c.RefreshJitter >= 1 {
+		errs = append(errs, errors.New("refreshjitter must be within [0, 1)"))
+	}
+
+	return errors.Join(errs...)
 }
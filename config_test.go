@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Config{HTTPPort: ":3000", DBHost: "localhost", DBName: "rates", ExchangeAPIKey: "key"}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		err    string
+	}{
+		{name: "valid", modify: func(*Config) {}},
+		{name: "replay", modify: func(c *Config) { c.ExchangeProvider, c.ExchangeAPIKey, c.FixturesPath = "replay", "", "rates.csv" }},
+		{name: "missing port", modify: func(c *Config) { c.HTTPPort = "" }, err: "httpport is required"},
+		{name: "missing api key", modify: func(c *Config) { c.ExchangeAPIKey = "" }, err: "exchangeapikey is required"},
+		{name: "missing fixtures", modify: func(c *Config) { c.ExchangeProvider = "record" }, err: "fixturespath is required by record provider"},
+		{name: "unknown provider", modify: func(c *Config) { c.ExchangeProvider = "ecb" }, err: "unknown exchange provider: ecb"},
+		{name: "unknown ledger mode", modify: func(c *Config) { c.LedgerMode = "some" }, err: "unknown ledger mode: some"},
+		{name: "unknown policy", modify: func(c *Config) { c.ReconcilePolicy = "mid" }, err: `unknown reconciliation policy: "mid"`},
+		{name: "anomaly alert url", modify: func(c *Config) { c.AnomalyAlertURL = "https://alerts.example.com/hook" }},
+		{name: "invalid anomaly alert url", modify: func(c *Config) { c.AnomalyAlertURL = "alerts" }, err: "invalid anomaly alert url: alerts"},
+		{name: "snapshot file", modify: func(c *Config) { c.SnapshotStore, c.SnapshotPath = "file", "snapshot.json" }},
+		{name: "missing snapshot path", modify: func(c *Config) { c.SnapshotStore = "file" }, err: "snapshotpath is required"},
+		{name: "unknown snapshot store", modify: func(c *Config) { c.SnapshotStore = "s3" }, err: "unknown snapshot store: s3"},
+		{name: "refresh intervals", modify: func(c *Config) { c.RefreshIntervals = map[string]time.Duration{"BTC/USD": time.Second} }},
+		{name: "zero refresh interval", modify: func(c *Config) { c.RefreshIntervals = map[string]time.Duration{"THB": 0} }, err: "refresh interval of THB must be positive"},
+		{name: "jitter", modify: func(c *Config) { c.RefreshJitter = 1 }, err: "refreshjitter must be within [0, 1)"},
+		{name: "redis cache", modify: func(c *Config) { c.CacheBackend, c.RedisAddr = "redis", "localhost:6379" }},
+		{name: "postgres cache", modify: func(c *Config) { c.CacheBackend = "postgres" }},
+		{name: "missing redis addr", modify: func(c *Config) { c.CacheBackend = "redis" }, err: "redisaddr is required"},
+		{name: "unknown cache backend", modify: func(c *Config) { c.CacheBackend = "etcd" }, err: "unknown cache backend: etcd"},
+		{name: "short leader ttl", modify: func(c *Config) { c.LeaderTTL = time.Second }, err: "leaderttl must be at least 10s"},
+		{name: "unknown ssl mode", modify: func(c *Config) { c.DBSSLMode = "prefer" }, err: "unknown db ssl mode: prefer"},
+		{name: "client cert without key", modify: func(c *Config) { c.DBSSLCert = "client.crt" }, err: "dbsslcert and dbsslkey are required together"},
+		{name: "negative pool size", modify: func(c *Config) { c.DBMaxOpenConns = -1 }, err: "pool sizes"},
+		{name: "unknown log level", modify: func(c *Config) { c.LogLevel = "verbose" }, err: "unknown log level: verbose"},
+		{name: "unknown log format", modify: func(c *Config) { c.LogFormat = "xml" }, err: "unknown log format: xml"},
+		{name: "sample ratio above one", modify: func(c *Config) { c.TraceSampleRatio = 1.5 }, err: "tracesampleratio"},
+		{name: "negative ttl", modify: func(c *Config) { c.QuoteTTL = -1 }, err: "quotettl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDSN(t *testing.T) {
+	cfg := Config{DBUsername: "exchange", DBPassword: "p@ss/word", DBHost: "db", DBPort: "5432", DBName: "rates"}
+
+	if dsn := cfg.DSN(); dsn != "postgresql://exchange:p%40ss%2Fword@db:5432/rates?sslmode=disable" {
+		t.Errorf("unexpected dsn: %s", dsn)
+	}
+
+	cfg.DBSSLMode = "verify-full"
+	cfg.DBSSLRootCert = "/etc/ssl/ca.crt"
+	cfg.DBSSLCert = "/etc/ssl/client.crt"
+	cfg.DBSSLKey = "/etc/ssl/client.key"
+	cfg.DBConnectTimeout = time.Millisecond * 2500
+
+	expected := "postgresql://exchange:p%40ss%2Fword@db:5432/rates?connect_timeout=3&sslcert=%2Fetc%2Fssl%2Fclient.crt" +
+		"&sslkey=%2Fetc%2Fssl%2Fclient.key&sslmode=verify-full&sslrootcert=%2Fetc%2Fssl%2Fca.crt"
+
+	if dsn := cfg.DSN(); dsn != expected {
+		t.Errorf("expected %s, got %s", expected, dsn)
+	}
+}
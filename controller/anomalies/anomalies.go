@@ -0,0 +1,27 @@
+package anomalies
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/service"
+)
+
+func New(validator service.Validator) *Anomalies {
+	return &Anomalies{validator: validator}
+}
+
+type Anomalies struct {
+	validator service.Validator // validation of the obtained rates
+}
+
+// List godoc
+//
+//	@Summary		List quarantined rates
+//	@Description	pairs whose latest rates were rejected by validation, the last good rate is served
+//	@Description	instead until the pair recovers or the new rate level is confirmed
+//	@Tags			rates
+//	@Produce		json
+//	@Success		200	{array}	model.Anomaly
+//	@Router			/rates/anomalies [get]
+func (a *Anomalies) List(ctx *fiber.Ctx) error {
+	return ctx.JSON(a.validator.Quarantined())
+}
@@ -0,0 +1,39 @@
+package anomalies
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service/anomaly"
+)
+
+func TestList(t *testing.T) {
+	detector := anomaly.New()
+	detector.Validate(model.Rates{"BTC": {"USD": 60000}}, model.Rates{"BTC": {"USD": 0}})
+
+	app := fiber.New()
+	app.Get("/rates/anomalies", New(detector).List)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/rates/anomalies", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var result []model.Anomaly
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 1 || result[0].Pair != "BTC/USD" || result[0].LastGood != 60000 || result[0].Count != 1 {
+		t.Errorf("unexpected anomalies: %+v", result)
+	}
+}
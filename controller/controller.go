@@ -0,0 +1,33 @@
+// Package controller holds helpers shared by the HTTP controllers
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/storage"
+)
+
+// RateError maps error of the rate lookup to the response status:
+// unknown symbols are not found, unsupported pairs unprocessable and
+// unavailable rates, cancelled lookups included, are retried later.
+// Remaining errors are caused by the request itself
+func RateError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrUnknownSymbol):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+
+	case errors.Is(err, storage.ErrUnsupportedPair):
+		return fiber.NewError(http.StatusUnprocessableEntity, err.Error())
+
+	case errors.Is(err, storage.ErrStale),
+		errors.Is(err, storage.ErrProviderDown),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return fiber.NewError(http.StatusServiceUnavailable, err.Error())
+	}
+
+	return fiber.NewError(http.StatusBadRequest, err.Error())
+}
@@ -0,0 +1,142 @@
+package conversions
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultLimit = 1000  // default max number of records returned
+	maxLimit     = 10000 // max number of records client may request
+)
+
+var csvHeader = []string{"created_at", "request_id", "client", "from", "to", "amount", "rate", "result", "rate_time"}
+
+func New(ledger storage.LedgerStorage) *Conversions {
+	return &Conversions{ledger: ledger}
+}
+
+type Conversions struct {
+	ledger storage.LedgerStorage // persistence provider for conversion records
+}
+
+// List godoc
+//
+//	@Summary		List served conversions
+//	@Description	query conversion ledger by date range and client, optionally exported as CSV
+//	@Tags			conversions
+//	@Produce		json
+//	@Produce		text/csv
+//	@Param			since	query	string	false	"Served at or after, RFC3339"	example(2024-01-01T00:00:00Z)
+//	@Param			until	query	string	false	"Served before, RFC3339"		example(2024-02-01T00:00:00Z)
+//	@Param			client	query	string	false	"Client identifier"
+//	@Param			limit	query	int		false	"Max number of records"			example(100)
+//	@Param			format	query	string	false	"Response format"				Enums(json, csv)
+//	@Success		200	{array}		model.ConversionRecord
+//	@Failure		400	{string}	string	"invalid since: 2024-01-01"
+//	@Failure		401	{string}	string	"Missing or malformed API Key"
+//	@Failure		500	{string}	string
+//	@Security		AdminToken
+//	@Router			/conversions [get]
+func (c *Conversions) List(ctx *fiber.Ctx) error {
+	filter, err := parseFilter(ctx)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	records, err := c.ledger.FindConversions(ctx.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to query conversion ledger")
+		return fiber.NewError(http.StatusInternalServerError, "unable to query conversion ledger")
+	}
+
+	switch ctx.Query("format", "json") {
+	case "json":
+		if records == nil {
+			records = []model.ConversionRecord{}
+		}
+
+		return ctx.JSON(records)
+
+	case "csv":
+		return writeCSV(ctx, records)
+	}
+
+	return fiber.NewError(http.StatusBadRequest, "unsupported format: "+ctx.Query("format"))
+}
+
+func parseFilter(ctx *fiber.Ctx) (model.ConversionFilter, error) {
+	filter := model.ConversionFilter{
+		Client: ctx.Query("client"),
+		Limit:  ctx.QueryInt("limit", defaultLimit),
+	}
+
+	if filter.Limit <= 0 || filter.Limit > maxLimit {
+		return filter, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := ctx.Query(param)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %s", param, value)
+		}
+
+		*t = parsed
+	}
+
+	return filter, nil
+}
+
+func writeCSV(ctx *fiber.Ctx, records []model.ConversionRecord) error {
+	ctx.Set(fiber.HeaderContentType, "text/csv")
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="conversions.csv"`)
+
+	w := csv.NewWriter(ctx)
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		err := w.Write([]string{
+			r.CreatedAt.Format(time.RFC3339Nano),
+			cell(r.RequestID),
+			cell(r.Client),
+			cell(r.From),
+			cell(r.To),
+			strconv.FormatFloat(r.Amount, 'f', -1, 64),
+			strconv.FormatFloat(r.Rate, 'f', -1, 64),
+			strconv.FormatFloat(r.Result, 'f', -1, 64),
+			r.RateTime.Format(time.RFC3339Nano),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// cell neutralizes text spreadsheets would evaluate as
+// formula, e.g. =HYPERLINK(...), by prefixing it with quote
+func cell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
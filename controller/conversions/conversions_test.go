@@ -0,0 +1,164 @@
+package conversions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+)
+
+var (
+	day      = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rateTime = day.Add(-time.Minute)
+	ledger   = []model.ConversionRecord{
+		{RequestID: "req-1", Client: "acme", From: "BTC", To: "USD", Amount: 1.5, Rate: 60000, Result: 90000, RateTime: rateTime, CreatedAt: day},
+		{RequestID: "req-2", Client: "globex", From: "USD", To: "ETH", Amount: 100, Rate: 0.0005, Result: 0.05, RateTime: rateTime, CreatedAt: day.Add(time.Hour)},
+		{RequestID: "req-3", Client: "acme", From: "EUR", To: "BTC", Amount: 10, Rate: 0.00002, Result: 0.0002, RateTime: rateTime, CreatedAt: day.Add(time.Hour * 48)},
+	}
+)
+
+func get(t *testing.T, app *fiber.App, query string) (*http.Response, []byte) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/conversions?"+query, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, body
+}
+
+func TestList(t *testing.T) {
+	app := fiber.New()
+	app.Get("/conversions", New(fake.NewLedgerStorage(ledger...)).List)
+
+	tests := []struct {
+		name     string
+		query    string
+		status   int
+		expected []string
+		body     string
+	}{
+		{name: "all", query: "", status: http.StatusOK, expected: []string{"req-1", "req-2", "req-3"}},
+		{name: "client", query: "client=acme", status: http.StatusOK, expected: []string{"req-1", "req-3"}},
+		{name: "date range", query: "since=2024-01-01T00:30:00Z&until=2024-01-02T00:00:00Z", status: http.StatusOK, expected: []string{"req-2"}},
+		{name: "limit", query: "limit=1", status: http.StatusOK, expected: []string{"req-1"}},
+		{name: "no match", query: "client=initech", status: http.StatusOK, expected: []string{}},
+		{name: "invalid since", query: "since=2024-01-01", status: http.StatusBadRequest, body: "invalid since: 2024-01-01"},
+		{name: "invalid limit", query: "limit=0", status: http.StatusBadRequest, body: "limit must be between 1 and 10000"},
+		{name: "invalid format", query: "format=xml", status: http.StatusBadRequest, body: "unsupported format: xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(t, app, tt.query)
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, resp.StatusCode, body)
+			}
+
+			if tt.status != http.StatusOK {
+				if string(body) != tt.body {
+					t.Errorf("expected body %q, got %q", tt.body, body)
+				}
+				return
+			}
+
+			var records []model.ConversionRecord
+			if err := json.Unmarshal(body, &records); err != nil {
+				t.Fatal(err)
+			}
+
+			if records == nil || len(records) != len(tt.expected) {
+				t.Fatalf("expected %v, got %+v", tt.expected, records)
+			}
+
+			for i, id := range tt.expected {
+				if records[i].RequestID != id {
+					t.Errorf("expected %s at %d, got %s", id, i, records[i].RequestID)
+				}
+			}
+		})
+	}
+}
+
+func TestListCSV(t *testing.T) {
+	app := fiber.New()
+	app.Get("/conversions", New(fake.NewLedgerStorage(ledger...)).List)
+
+	resp, body := get(t, app, "format=csv&client=acme")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "text/csv" {
+		t.Errorf("expected text/csv content type, got %s", ct)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		csvHeader,
+		{"2024-01-01T00:00:00Z", "req-1", "acme", "BTC", "USD", "1.5", "60000", "90000", "2023-12-31T23:59:00Z"},
+		{"2024-01-03T00:00:00Z", "req-3", "acme", "EUR", "BTC", "10", "0.00002", "0.0002", "2023-12-31T23:59:00Z"},
+	}
+
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d: %v", len(expected), len(rows), rows)
+	}
+
+	for i := range expected {
+		if strings.Join(rows[i], ",") != strings.Join(expected[i], ",") {
+			t.Errorf("row %d: expected %v, got %v", i, expected[i], rows[i])
+		}
+	}
+}
+
+func TestListStorageError(t *testing.T) {
+	store := fake.NewLedgerStorage()
+	store.Err = errors.New("db is down")
+
+	app := fiber.New()
+	app.Get("/conversions", New(store).List)
+
+	resp, _ := get(t, app, "")
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", resp.StatusCode)
+	}
+}
+
+func TestListCSVFormula(t *testing.T) {
+	app := fiber.New()
+	app.Get("/conversions", New(fake.NewLedgerStorage(
+		model.ConversionRecord{RequestID: "=1+2", Client: "@acme", From: "+BTC", To: "-USD", Amount: 1, Rate: 60000, Result: 60000, RateTime: rateTime, CreatedAt: day},
+	)).List)
+
+	_, body := get(t, app, "format=csv")
+
+	rows, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || strings.Join(rows[1][1:5], ",") != "'=1+2,'@acme,'+BTC,'-USD" {
+		t.Errorf("expected formulas to be neutralized, got %v", rows)
+	}
+}
@@ -3,47 +3,206 @@ package converter
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/kylycht/exchange/storage"
+	"github.com/kylycht/exchange/controller"
+	"github.com/kylycht/exchange/controller/locale"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
 	"github.com/rs/zerolog/log"
 )
 
-func New(cache storage.Cache) *Converter {
-	return &Converter{cache: cache}
+const (
+	clientHeader  = "X-Client-ID" // header identifying the client in the ledger
+	formatRaw     = "raw"         // amounts are written as numbers
+	formatDisplay = "display"     // amounts are written as localized strings
+)
+
+// displayConversion is conversion formatted
+// for display in the locale of the client
+type displayConversion struct {
+	From     string    `json:"from"`      // From currency symbol
+	To       string    `json:"to"`        // To currency symbol
+	Amount   string    `json:"amount"`    // Amount of from currency, e.g. 1.234,56 €
+	MidRate  string    `json:"mid_rate"`  // Mid market rate
+	Rate     string    `json:"rate"`      // Rate applied after the spread
+	Gross    string    `json:"gross"`     // Amount of to currency before fees
+	Fee      string    `json:"fee"`       // Fee in to currency
+	Net      string    `json:"net"`       // Amount of to currency after fees
+	RateTime time.Time `json:"rate_time"` // Time the mid rate was obtained
+}
+
+// Option configures the converter
+type Option func(*Converter)
+
+// WithRecorder records served conversions into the ledger,
+// when flaggedOnly is set only conversions requested
+// with `record=true` are recorded
+func WithRecorder(recorder service.Recorder, flaggedOnly bool) Option {
+	return func(c *Converter) {
+		c.recorder = recorder
+		c.flaggedOnly = flaggedOnly
+	}
+}
+
+func New(pricer service.Pricer, opts ...Option) *Converter {
+	c := &Converter{pricer: pricer}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 type Converter struct {
-	cache storage.Cache
+	pricer      service.Pricer   // pricing of the conversions
+	recorder    service.Recorder // audit trail of the conversions, optional
+	flaggedOnly bool             // record only conversions flagged by the client
 }
 
 // Convert godoc
 //
 //	@Summary		Convert given C2F or F2C
-//	@Description	convert fiat to crypto or vise versa
+//	@Description	convert fiat to crypto or vise versa, spread and fees are applied on top of the mid rate.
+//	@Description	With target_amount computes amount of from currency required to receive target_amount after fees
 //	@Tags			converter
+//	@Produce		json
 //	@Param			from	query	string	true	"From Currency" example(BTC)
 //	@Param			to		query	string	true	"To Currency"   example(USD)
-//	@Param			amount	query	number	false	"From Currency" example(3.1)
-//	@Success		200	{string}	string "3.4"
-//	@Failure		400	{string}	string "invalid conversion for pair: CNY/EUR"
+//	@Param			amount	query	string	false	"From Currency, in the conventions of Accept-Language, e.g. 1.234,56" example(3.1)
+//	@Param			target_amount	query	string	false	"To Currency to receive, exclusive with amount" example(250)
+//	@Param			format	query	string	false	"raw(default) numbers or display strings localized by Accept-Language" Enums(raw, display)
+//	@Param			record	query	bool	false	"Record conversion in the ledger"
+//	@Param			X-Client-ID	header	string	false	"Client identifier stored in the ledger"
+//	@Param			Accept-Language	header	string	false	"Locale of amounts, e.g. de-DE"
+//	@Success		200	{object}	model.Conversion
+//	@Failure		400	{string}	string "amount must be positive"
+//	@Failure		404	{string}	string "unknown symbol: XYZ"
+//	@Failure		422	{string}	string "unsupported pair: CNY/EUR"
+//	@Failure		503	{string}	string "exchange provider is down"
 //	@Router			/convert [get]
 func (c *Converter) Convert(ctx *fiber.Ctx) error {
 	from := ctx.Query("from")
 	to := ctx.Query("to")
-	amount := ctx.QueryFloat("amount", 1)
+	format := ctx.Query("format", formatRaw)
+	loc := locale.FromAcceptLanguage(ctx.Get(fiber.HeaderAcceptLanguage))
+
+	ctx.Vary(fiber.HeaderAcceptLanguage)
 
-	rateInfo, err := c.cache.Get(from, to)
+	if from == "" || to == "" {
+		return fiber.NewError(http.StatusBadRequest, "from and to are required")
+	}
+
+	if format != formatRaw && format != formatDisplay {
+		return fiber.NewError(http.StatusBadRequest, "format must be either raw or display")
+	}
+
+	amount, err := parseAmount(ctx, loc, "amount", 1)
 	if err != nil {
-		ctx.Context().Error(err.Error(), http.StatusBadRequest)
-		return err
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	var conversion model.Conversion
+
+	switch {
+	case ctx.Query("target_amount") == "":
+		conversion, err = c.pricer.Convert(ctx.UserContext(), from, to, amount)
+
+	case ctx.Query("amount") != "":
+		return fiber.NewError(http.StatusBadRequest, "amount and target_amount are mutually exclusive")
+
+	default:
+		var target float64
+
+		target, err = parseAmount(ctx, loc, "target_amount", 0)
+		if err != nil {
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+
+		conversion, err = c.pricer.ConvertTarget(ctx.UserContext(), from, to, target)
+	}
+
+	if err != nil {
+		return controller.RateError(err)
 	}
 
-	log.Debug().Str(from, to).Float64("amount", amount).Msg("converting")
+	log.Ctx(ctx.UserContext()).Debug().Str("from", from).Str("to", to).Float64("amount", amount).Msg("converting")
+
+	c.record(ctx, conversion)
+
+	if format == formatDisplay {
+		return c.write(ctx, display(loc, conversion))
+	}
+
+	return c.write(ctx, conversion)
+}
 
-	result := amount * rateInfo.Rate
-	_, err = ctx.WriteString(fmt.Sprintf("%f", result))
+// parseAmount parses query parameter in the conventions of
+// the locale, fallback is returned if parameter is missing
+func parseAmount(ctx *fiber.Ctx, loc locale.Locale, key string, fallback float64) (float64, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	amount, err := loc.Parse(value)
 	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return amount, nil
+}
+
+// display formats amounts of the conversion in minor
+// units of their currencies, rates are kept unrounded
+func display(loc locale.Locale, conversion model.Conversion) displayConversion {
+	return displayConversion{
+		From:     conversion.From,
+		To:       conversion.To,
+		Amount:   loc.Format(conversion.Amount, conversion.Base),
+		MidRate:  loc.FormatNumber(conversion.MidRate, -1),
+		Rate:     loc.FormatNumber(conversion.Rate, -1),
+		Gross:    loc.Format(conversion.Gross, conversion.Target),
+		Fee:      loc.Format(conversion.Fee, conversion.Target),
+		Net:      loc.Format(conversion.Net, conversion.Target),
+		RateTime: conversion.RateTime,
+	}
+}
+
+// record queues served conversion into the ledger
+func (c *Converter) record(ctx *fiber.Ctx, conversion model.Conversion) {
+	if c.recorder == nil {
+		return
+	}
+
+	if c.flaggedOnly && !ctx.QueryBool("record") {
+		return
+	}
+
+	client := ctx.Get(clientHeader)
+	if client == "" {
+		client = ctx.IP()
+	}
+
+	requestID, _ := ctx.Locals("requestid").(string)
+
+	c.recorder.Record(model.ConversionRecord{
+		RequestID: requestID,
+		Client:    client,
+		From:      conversion.From,
+		To:        conversion.To,
+		Amount:    conversion.Amount,
+		Rate:      conversion.Rate,
+		Result:    conversion.Net,
+		RateTime:  conversion.RateTime,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+func (c *Converter) write(ctx *fiber.Ctx, conversion interface{}) error {
+	if err := ctx.JSON(conversion); err != nil {
 		log.Error().Err(err).Msg("error occurred during result write op")
 		return err
 	}
@@ -0,0 +1,273 @@
+package converter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service/pricing"
+	"github.com/kylycht/exchange/storage"
+)
+
+func TestConvert(t *testing.T) {
+	pricer, err := pricing.New(
+		fake.NewCache(map[string]float64{"BTC/USD": 60000}),
+		fake.NewPricingStorage(model.PricingRule{From: "BTC", To: "USD", Spread: 0.002, FixedFee: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pricer.Close()
+
+	app := fiber.New()
+	app.Get("/convert", New(pricer).Convert)
+
+	tests := []struct {
+		name       string
+		query      string
+		status     int
+		conversion model.Conversion
+		body       string
+	}{
+		{
+			name:       "amount",
+			query:      "from=BTC&to=USD&amount=1.5",
+			status:     http.StatusOK,
+			conversion: model.Conversion{From: "BTC", To: "USD", Amount: 1.5, MidRate: 60000, Rate: 59940, Gross: 89910, Fee: 1, Net: 89909},
+		},
+		{
+			name:       "default amount",
+			query:      "from=BTC&to=USD",
+			status:     http.StatusOK,
+			conversion: model.Conversion{From: "BTC", To: "USD", Amount: 1, MidRate: 60000, Rate: 59940, Gross: 59940, Fee: 1, Net: 59939},
+		},
+		{
+			name:       "lower case",
+			query:      "from=btc&to=usd&amount=2",
+			status:     http.StatusOK,
+			conversion: model.Conversion{From: "BTC", To: "USD", Amount: 2, MidRate: 60000, Rate: 59940, Gross: 119880, Fee: 1, Net: 119879},
+		},
+		{
+			name:       "target amount",
+			query:      "from=BTC&to=USD&target_amount=59939",
+			status:     http.StatusOK,
+			conversion: model.Conversion{From: "BTC", To: "USD", Amount: 1, MidRate: 60000, Rate: 59940, Gross: 59940, Fee: 1, Net: 59939},
+		},
+		{name: "amount and target amount", query: "from=BTC&to=USD&amount=1&target_amount=100", status: http.StatusBadRequest, body: "amount and target_amount are mutually exclusive"},
+		{name: "invalid target amount", query: "from=BTC&to=USD&target_amount=abc", status: http.StatusBadRequest, body: `target_amount: invalid amount: "abc"`},
+		{name: "invalid amount", query: "from=BTC&to=USD&amount=1e5", status: http.StatusBadRequest, body: `amount: invalid amount: "1e5"`},
+		{name: "zero target amount", query: "from=BTC&to=USD&target_amount=0", status: http.StatusBadRequest, body: pricing.ErrInvalidAmount.Error()},
+		{name: "unknown format", query: "from=BTC&to=USD&format=xml", status: http.StatusBadRequest, body: "format must be either raw or display"},
+		{name: "unsupported pair", query: "from=CNY&to=EUR", status: http.StatusUnprocessableEntity, body: "unsupported pair: CNY/EUR"},
+		{name: "missing pair", query: "", status: http.StatusBadRequest, body: "from and to are required"},
+		{name: "negative amount", query: "from=BTC&to=USD&amount=-1", status: http.StatusBadRequest, body: pricing.ErrInvalidAmount.Error()},
+		{name: "amount below fee", query: "from=BTC&to=USD&amount=0.00001", status: http.StatusBadRequest, body: pricing.ErrAmountTooSmall.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/convert?"+tt.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, resp.StatusCode, body)
+			}
+
+			if tt.status != http.StatusOK {
+				if string(body) != tt.body {
+					t.Errorf("expected body %q, got %q", tt.body, body)
+				}
+				return
+			}
+
+			conversion := model.Conversion{}
+			if err := json.Unmarshal(body, &conversion); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(conversion, tt.conversion) {
+				t.Errorf("expected %+v, got %+v", tt.conversion, conversion)
+			}
+		})
+	}
+}
+
+func TestConvertUnavailable(t *testing.T) {
+	cache := fake.NewCache(map[string]float64{"BTC/USD": 60000})
+	cache.SetErr(storage.ErrProviderDown)
+
+	pricer, err := pricing.New(cache, fake.NewPricingStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pricer.Close()
+
+	app := fiber.New()
+	app.Get("/convert", New(pricer).Convert)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/convert?from=BTC&to=USD", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
+
+type recorderFn func(model.ConversionRecord)
+
+func (fn recorderFn) Record(record model.ConversionRecord) {
+	fn(record)
+}
+
+func TestConvertRecord(t *testing.T) {
+	pricer, err := pricing.New(
+		fake.NewCache(map[string]float64{"BTC/USD": 60000}),
+		fake.NewPricingStorage(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pricer.Close()
+
+	tests := []struct {
+		name        string
+		flaggedOnly bool
+		query       string
+		header      string
+		recorded    bool
+		client      string
+	}{
+		{name: "all", query: "from=BTC&to=USD&amount=2", header: "acme", recorded: true, client: "acme"},
+		{name: "client from ip", query: "from=BTC&to=USD&amount=2", recorded: true, client: "0.0.0.0"},
+		{name: "flagged", flaggedOnly: true, query: "from=BTC&to=USD&amount=2&record=true", recorded: true, client: "0.0.0.0"},
+		{name: "not flagged", flaggedOnly: true, query: "from=BTC&to=USD&amount=2"},
+		{name: "failed conversion", query: "from=CNY&to=USD&amount=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []model.ConversionRecord
+
+			app := fiber.New()
+			app.Use(func(ctx *fiber.Ctx) error {
+				ctx.Locals("requestid", "req-1")
+				return ctx.Next()
+			})
+			app.Get("/convert", New(pricer, WithRecorder(recorderFn(func(r model.ConversionRecord) {
+				records = append(records, r)
+			}), tt.flaggedOnly)).Convert)
+
+			req := httptest.NewRequest(http.MethodGet, "/convert?"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Client-ID", tt.header)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if !tt.recorded {
+				if len(records) != 0 {
+					t.Fatalf("expected no records, got %+v", records)
+				}
+				return
+			}
+
+			if len(records) != 1 {
+				t.Fatalf("expected single record, got %d", len(records))
+			}
+
+			r := records[0]
+			if r.RequestID != "req-1" || r.Client != tt.client || r.From != "BTC" || r.To != "USD" ||
+				r.Amount != 2 || r.Rate != 60000 || r.Result != 120000 || r.CreatedAt.IsZero() {
+				t.Errorf("unexpected record: %+v", r)
+			}
+		})
+	}
+}
+
+func TestConvertLocale(t *testing.T) {
+	cache := fake.NewCache(map[string]float64{"BTC/EUR": 50000})
+	cache.SetCurrency(model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, Decimals: 8, DisplaySymbol: "₿"})
+	cache.SetCurrency(model.Currency{Symbol: "EUR", CurrencyType: model.Fiat, Decimals: 2, DisplaySymbol: "€"})
+
+	pricer, err := pricing.New(cache, fake.NewPricingStorage(model.PricingRule{FixedFee: 1.5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pricer.Close()
+
+	app := fiber.New()
+	app.Get("/convert", New(pricer).Convert)
+
+	tests := []struct {
+		name     string
+		query    string
+		language string
+		body     string
+	}{
+		{
+			name:     "raw",
+			query:    "from=BTC&to=EUR&amount=1.234,5",
+			language: "de-DE,de;q=0.9",
+			body:     `"amount":1234.5,`,
+		},
+		{
+			name:     "display",
+			query:    "from=BTC&to=EUR&amount=1.234,5&format=display",
+			language: "de-DE,de;q=0.9",
+			body:     `{"from":"BTC","to":"EUR","amount":"1.234,50000000 ₿","mid_rate":"50.000","rate":"50.000","gross":"61.725.000,00 €","fee":"1,50 €","net":"61.724.998,50 €",`,
+		},
+		{
+			name:  "display without language",
+			query: "from=BTC&to=EUR&amount=0.5&format=display",
+			body:  `{"from":"BTC","to":"EUR","amount":"₿0.50000000","mid_rate":"50,000","rate":"50,000","gross":"€25,000.00","fee":"€1.50","net":"€24,998.50",`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/convert?"+tt.query, nil)
+			req.Header.Set("Accept-Language", tt.language)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+			}
+
+			if !strings.Contains(strings.ReplaceAll(string(body), "\u00a0", " "), tt.body) {
+				t.Errorf("expected body to contain %s, got %s", tt.body, body)
+			}
+		})
+	}
+}
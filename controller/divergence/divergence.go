@@ -0,0 +1,27 @@
+package divergence
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/service"
+)
+
+func New(reconciler service.Reconciler) *Divergence {
+	return &Divergence{reconciler: reconciler}
+}
+
+type Divergence struct {
+	reconciler service.Reconciler // reconciliation of the opposite pairs
+}
+
+// Get godoc
+//
+//	@Summary		Get divergence of the opposite pairs
+//	@Description	divergence of every pair obtained in both directions, e.g. BTC/USD and USD/BTC, measured by the
+//	@Description	latest refresh before reconciliation policy is applied. Divergence is the value gained by a round trip
+//	@Tags			rates
+//	@Produce		json
+//	@Success		200	{object}	model.Reconciliation
+//	@Router			/rates/divergence [get]
+func (d *Divergence) Get(ctx *fiber.Ctx) error {
+	return ctx.JSON(d.reconciler.Latest())
+}
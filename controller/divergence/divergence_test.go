@@ -0,0 +1,43 @@
+package divergence
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service/reconcile"
+)
+
+func TestGet(t *testing.T) {
+	reconciler := reconcile.New(reconcile.PolicyC2F)
+	rates := model.Rates{"BTC": {"USD": 50000}, "USD": {"BTC": 0.0000201}}
+	reconciler.Reconcile(
+		[]model.Currency{{Symbol: "BTC", CurrencyType: model.Crypto}, {Symbol: "USD", CurrencyType: model.Fiat}},
+		rates, rates,
+	)
+
+	app := fiber.New()
+	app.Get("/rates/divergence", New(reconciler).Get)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/rates/divergence", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var result model.Reconciliation
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Policy != "c2f" || len(result.Pairs) != 1 || result.Pairs[0].Pair != "BTC/USD" || result.Pairs[0].Inverse != 0.0000201 {
+		t.Errorf("unexpected reconciliation: %+v", result)
+	}
+}
@@ -0,0 +1,184 @@
+package graphql
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	gqlgen "github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/executor"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/kylycht/exchange/graph"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	eventStream       string = "text/event-stream" // content type of subscription stream
+	keepAliveInterval        = time.Second * 15    // interval idle stream is probed at
+)
+
+func New(cache storage.Cache, storage storage.Storage) *GraphQL {
+	schema := graph.NewExecutableSchema(graph.Config{
+		Resolvers: &graph.Resolver{
+			Cache:   cache,
+			Storage: storage,
+		},
+	})
+
+	srv := handler.New(schema)
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+
+	exec := executor.New(schema)
+	exec.Use(extension.Introspection{})
+
+	return &GraphQL{
+		queryHandler: adaptor.HTTPHandler(srv),
+		exec:         exec,
+	}
+}
+
+type GraphQL struct {
+	queryHandler fiber.Handler      // handles queries over plain http
+	exec         *executor.Executor // executes subscriptions streamed over SSE
+}
+
+// Serve handles both queries and subscriptions.
+// Subscriptions are delivered as server-sent events
+// when client accepts text/event-stream, following
+// the distinct connections mode of graphql-sse
+func (g *GraphQL) Serve(ctx *fiber.Ctx) error {
+	if ctx.Method() == fiber.MethodPost && strings.Contains(ctx.Get(fiber.HeaderAccept), eventStream) {
+		return g.subscribe(ctx)
+	}
+
+	return g.queryHandler(ctx)
+}
+
+func (g *GraphQL) subscribe(ctx *fiber.Ctx) error {
+	start := gqlgen.Now()
+	params := &gqlgen.RawParams{}
+
+	if err := json.Unmarshal(ctx.Body(), params); err != nil {
+		resp := g.exec.DispatchError(ctx.Context(), gqlerror.List{
+			gqlerror.Errorf("json request body could not be decoded: %s", err),
+		})
+
+		return ctx.Status(http.StatusBadRequest).JSON(resp)
+	}
+
+	params.ReadTime = gqlgen.TraceTiming{Start: start, End: gqlgen.Now()}
+
+	// fasthttp recycles request context once handler returns,
+	// therefore stream runs on its own context which is
+	// cancelled as soon as write to the client fails, idle
+	// stream is probed by keep-alive comments to notice it
+	streamCtx, cancelFn := context.WithCancel(context.Background())
+	streamCtx = gqlgen.StartOperationTrace(streamCtx)
+
+	rc, opErr := g.exec.CreateOperationContext(streamCtx, params)
+	streamCtx = gqlgen.WithOperationContext(streamCtx, rc)
+
+	ctx.Set(fiber.HeaderContentType, eventStream)
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancelFn()
+
+		fmt.Fprint(w, ":\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		if opErr != nil {
+			if err := writeEvent(w, g.exec.DispatchError(streamCtx, opErr)); err != nil {
+				return
+			}
+		} else {
+			responses, respCtx := g.exec.DispatchOperation(streamCtx, rc)
+			respC := make(chan *gqlgen.Response)
+
+			go func() {
+				defer close(respC)
+
+				for {
+					resp := responses(respCtx)
+					if resp == nil {
+						return
+					}
+
+					select {
+					case respC <- resp:
+					case <-streamCtx.Done():
+						return
+					}
+				}
+			}()
+
+			if err := stream(w, respC, keepAliveInterval); err != nil {
+				log.Debug().Err(err).Msg("subscriber went away")
+				return
+			}
+		}
+
+		fmt.Fprint(w, "event: complete\n\n")
+		w.Flush()
+	})
+
+	return nil
+}
+
+// stream writes responses until they are exhausted,
+// keep-alive comment is written every interval in between
+func stream(w *bufio.Writer, respC <-chan *gqlgen.Response, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case resp, ok := <-respC:
+			if !ok {
+				return nil
+			}
+
+			if err := writeEvent(w, resp); err != nil {
+				return err
+			}
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ":\n\n"); err != nil {
+				return err
+			}
+
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeEvent(w *bufio.Writer, resp *gqlgen.Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "event: next\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
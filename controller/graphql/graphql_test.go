@@ -0,0 +1,53 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	gqlgen "github.com/99designs/gqlgen/graphql"
+)
+
+type brokenWriter struct{}
+
+func (brokenWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestStreamKeepAlive(t *testing.T) {
+	var buf bytes.Buffer
+
+	respC := make(chan *gqlgen.Response)
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		respC <- &gqlgen.Response{Data: []byte(`{"rateUpdated":{"rate":60000}}`)}
+		close(respC)
+	}()
+
+	if err := stream(bufio.NewWriter(&buf), respC, time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := buf.String(); !strings.HasPrefix(out, ":\n\n") || !strings.HasSuffix(out, "event: next\ndata: {\"data\":{\"rateUpdated\":{\"rate\":60000}}}\n\n") {
+		t.Errorf("unexpected stream: %q", out)
+	}
+}
+
+func TestStreamClientGone(t *testing.T) {
+	respC := make(chan *gqlgen.Response)
+
+	done := make(chan error)
+	go func() { done <- stream(bufio.NewWriter(brokenWriter{}), respC, time.Millisecond*10) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected failed keep-alive to end idle stream")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected idle stream to notice client went away")
+	}
+}
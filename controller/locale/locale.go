@@ -0,0 +1,238 @@
+package locale
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kylycht/exchange/model"
+	"golang.org/x/text/language"
+)
+
+const (
+	nbsp       = "\u00a0" // no-break space
+	narrowNbsp = "\u202f" // narrow no-break space
+)
+
+// Locale holds number formatting
+// conventions of the language
+type Locale struct {
+	Tag         language.Tag // Tag of the language
+	Group       string       // Group separates thousands, e.g. "," in 1,234.56
+	Decimal     string       // Decimal separates fraction, e.g. "," in 1.234,56
+	SymbolFirst bool         // SymbolFirst places currency symbol before the amount
+	SymbolSpace bool         // SymbolSpace separates currency symbol from the amount
+}
+
+// Default is used when none of the requested languages is supported
+var Default = locales[0]
+
+// locales are supported languages, the first one is the default
+var locales = []Locale{
+	{Tag: language.English, Group: ",", Decimal: ".", SymbolFirst: true},
+	{Tag: language.German, Group: ".", Decimal: ",", SymbolSpace: true},
+	{Tag: language.MustParse("de-CH"), Group: "\u2019", Decimal: ".", SymbolFirst: true, SymbolSpace: true},
+	{Tag: language.French, Group: narrowNbsp, Decimal: ",", SymbolSpace: true},
+	{Tag: language.Spanish, Group: ".", Decimal: ",", SymbolSpace: true},
+	{Tag: language.Italian, Group: ".", Decimal: ",", SymbolSpace: true},
+	{Tag: language.Portuguese, Group: ".", Decimal: ",", SymbolSpace: true},
+	{Tag: language.Dutch, Group: ".", Decimal: ",", SymbolFirst: true, SymbolSpace: true},
+	{Tag: language.Polish, Group: nbsp, Decimal: ",", SymbolSpace: true},
+	{Tag: language.Russian, Group: nbsp, Decimal: ",", SymbolSpace: true},
+	{Tag: language.Ukrainian, Group: nbsp, Decimal: ",", SymbolSpace: true},
+	{Tag: language.Swedish, Group: nbsp, Decimal: ",", SymbolSpace: true},
+	{Tag: language.Japanese, Group: ",", Decimal: ".", SymbolFirst: true},
+	{Tag: language.Chinese, Group: ",", Decimal: ".", SymbolFirst: true},
+	{Tag: language.Korean, Group: ",", Decimal: ".", SymbolFirst: true},
+}
+
+var matcher = language.NewMatcher(tags())
+
+func tags() []language.Tag {
+	result := make([]language.Tag, 0, len(locales))
+	for _, l := range locales {
+		result = append(result, l.Tag)
+	}
+
+	return result
+}
+
+// FromAcceptLanguage returns the best supported locale
+// for the value of Accept-Language header
+func FromAcceptLanguage(header string) Locale {
+	requested, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(requested) == 0 {
+		return Default
+	}
+
+	_, index, confidence := matcher.Match(requested...)
+	if confidence == language.No {
+		return Default
+	}
+
+	return locales[index]
+}
+
+// FormatNumber formats value with given number of decimals,
+// negative decimals use the shortest exact representation
+func (l Locale) FormatNumber(value float64, decimals int) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	digits := strconv.FormatFloat(value, 'f', decimals, 64)
+
+	integer, fraction, hasFraction := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(digit)
+	}
+
+	if hasFraction {
+		b.WriteString(l.Decimal)
+		b.WriteString(fraction)
+	}
+
+	return b.String()
+}
+
+// Format formats amount in minor units of the currency along with
+// its display symbol, currencies without one are shown by the symbol
+func (l Locale) Format(amount float64, c model.Currency) string {
+	symbol, space := c.DisplaySymbol, l.SymbolSpace
+	if symbol == "" {
+		symbol, space = c.Symbol, true
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	number := l.FormatNumber(amount, c.Decimals)
+
+	separator := ""
+	if space {
+		separator = nbsp
+	}
+
+	if l.SymbolFirst {
+		return sign + symbol + separator + number
+	}
+
+	return sign + number + separator + symbol
+}
+
+// Parse parses amount written either in the conventions of the
+// locale, e.g. 1.234,56 for German, or as a plain number, e.g. 1234.56.
+// A single separator followed by groups of three digits is treated
+// as the group separator unless it is the decimal one of the locale
+func (l Locale) Parse(s string) (float64, error) {
+	// spaces and apostrophes only ever separate groups
+	value := strings.NewReplacer(" ", "", nbsp, "", narrowNbsp, "", "'", "", "\u2019", "").Replace(strings.TrimSpace(s))
+
+	decimal := l.decimal(value)
+
+	integer, fraction := value, ""
+	if decimal != "" {
+		i := strings.LastIndex(value, decimal)
+		integer, fraction = value[:i], value[i+1:]
+	}
+
+	for _, group := range []string{".", ","} {
+		if group == decimal || !strings.Contains(integer, group) {
+			continue
+		}
+
+		if !isGrouped(integer, group) {
+			return 0, fmt.Errorf("invalid amount: %q", s)
+		}
+
+		integer = strings.ReplaceAll(integer, group, "")
+	}
+
+	if !isNumber(integer, fraction) {
+		return 0, fmt.Errorf("invalid amount: %q", s)
+	}
+
+	amount, err := strconv.ParseFloat(integer+"."+fraction, 64)
+	if err != nil || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("invalid amount: %q", s)
+	}
+
+	return amount, nil
+}
+
+// decimal returns decimal separator used in the value,
+// empty if value has no fraction
+func (l Locale) decimal(value string) string {
+	dot, comma := strings.LastIndex(value, "."), strings.LastIndex(value, ",")
+
+	switch {
+	case dot >= 0 && comma >= 0:
+		// the last separator is the decimal one
+		if comma > dot {
+			return ","
+		}
+		return "."
+
+	case dot >= 0 || comma >= 0:
+		sep := "."
+		if comma >= 0 {
+			sep = ","
+		}
+
+		if isGrouped(value, sep) && (strings.Count(value, sep) > 1 || sep != l.Decimal) {
+			return ""
+		}
+
+		return sep
+	}
+
+	return ""
+}
+
+// isGrouped reports whether integer part is
+// split into groups of three digits by sep
+func isGrouped(integer, sep string) bool {
+	groups := strings.Split(strings.TrimPrefix(integer, "-"), sep)
+	if len(groups) < 2 || len(groups[0]) == 0 || len(groups[0]) > 3 {
+		return false
+	}
+
+	for _, g := range groups[1:] {
+		if len(g) != 3 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isNumber reports whether parts form plain decimal number,
+// e.g. -1234.56, rejecting exponents and hex notation
+func isNumber(integer, fraction string) bool {
+	integer = strings.TrimPrefix(integer, "-")
+
+	if integer == "" && fraction == "" {
+		return false
+	}
+
+	for _, r := range integer + fraction {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
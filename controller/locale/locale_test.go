@@ -0,0 +1,126 @@
+package locale
+
+import (
+	"testing"
+
+	"github.com/kylycht/exchange/model"
+	"golang.org/x/text/language"
+)
+
+func TestFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		tag    language.Tag
+	}{
+		{header: "", tag: language.English},
+		{header: "de-DE,de;q=0.9,en;q=0.8", tag: language.German},
+		{header: "de-CH", tag: language.MustParse("de-CH")},
+		{header: "fr-CA;q=0.8, en;q=0.5", tag: language.French},
+		{header: "xx", tag: language.English},
+		{header: "not a header;;", tag: language.English},
+	}
+
+	for _, tt := range tests {
+		if l := FromAcceptLanguage(tt.header); l.Tag != tt.tag {
+			t.Errorf("%q: expected %s, got %s", tt.header, tt.tag, l.Tag)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	eur := model.Currency{Symbol: "EUR", Decimals: 2, DisplaySymbol: "€"}
+	jpy := model.Currency{Symbol: "JPY", Decimals: 0, DisplaySymbol: "¥"}
+	btc := model.Currency{Symbol: "BTC", Decimals: 8}
+
+	tests := []struct {
+		locale Locale
+		amount float64
+		c      model.Currency
+		want   string
+	}{
+		{locale: FromAcceptLanguage("en"), amount: 1234.5, c: eur, want: "€1,234.50"},
+		{locale: FromAcceptLanguage("en"), amount: -1234.5, c: eur, want: "-€1,234.50"},
+		{locale: FromAcceptLanguage("de"), amount: 1234567.891, c: eur, want: "1.234.567,89\u00a0€"},
+		{locale: FromAcceptLanguage("fr"), amount: 1234.5, c: eur, want: "1\u202f234,50\u00a0€"},
+		{locale: FromAcceptLanguage("nl"), amount: 12.5, c: eur, want: "€\u00a012,50"},
+		{locale: FromAcceptLanguage("ja"), amount: 1234, c: jpy, want: "¥1,234"},
+		{locale: FromAcceptLanguage("en"), amount: 0.5, c: btc, want: "BTC\u00a00.50000000"},
+		{locale: FromAcceptLanguage("de"), amount: 0.5, c: btc, want: "0,50000000\u00a0BTC"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.locale.Format(tt.amount, tt.c); got != tt.want {
+			t.Errorf("%s %v %s: expected %q, got %q", tt.locale.Tag, tt.amount, tt.c.Symbol, tt.want, got)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	de := FromAcceptLanguage("de")
+
+	if got := de.FormatNumber(60123.000125, -1); got != "60.123,000125" {
+		t.Errorf("expected shortest representation, got %q", got)
+	}
+
+	if got := de.FormatNumber(999, 2); got != "999,00" {
+		t.Errorf("expected no group separator, got %q", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	en, de, fr, ch := FromAcceptLanguage("en"), FromAcceptLanguage("de"), FromAcceptLanguage("fr"), FromAcceptLanguage("de-CH")
+
+	tests := []struct {
+		locale  Locale
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{locale: en, input: "3.1", want: 3.1},
+		{locale: en, input: "1,234.56", want: 1234.56},
+		{locale: en, input: "1,234", want: 1234},
+		{locale: en, input: "1,234,567", want: 1234567},
+		{locale: en, input: "1.234,56", want: 1234.56},
+		{locale: en, input: "3,1", want: 3.1},
+		{locale: de, input: "1.234,56", want: 1234.56},
+		{locale: de, input: "1.234", want: 1234},
+		{locale: de, input: "3,1", want: 3.1},
+		{locale: de, input: "3.1", want: 3.1},
+		{locale: de, input: "1,234", want: 1.234},
+		{locale: de, input: "1.234.567,891", want: 1234567.891},
+		{locale: fr, input: "1 234,56", want: 1234.56},
+		{locale: fr, input: "1\u202f234,56", want: 1234.56},
+		{locale: ch, input: "1'234.56", want: 1234.56},
+		{locale: en, input: " 42 ", want: 42},
+		{locale: en, input: ".5", want: 0.5},
+		{locale: en, input: "-1,000.5", want: -1000.5},
+		{locale: en, input: "", wantErr: true},
+		{locale: en, input: "abc", wantErr: true},
+		{locale: en, input: "1e5", wantErr: true},
+		{locale: en, input: "0x10", wantErr: true},
+		{locale: en, input: "inf", wantErr: true},
+		{locale: en, input: "1,23,456", wantErr: true},
+		{locale: de, input: "1.234.56", wantErr: true},
+		{locale: de, input: "1,234,56", wantErr: true},
+		{locale: en, input: "1.234.567,8.9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.locale.Parse(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s %q: expected error, got %v", tt.locale.Tag, tt.input, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.locale.Tag, tt.input, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%s %q: expected %v, got %v", tt.locale.Tag, tt.input, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package portfolio
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/controller"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/service/valuation"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+func New(valuer service.Valuer) *Portfolio {
+	return &Portfolio{valuer: valuer}
+}
+
+type Portfolio struct {
+	valuer service.Valuer // valuation of the baskets
+}
+
+type valueRequest struct {
+	Currency string          `json:"currency" example:"USD"`
+	At       *time.Time      `json:"at,omitempty" example:"2024-01-01T23:59:59Z"`
+	Holdings []model.Holding `json:"holdings"`
+}
+
+// Value godoc
+//
+//	@Summary		Value portfolio
+//	@Description	value basket of fiat and crypto holdings in the reporting currency using a single snapshot of the rates,
+//	@Description	pairs without upstream rate are derived as cross rates. Historical rates are used when `at` is set
+//	@Tags			portfolio
+//	@Accept			json
+//	@Produce		json
+//	@Param			portfolio	body		valueRequest	true	"Reporting currency and holdings"
+//	@Success		200			{object}	model.Valuation
+//	@Failure		400			{string}	string	"no holdings to value"
+//	@Failure		404			{string}	string	"unknown symbol: XYZ"
+//	@Failure		422			{string}	string	"unsupported pair: CNY/EUR"
+//	@Failure		503			{string}	string	"historical rates are unavailable"
+//	@Router			/portfolio/value [post]
+func (p *Portfolio) Value(ctx *fiber.Ctx) error {
+	req := valueRequest{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	var at time.Time
+	if req.At != nil {
+		at = *req.At
+	}
+
+	result, err := p.valuer.Value(ctx.UserContext(), req.Currency, req.Holdings, at)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return fiber.NewError(http.StatusNotFound, "no rates recorded at "+at.Format(time.RFC3339))
+
+	case errors.Is(err, valuation.ErrHistoryUnavailable):
+		log.Error().Err(err).Msg("unable to load historical rates")
+		return fiber.NewError(http.StatusServiceUnavailable, valuation.ErrHistoryUnavailable.Error())
+
+	case err != nil:
+		return controller.RateError(err)
+	}
+
+	if err := ctx.JSON(result); err != nil {
+		log.Error().Err(err).Msg("error occurred during result write op")
+		return err
+	}
+
+	return nil
+}
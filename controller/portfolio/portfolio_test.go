@@ -0,0 +1,138 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service/valuation"
+)
+
+func TestValue(t *testing.T) {
+	takenAt := time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC)
+	history := fake.NewHistoryStorage(model.RateSnapshot{
+		Rates:     model.Rates{"BTC": {"USD": 40000}},
+		Timestamp: takenAt,
+	})
+
+	app := fiber.New()
+	app.Post("/portfolio/value", New(valuation.New(fake.NewCache(map[string]float64{"BTC/USD": 60000, "BTC/EUR": 50000, "GBP/CHF": 1.1}), history)).Value)
+
+	tests := []struct {
+		name      string
+		body      string
+		status    int
+		valuation model.Valuation
+		error     string
+	}{
+		{
+			name:   "current rates",
+			body:   `{"currency": "USD", "holdings": [{"symbol": "BTC", "amount": 0.5}, {"symbol": "EUR", "amount": 100}]}`,
+			status: http.StatusOK,
+			valuation: model.Valuation{Currency: "USD", Total: 30120, Lines: []model.ValuationLine{
+				{Symbol: "BTC", Amount: 0.5, Rate: 60000, Value: 30000},
+				{Symbol: "EUR", Amount: 100, Rate: 1.2, Value: 120},
+			}},
+		},
+		{
+			name:   "historical rates",
+			body:   `{"currency": "USD", "at": "2024-01-02T00:00:00Z", "holdings": [{"symbol": "BTC", "amount": 1}]}`,
+			status: http.StatusOK,
+			valuation: model.Valuation{Currency: "USD", Total: 40000, RateTime: takenAt, Lines: []model.ValuationLine{
+				{Symbol: "BTC", Amount: 1, Rate: 40000, Value: 40000},
+			}},
+		},
+		{
+			name:   "no history",
+			body:   `{"currency": "USD", "at": "2023-01-01T00:00:00Z", "holdings": [{"symbol": "BTC", "amount": 1}]}`,
+			status: http.StatusNotFound,
+			error:  "no rates recorded at 2023-01-01T00:00:00Z",
+		},
+		{name: "unknown symbol", body: `{"currency": "USD", "holdings": [{"symbol": "XXX", "amount": 1}]}`, status: http.StatusNotFound, error: "unknown symbol: XXX"},
+		{name: "unknown reporting currency", body: `{"currency": "XXX", "holdings": [{"symbol": "BTC", "amount": 1}]}`, status: http.StatusNotFound, error: "unknown symbol: XXX"},
+		{name: "unsupported pair", body: `{"currency": "USD", "holdings": [{"symbol": "GBP", "amount": 1}]}`, status: http.StatusUnprocessableEntity, error: "unsupported pair: GBP/USD"},
+		{name: "empty basket", body: `{"currency": "USD", "holdings": []}`, status: http.StatusBadRequest, error: valuation.ErrEmptyBasket.Error()},
+		{name: "no reporting currency", body: `{"holdings": [{"symbol": "BTC", "amount": 1}]}`, status: http.StatusBadRequest, error: valuation.ErrNoCurrency.Error()},
+		{name: "malformed body", body: `{"currency": `, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/portfolio/value", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, resp.StatusCode, body)
+			}
+
+			if tt.status != http.StatusOK {
+				if tt.error != "" && string(body) != tt.error {
+					t.Errorf("expected body %q, got %q", tt.error, body)
+				}
+				return
+			}
+
+			result := model.Valuation{}
+			if err := json.Unmarshal(body, &result); err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Currency != tt.valuation.Currency || result.Total != tt.valuation.Total || !result.RateTime.Equal(tt.valuation.RateTime) {
+				t.Errorf("expected %+v, got %+v", tt.valuation, result)
+			}
+
+			if len(result.Lines) != len(tt.valuation.Lines) {
+				t.Fatalf("expected lines %+v, got %+v", tt.valuation.Lines, result.Lines)
+			}
+
+			for i, line := range tt.valuation.Lines {
+				got := result.Lines[i]
+				if got.Symbol != line.Symbol || got.Amount != line.Amount || math.Abs(got.Rate-line.Rate) > 1e-9 || got.Value != line.Value {
+					t.Errorf("line %d: expected %+v, got %+v", i, line, got)
+				}
+			}
+		})
+	}
+}
+
+func TestValueHistoryUnavailable(t *testing.T) {
+	history := fake.NewHistoryStorage()
+	history.SetErr(errors.New("db is down"))
+
+	app := fiber.New()
+	app.Post("/portfolio/value", New(valuation.New(fake.NewCache(nil), history)).Value)
+
+	req := httptest.NewRequest(http.MethodPost, "/portfolio/value",
+		strings.NewReader(`{"currency": "USD", "at": "2024-01-01T00:00:00Z", "holdings": [{"symbol": "BTC", "amount": 1}]}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,196 @@
+package quote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/kylycht/exchange/controller"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultTTL       = time.Second * 30 // default time quote stays valid
+	defaultTolerance = 0.01             // default max relative rate deviation on accept
+)
+
+func New(pricer service.Pricer, cache storage.Cache, quotes storage.QuoteStorage, ttl time.Duration, tolerance float64) *Quoter {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	if tolerance <= 0 {
+		tolerance = defaultTolerance
+	}
+
+	return &Quoter{
+		pricer:    pricer,
+		cache:     cache,
+		quotes:    quotes,
+		ttl:       ttl,
+		tolerance: tolerance,
+		now:       time.Now,
+	}
+}
+
+type Quoter struct {
+	pricer    service.Pricer       // pricing of the quoted conversions
+	cache     storage.Cache        // cache provider for rates
+	quotes    storage.QuoteStorage // persistence provider for quotes
+	ttl       time.Duration        // time quote stays valid
+	tolerance float64              // max relative rate deviation on accept
+	now       func() time.Time     // clock
+}
+
+type createRequest struct {
+	From   string  `json:"from" example:"BTC"`
+	To     string  `json:"to" example:"USD"`
+	Amount float64 `json:"amount" example:"1.5"`
+}
+
+// Create godoc
+//
+//	@Summary		Lock conversion rate
+//	@Description	price conversion of the amount at current rate, spread and fees included, quote can be accepted until it expires
+//	@Tags			quotes
+//	@Accept			json
+//	@Produce		json
+//	@Param			quote	body		createRequest	true	"Pair and amount"
+//	@Success		201		{object}	model.Quote
+//	@Failure		400		{string}	string	"amount must be positive"
+//	@Failure		404		{string}	string	"unknown symbol: XYZ"
+//	@Failure		422		{string}	string	"unsupported pair: CNY/EUR"
+//	@Failure		503		{string}	string	"exchange provider is down"
+//	@Router			/quotes [post]
+func (q *Quoter) Create(ctx *fiber.Ctx) error {
+	req := createRequest{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	if req.From == "" || req.To == "" {
+		return fiber.NewError(http.StatusBadRequest, "from and to are required")
+	}
+
+	if req.Amount <= 0 || math.IsInf(req.Amount, 0) || math.IsNaN(req.Amount) {
+		return fiber.NewError(http.StatusBadRequest, "amount must be positive")
+	}
+
+	conversion, err := q.pricer.Convert(ctx.UserContext(), req.From, req.To, req.Amount)
+	if err != nil {
+		return controller.RateError(err)
+	}
+
+	now := q.now().UTC()
+	quote := model.Quote{
+		ID:        uuid.NewString(),
+		From:      conversion.From,
+		To:        conversion.To,
+		Amount:    conversion.Amount,
+		MidRate:   conversion.MidRate,
+		Rate:      conversion.Rate,
+		Gross:     conversion.Gross,
+		Fee:       conversion.Fee,
+		Net:       conversion.Net,
+		Status:    model.QuotePending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(q.ttl),
+	}
+
+	if err := q.quotes.CreateQuote(ctx.UserContext(), quote); err != nil {
+		log.Error().Err(err).Msg("unable to store quote")
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(quote)
+}
+
+// Accept godoc
+//
+//	@Summary		Accept locked quote
+//	@Description	execute quote at the locked rate unless it expired or market moved past tolerance
+//	@Tags			quotes
+//	@Produce		json
+//	@Param			id	path		string	true	"Quote ID"
+//	@Success		200	{object}	model.Quote
+//	@Failure		404	{string}	string	"not found"
+//	@Failure		409	{string}	string	"market moved past tolerance"
+//	@Failure		410	{string}	string	"quote expired"
+//	@Failure		503	{string}	string	"exchange provider is down"
+//	@Router			/quotes/{id}/accept [post]
+func (q *Quoter) Accept(ctx *fiber.Ctx) error {
+	// quotes are identified by UUID, anything else is never stored
+	if _, err := uuid.Parse(ctx.Params("id")); err != nil {
+		return fiber.NewError(http.StatusNotFound, storage.ErrNotFound.Error())
+	}
+
+	quote, err := q.quotes.GetQuote(ctx.UserContext(), ctx.Params("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load quote")
+		return err
+	}
+
+	if quote.Status != model.QuotePending {
+		return fiber.NewError(http.StatusConflict, fmt.Sprintf("quote is %s", strings.ToLower(string(quote.Status))))
+	}
+
+	// quote stays pending while the rate can't be checked
+	quote, reason, err := q.settle(ctx.UserContext(), quote)
+	if err != nil {
+		return controller.RateError(err)
+	}
+
+	if err := q.quotes.SettleQuote(ctx.UserContext(), quote); err != nil {
+		if errors.Is(err, storage.ErrQuoteNotPending) {
+			return fiber.NewError(http.StatusConflict, err.Error())
+		}
+
+		log.Error().Err(err).Msg("unable to settle quote")
+		return err
+	}
+
+	switch quote.Status {
+	case model.QuoteExpired:
+		return fiber.NewError(http.StatusGone, reason)
+	case model.QuoteRejected:
+		return fiber.NewError(http.StatusConflict, reason)
+	}
+
+	return ctx.JSON(quote)
+}
+
+// settle decides on the outcome of accepting pending quote,
+// returns quote in its final status and reason of the failure,
+// error is returned if current rate could not be obtained
+func (q *Quoter) settle(ctx context.Context, quote model.Quote) (model.Quote, string, error) {
+	if q.now().After(quote.ExpiresAt) {
+		quote.Status = model.QuoteExpired
+		return quote, "quote expired", nil
+	}
+
+	rateInfo, err := q.cache.Get(ctx, storage.Pair{From: quote.From, To: quote.To})
+	if err != nil {
+		return quote, "", err
+	}
+
+	deviation := math.Abs(rateInfo.Rate-quote.MidRate) / quote.MidRate
+	if deviation > q.tolerance {
+		quote.Status = model.QuoteRejected
+		return quote, fmt.Sprintf("market moved past tolerance: %.4f%%", deviation*100), nil
+	}
+
+	quote.Status = model.QuoteAccepted
+	return quote, "", nil
+}
@@ -0,0 +1,255 @@
+package quote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service/pricing"
+	"github.com/kylycht/exchange/storage"
+)
+
+type testEnv struct {
+	app    *fiber.App
+	cache  *fake.Cache
+	quotes *fake.QuoteStorage
+	now    time.Time
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		app:    fiber.New(),
+		cache:  fake.NewCache(map[string]float64{"BTC/USD": 60000}),
+		quotes: fake.NewQuoteStorage(),
+		now:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	pricer, err := pricing.New(env.cache, fake.NewPricingStorage(model.PricingRule{Spread: 0.002, FixedFee: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pricer.Close)
+
+	q := New(pricer, env.cache, env.quotes, time.Minute, 0.01)
+	q.now = func() time.Time { return env.now }
+
+	env.app.Post("/quotes", q.Create)
+	env.app.Post("/quotes/:id/accept", q.Accept)
+
+	return env
+}
+
+func (env *testEnv) do(t *testing.T, path, body string) (int, []byte) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	resp, err := env.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, data
+}
+
+func (env *testEnv) create(t *testing.T) model.Quote {
+	t.Helper()
+
+	status, body := env.do(t, "/quotes", `{"from":"btc","to":"usd","amount":1.5}`)
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, status, body)
+	}
+
+	quote := model.Quote{}
+	if err := json.Unmarshal(body, &quote); err != nil {
+		t.Fatal(err)
+	}
+
+	return quote
+}
+
+func TestCreate(t *testing.T) {
+	env := newTestEnv(t)
+	quote := env.create(t)
+
+	if quote.ID == "" || quote.From != "BTC" || quote.To != "USD" {
+		t.Errorf("unexpected quote: %+v", quote)
+	}
+
+	// priced as by the converter
+	if quote.MidRate != 60000 || quote.Rate != 59940 || quote.Gross != 89910 || quote.Fee != 1 || quote.Net != 89909 || quote.Status != model.QuotePending {
+		t.Errorf("unexpected quote: %+v", quote)
+	}
+
+	if !quote.ExpiresAt.Equal(env.now.Add(time.Minute)) {
+		t.Errorf("expected expiry %s, got %s", env.now.Add(time.Minute), quote.ExpiresAt)
+	}
+
+	if _, err := env.quotes.GetQuote(context.Background(), quote.ID); err != nil {
+		t.Errorf("expected quote to be persisted: %s", err)
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", `{"from":`},
+		{"zero amount", `{"from":"BTC","to":"USD","amount":0}`},
+		{"negative amount", `{"from":"BTC","to":"USD","amount":-1}`},
+		{"missing pair", `{"amount":1}`},
+		{"amount below fee", `{"from":"BTC","to":"USD","amount":0.00001}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := env.do(t, "/quotes", tt.body); status != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, status, body)
+			}
+		})
+	}
+}
+
+func TestCreateUnavailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{"unsupported pair", `{"from":"CNY","to":"EUR","amount":1}`, nil, http.StatusUnprocessableEntity},
+		{"unknown symbol", `{"from":"XYZ","to":"USD","amount":1}`, fmt.Errorf("%w: XYZ", storage.ErrUnknownSymbol), http.StatusNotFound},
+		{"stale", `{"from":"BTC","to":"USD","amount":1}`, storage.ErrStale, http.StatusServiceUnavailable},
+		{"provider down", `{"from":"BTC","to":"USD","amount":1}`, storage.ErrProviderDown, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.cache.SetErr(tt.err)
+
+			if status, body := env.do(t, "/quotes", tt.body); status != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, status, body)
+			}
+		})
+	}
+}
+
+func TestAccept(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		rate    float64
+		status  int
+		settled model.Quote
+	}{
+		{"within tolerance", 30 * time.Second, 60500, http.StatusOK, model.Quote{Status: model.QuoteAccepted}},
+		{"expired", 2 * time.Minute, 60000, http.StatusGone, model.Quote{Status: model.QuoteExpired}},
+		{"market moved up", 30 * time.Second, 61000, http.StatusConflict, model.Quote{Status: model.QuoteRejected}},
+		{"market moved down", 30 * time.Second, 59000, http.StatusConflict, model.Quote{Status: model.QuoteRejected}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			quote := env.create(t)
+
+			env.now = env.now.Add(tt.elapsed)
+			env.cache.SetRate("BTC", "USD", tt.rate)
+
+			status, body := env.do(t, "/quotes/"+quote.ID+"/accept", "")
+			if status != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, status, body)
+			}
+
+			stored, err := env.quotes.GetQuote(context.Background(), quote.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.Status != tt.settled.Status {
+				t.Errorf("expected status %s, got %s", tt.settled.Status, stored.Status)
+			}
+
+			if status != http.StatusOK {
+				return
+			}
+
+			accepted := model.Quote{}
+			if err := json.Unmarshal(body, &accepted); err != nil {
+				t.Fatal(err)
+			}
+
+			// executed at the locked rate
+			if accepted.MidRate != 60000 || accepted.Net != 89909 {
+				t.Errorf("expected locked rate, got %+v", accepted)
+			}
+		})
+	}
+}
+
+func TestAcceptUnavailable(t *testing.T) {
+	for _, err := range []error{storage.ErrStale, storage.ErrProviderDown} {
+		t.Run(err.Error(), func(t *testing.T) {
+			env := newTestEnv(t)
+			quote := env.create(t)
+
+			env.cache.SetErr(err)
+
+			if status, body := env.do(t, "/quotes/"+quote.ID+"/accept", ""); status != http.StatusServiceUnavailable {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusServiceUnavailable, status, body)
+			}
+
+			// quote can be accepted once the rate recovers
+			env.cache.SetErr(nil)
+
+			if status, body := env.do(t, "/quotes/"+quote.ID+"/accept", ""); status != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, status, body)
+			}
+		})
+	}
+}
+
+func TestAcceptTwice(t *testing.T) {
+	env := newTestEnv(t)
+	quote := env.create(t)
+
+	if status, body := env.do(t, "/quotes/"+quote.ID+"/accept", ""); status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, status, body)
+	}
+
+	if status, body := env.do(t, "/quotes/"+quote.ID+"/accept", ""); status != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusConflict, status, body)
+	}
+}
+
+func TestAcceptUnknown(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, id := range []string{"abc", "8c0e6b52-7a7f-4c56-9f5e-2d3c1b0a9e41"} {
+		if status, body := env.do(t, "/quotes/"+id+"/accept", ""); status != http.StatusNotFound {
+			t.Fatalf("%s: expected status %d, got %d: %s", id, http.StatusNotFound, status, body)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package refresh
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/service"
+)
+
+func New(scheduler service.Scheduler) *Refresh {
+	return &Refresh{scheduler: scheduler}
+}
+
+type Refresh struct {
+	scheduler service.Scheduler // refresh schedule of the individual pairs
+}
+
+// Stats godoc
+//
+//	@Summary		Get demand and refresh schedule of the pairs
+//	@Description	requests of every pair within the sliding window and the lane it is refreshed in,
+//	@Description	hot pairs are refreshed at their interval, cold ones in the slow lane
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	model.RefreshStats
+//	@Failure		401	{string}	string	"Missing or malformed API Key"
+//	@Security		AdminToken
+//	@Router			/admin/refresh [get]
+func (r *Refresh) Stats(ctx *fiber.Ctx) error {
+	return ctx.JSON(r.scheduler.Stats(time.Now()))
+}
@@ -0,0 +1,50 @@
+package refresh
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/service/schedule"
+)
+
+func TestStats(t *testing.T) {
+	scheduler := schedule.New(schedule.WithColdInterval(time.Minute * 15))
+
+	pairs := service.Pairs([]model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+	})
+
+	now := time.Now()
+	scheduler.Update(pairs, now)
+	scheduler.Requested("BTC", "USD", now)
+	scheduler.Refreshed(pairs, nil, now)
+
+	app := fiber.New()
+	app.Get("/admin/refresh", New(scheduler).Stats)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/refresh", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var stats model.RefreshStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Hot != 1 || stats.Cold != 0 || len(stats.Pairs) != 1 || stats.Pairs[0].Pair != "BTC/USD" || stats.Pairs[0].Requests != 1 || stats.Pairs[0].Lane != schedule.LaneHot {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
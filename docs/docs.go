@@ -15,9 +15,129 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/refresh": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "requests of every pair within the sliding window and the lane it is refreshed in,\nhot pairs are refreshed at their interval, cold ones in the slow lane",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get demand and refresh schedule of the pairs",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.RefreshStats"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or malformed API Key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/conversions": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "query conversion ledger by date range and client, optionally exported as CSV",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "conversions"
+                ],
+                "summary": "List served conversions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "2024-01-01T00:00:00Z",
+                        "description": "Served at or after, RFC3339",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "2024-02-01T00:00:00Z",
+                        "description": "Served before, RFC3339",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client identifier",
+                        "name": "client",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "example": 100,
+                        "description": "Max number of records",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Response format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.ConversionRecord"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid since: 2024-01-01",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or malformed API Key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/convert": {
             "get": {
-                "description": "convert fiat to crypto or vise versa",
+                "description": "convert fiat to crypto or vise versa, spread and fees are applied on top of the mid rate.\nWith target_amount computes amount of from currency required to receive target_amount after fees",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "converter"
                 ],
@@ -40,29 +160,694 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "number",
-                        "example": 3.1,
-                        "description": "From Currency",
+                        "type": "string",
+                        "example": "3.1",
+                        "description": "From Currency, in the conventions of Accept-Language, e.g. 1.234,56",
                         "name": "amount",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "250",
+                        "description": "To Currency to receive, exclusive with amount",
+                        "name": "target_amount",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "raw",
+                            "display"
+                        ],
+                        "type": "string",
+                        "description": "raw(default) numbers or display strings localized by Accept-Language",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Record conversion in the ledger",
+                        "name": "record",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client identifier stored in the ledger",
+                        "name": "X-Client-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Locale of amounts, e.g. de-DE",
+                        "name": "Accept-Language",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "3.4",
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_kylycht_exchange_model.Conversion"
+                        }
+                    },
+                    "400": {
+                        "description": "amount must be positive",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "unknown symbol: XYZ",
                         "schema": {
                             "type": "string"
                         }
                     },
+                    "422": {
+                        "description": "unsupported pair: CNY/EUR",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "exchange provider is down",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/portfolio/value": {
+            "post": {
+                "description": "value basket of fiat and crypto holdings in the reporting currency using a single snapshot of the rates,\npairs without upstream rate are derived as cross rates. Historical rates are used when ` + "`" + `at` + "`" + ` is set",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "portfolio"
+                ],
+                "summary": "Value portfolio",
+                "parameters": [
+                    {
+                        "description": "Reporting currency and holdings",
+                        "name": "portfolio",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/portfolio.valueRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Valuation"
+                        }
+                    },
                     "400": {
-                        "description": "invalid conversion for pair: CNY/EUR",
+                        "description": "no holdings to value",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "unknown symbol: XYZ",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "unsupported pair: CNY/EUR",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "historical rates are unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/quotes": {
+            "post": {
+                "description": "price conversion of the amount at current rate, spread and fees included, quote can be accepted until it expires",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "quotes"
+                ],
+                "summary": "Lock conversion rate",
+                "parameters": [
+                    {
+                        "description": "Pair and amount",
+                        "name": "quote",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/quote.createRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/model.Quote"
+                        }
+                    },
+                    "400": {
+                        "description": "amount must be positive",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "unknown symbol: XYZ",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "unsupported pair: CNY/EUR",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "exchange provider is down",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/quotes/{id}/accept": {
+            "post": {
+                "description": "execute quote at the locked rate unless it expired or market moved past tolerance",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "quotes"
+                ],
+                "summary": "Accept locked quote",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Quote ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Quote"
+                        }
+                    },
+                    "404": {
+                        "description": "not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "market moved past tolerance",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "410": {
+                        "description": "quote expired",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "exchange provider is down",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rates/anomalies": {
+            "get": {
+                "description": "pairs whose latest rates were rejected by validation, the last good rate is served\ninstead until the pair recovers or the new rate level is confirmed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rates"
+                ],
+                "summary": "List quarantined rates",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Anomaly"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/rates/divergence": {
+            "get": {
+                "description": "divergence of every pair obtained in both directions, e.g. BTC/USD and USD/BTC, measured by the\nlatest refresh before reconciliation policy is applied. Divergence is the value gained by a round trip",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rates"
+                ],
+                "summary": "Get divergence of the opposite pairs",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Reconciliation"
+                        }
                     }
                 }
             }
         }
+    },
+    "definitions": {
+        "github_com_kylycht_exchange_model.Conversion": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount of from currency",
+                    "type": "number"
+                },
+                "fee": {
+                    "description": "Fee in to currency",
+                    "type": "number"
+                },
+                "from": {
+                    "description": "From currency symbol",
+                    "type": "string"
+                },
+                "gross": {
+                    "description": "Amount of to currency before fees",
+                    "type": "number"
+                },
+                "mid_rate": {
+                    "description": "Mid market rate",
+                    "type": "number"
+                },
+                "net": {
+                    "description": "Amount of to currency after fees",
+                    "type": "number"
+                },
+                "rate": {
+                    "description": "Rate applied after the spread",
+                    "type": "number"
+                },
+                "rate_time": {
+                    "description": "Time the mid rate was obtained",
+                    "type": "string"
+                },
+                "stale": {
+                    "description": "Mid rate is served from the snapshot saved before restart",
+                    "type": "boolean"
+                },
+                "to": {
+                    "description": "To currency symbol",
+                    "type": "string"
+                }
+            }
+        },
+        "model.Anomaly": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "description": "Number of consecutive rejections",
+                    "type": "integer"
+                },
+                "last_good": {
+                    "description": "Rate served instead, zero if there is none",
+                    "type": "number"
+                },
+                "pair": {
+                    "description": "Pair as BASE/TARGET",
+                    "type": "string"
+                },
+                "rate": {
+                    "description": "Latest rejected rate",
+                    "type": "number"
+                },
+                "reason": {
+                    "description": "Reason of the latest rejection",
+                    "type": "string"
+                },
+                "since": {
+                    "description": "Time of the first consecutive rejection",
+                    "type": "string"
+                }
+            }
+        },
+        "model.ConversionRecord": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount of from currency",
+                    "type": "number"
+                },
+                "client": {
+                    "description": "Client requested the conversion",
+                    "type": "string"
+                },
+                "created_at": {
+                    "description": "Time the conversion was served",
+                    "type": "string"
+                },
+                "from": {
+                    "description": "From currency symbol",
+                    "type": "string"
+                },
+                "rate": {
+                    "description": "Rate applied to the conversion",
+                    "type": "number"
+                },
+                "rate_time": {
+                    "description": "Time the rate was obtained",
+                    "type": "string"
+                },
+                "request_id": {
+                    "description": "ID of the request conversion was served for",
+                    "type": "string"
+                },
+                "result": {
+                    "description": "Amount of to currency served",
+                    "type": "number"
+                },
+                "to": {
+                    "description": "To currency symbol",
+                    "type": "string"
+                }
+            }
+        },
+        "model.Divergence": {
+            "type": "object",
+            "properties": {
+                "divergence": {
+                    "description": "Value gained (or lost if negative) by a round trip, rate * inverse - 1",
+                    "type": "number"
+                },
+                "inverse": {
+                    "description": "Rate of the opposite pair, e.g. USD/BTC",
+                    "type": "number"
+                },
+                "pair": {
+                    "description": "Pair priced in fiat as BASE/TARGET, e.g. BTC/USD",
+                    "type": "string"
+                },
+                "rate": {
+                    "description": "Rate of the pair, e.g. BTC/USD",
+                    "type": "number"
+                }
+            }
+        },
+        "model.Holding": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount of the currency",
+                    "type": "number",
+                    "example": 1.5
+                },
+                "symbol": {
+                    "description": "Currency symbol",
+                    "type": "string",
+                    "example": "BTC"
+                }
+            }
+        },
+        "model.PairStats": {
+            "type": "object",
+            "properties": {
+                "due": {
+                    "description": "Time of the next refresh",
+                    "type": "string"
+                },
+                "interval_seconds": {
+                    "description": "Refresh interval within the lane",
+                    "type": "number"
+                },
+                "lane": {
+                    "description": "Lane the pair is refreshed in, hot or cold",
+                    "type": "string"
+                },
+                "last_requested": {
+                    "description": "Time of the latest request, zero if never requested",
+                    "type": "string"
+                },
+                "pair": {
+                    "description": "Pair as BASE/TARGET",
+                    "type": "string"
+                },
+                "refreshed": {
+                    "description": "Time of the latest refresh",
+                    "type": "string"
+                },
+                "requests": {
+                    "description": "Requests within the window",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.Quote": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount of from currency",
+                    "type": "number"
+                },
+                "created_at": {
+                    "description": "Time quote was created",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "Time after which quote can not be accepted",
+                    "type": "string"
+                },
+                "fee": {
+                    "description": "Fee in to currency",
+                    "type": "number"
+                },
+                "from": {
+                    "description": "From currency symbol",
+                    "type": "string"
+                },
+                "gross": {
+                    "description": "Amount of to currency before fees",
+                    "type": "number"
+                },
+                "id": {
+                    "description": "ID of the quote",
+                    "type": "string"
+                },
+                "mid_rate": {
+                    "description": "Mid market rate the quote was priced at",
+                    "type": "number"
+                },
+                "net": {
+                    "description": "Amount of to currency after fees",
+                    "type": "number"
+                },
+                "rate": {
+                    "description": "Locked rate applied after the spread",
+                    "type": "number"
+                },
+                "status": {
+                    "description": "Status of the quote",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.quoteStatus"
+                        }
+                    ]
+                },
+                "to": {
+                    "description": "To currency symbol",
+                    "type": "string"
+                }
+            }
+        },
+        "model.Reconciliation": {
+            "type": "object",
+            "properties": {
+                "max_abs": {
+                    "description": "Max absolute divergence",
+                    "type": "number"
+                },
+                "pairs": {
+                    "description": "Pairs obtained in both directions",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Divergence"
+                    }
+                },
+                "policy": {
+                    "description": "Policy applied to the rates",
+                    "type": "string"
+                },
+                "reconciled_at": {
+                    "description": "Time of the reconciliation",
+                    "type": "string"
+                }
+            }
+        },
+        "model.RefreshStats": {
+            "type": "object",
+            "properties": {
+                "cold": {
+                    "description": "Pairs in the slow lane",
+                    "type": "integer"
+                },
+                "hot": {
+                    "description": "Pairs in the hot lane",
+                    "type": "integer"
+                },
+                "pairs": {
+                    "description": "Pairs by requests, the most requested first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.PairStats"
+                    }
+                },
+                "window_seconds": {
+                    "description": "Sliding window requests are counted in",
+                    "type": "number"
+                }
+            }
+        },
+        "model.Valuation": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "description": "Reporting currency symbol",
+                    "type": "string"
+                },
+                "lines": {
+                    "description": "Breakdown per holding",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ValuationLine"
+                    }
+                },
+                "rate_time": {
+                    "description": "Time the rates were obtained",
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Total value in the reporting currency",
+                    "type": "number"
+                }
+            }
+        },
+        "model.ValuationLine": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount of the currency",
+                    "type": "number"
+                },
+                "rate": {
+                    "description": "Rate to the reporting currency",
+                    "type": "number"
+                },
+                "symbol": {
+                    "description": "Currency symbol",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Value in the reporting currency",
+                    "type": "number"
+                }
+            }
+        },
+        "model.quoteStatus": {
+            "type": "string",
+            "enum": [
+                "PENDING",
+                "ACCEPTED",
+                "EXPIRED",
+                "REJECTED"
+            ],
+            "x-enum-comments": {
+                "QuoteAccepted": "QuoteAccepted quote was executed at the locked rate",
+                "QuoteExpired": "QuoteExpired quote was accepted after its expiry",
+                "QuotePending": "QuotePending quote awaits acceptance",
+                "QuoteRejected": "QuoteRejected market moved past tolerance"
+            },
+            "x-enum-varnames": [
+                "QuotePending",
+                "QuoteAccepted",
+                "QuoteExpired",
+                "QuoteRejected"
+            ]
+        },
+        "portfolio.valueRequest": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string",
+                    "example": "2024-01-01T23:59:59Z"
+                },
+                "currency": {
+                    "type": "string",
+                    "example": "USD"
+                },
+                "holdings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Holding"
+                    }
+                }
+            }
+        },
+        "quote.createRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "example": 1.5
+                },
+                "from": {
+                    "type": "string",
+                    "example": "BTC"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "USD"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
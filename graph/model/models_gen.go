@@ -0,0 +1,93 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type Conversion struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+	Rate   float64 `json:"rate"`
+	Result float64 `json:"result"`
+}
+
+type Currency struct {
+	Name          string       `json:"name"`
+	Symbol        string       `json:"symbol"`
+	Type          CurrencyType `json:"type"`
+	Available     bool         `json:"available"`
+	NumericCode   *int         `json:"numericCode,omitempty"`
+	Decimals      int          `json:"decimals"`
+	DisplaySymbol string       `json:"displaySymbol"`
+	Aliases       []string     `json:"aliases"`
+	Chains        []string     `json:"chains"`
+}
+
+type PairInput struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Query struct {
+}
+
+type Rate struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Rate float64 `json:"rate"`
+}
+
+type Subscription struct {
+}
+
+type CurrencyType string
+
+const (
+	CurrencyTypeFiat       CurrencyType = "FIAT"
+	CurrencyTypeCrypto     CurrencyType = "CRYPTO"
+	CurrencyTypeMetal      CurrencyType = "METAL"
+	CurrencyTypeStablecoin CurrencyType = "STABLECOIN"
+	CurrencyTypeCommodity  CurrencyType = "COMMODITY"
+)
+
+var AllCurrencyType = []CurrencyType{
+	CurrencyTypeFiat,
+	CurrencyTypeCrypto,
+	CurrencyTypeMetal,
+	CurrencyTypeStablecoin,
+	CurrencyTypeCommodity,
+}
+
+func (e CurrencyType) IsValid() bool {
+	switch e {
+	case CurrencyTypeFiat, CurrencyTypeCrypto, CurrencyTypeMetal, CurrencyTypeStablecoin, CurrencyTypeCommodity:
+		return true
+	}
+	return false
+}
+
+func (e CurrencyType) String() string {
+	return string(e)
+}
+
+func (e *CurrencyType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CurrencyType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CurrencyType", str)
+	}
+	return nil
+}
+
+func (e CurrencyType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,50 @@
+package graph
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+import (
+	"github.com/kylycht/exchange/graph/model"
+	exchange "github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+const (
+	maxPairs = 100 // max number of pairs requested at once
+)
+
+// Resolver is the root resolver of the graph,
+// it serves all requests from the cache and
+// the persistence storage
+type Resolver struct {
+	Cache   storage.Cache   // cache provider for rates
+	Storage storage.Storage // persistence provider for currencies
+}
+
+// newRate maps cached exchange rate to the graph model
+func newRate(er exchange.ExchangeRate) *model.Rate {
+	return &model.Rate{
+		From: er.Base.Symbol,
+		To:   er.Target.Symbol,
+		Rate: er.Rate,
+	}
+}
+
+// newCurrency maps persisted currency to the graph model
+func newCurrency(c exchange.Currency) *model.Currency {
+	currency := &model.Currency{
+		Name:          c.Name,
+		Symbol:        c.Symbol,
+		Type:          model.CurrencyType(c.CurrencyType),
+		Available:     c.IsAvailable,
+		Decimals:      c.Decimals,
+		DisplaySymbol: c.DisplaySymbol,
+		Aliases:       append([]string{}, c.Aliases...),
+		Chains:        append([]string{}, c.Chains...),
+	}
+
+	if c.NumericCode != 0 {
+		currency.NumericCode = &c.NumericCode
+	}
+
+	return currency
+}
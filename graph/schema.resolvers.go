@@ -0,0 +1,144 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.49
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kylycht/exchange/graph/model"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Currencies is the resolver for the currencies field.
+func (r *queryResolver) Currencies(ctx context.Context, typeArg *model.CurrencyType, available *bool) ([]*model.Currency, error) {
+	currencies, err := r.Storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Currency, 0, len(currencies))
+
+	for _, c := range currencies {
+		currency := newCurrency(c)
+
+		if typeArg != nil && currency.Type != *typeArg {
+			continue
+		}
+
+		if available != nil && currency.Available != *available {
+			continue
+		}
+
+		result = append(result, currency)
+	}
+
+	return result, nil
+}
+
+// Rate is the resolver for the rate field.
+func (r *queryResolver) Rate(ctx context.Context, from string, to string) (*model.Rate, error) {
+	rateInfo, err := r.Cache.Get(ctx, storage.Pair{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	return newRate(rateInfo), nil
+}
+
+// Rates is the resolver for the rates field.
+func (r *queryResolver) Rates(ctx context.Context, pairs []*model.PairInput) ([]*model.Rate, error) {
+	if len(pairs) > maxPairs {
+		return nil, fmt.Errorf("at most %d pairs may be requested", maxPairs)
+	}
+
+	result := make([]*model.Rate, 0, len(pairs))
+
+	for _, pair := range pairs {
+		rateInfo, err := r.Cache.Get(ctx, storage.Pair{From: pair.From, To: pair.To})
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, newRate(rateInfo))
+	}
+
+	return result, nil
+}
+
+// Convert is the resolver for the convert field.
+func (r *queryResolver) Convert(ctx context.Context, from string, to string, amount float64) (*model.Conversion, error) {
+	rateInfo, err := r.Cache.Get(ctx, storage.Pair{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Conversion{
+		From:   rateInfo.Base.Symbol,
+		To:     rateInfo.Target.Symbol,
+		Amount: amount,
+		Rate:   rateInfo.Rate,
+		Result: amount * rateInfo.Rate,
+	}, nil
+}
+
+// RateUpdated is the resolver for the rateUpdated field.
+func (r *subscriptionResolver) RateUpdated(ctx context.Context, from string, to string) (<-chan *model.Rate, error) {
+	rateInfo, err := r.Cache.Get(ctx, storage.Pair{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	updatesC, cancelFn := r.Cache.Subscribe()
+
+	// current rate is delivered right away,
+	// the rest is emitted only when it changes
+	ratesC := make(chan *model.Rate, 1)
+	ratesC <- newRate(rateInfo)
+
+	go func() {
+		defer close(ratesC)
+		defer cancelFn()
+
+		last := rateInfo.Rate
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-updatesC:
+				rateInfo, err := r.Cache.Get(ctx, storage.Pair{From: from, To: to})
+				if err != nil {
+					log.Error().Err(err).Str("from", from).Str("to", to).Msg("unable to fetch updated rate")
+					continue
+				}
+
+				if rateInfo.Rate == last {
+					continue
+				}
+				last = rateInfo.Rate
+
+				select {
+				case ratesC <- newRate(rateInfo):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ratesC, nil
+}
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// Subscription returns SubscriptionResolver implementation.
+func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+
+type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
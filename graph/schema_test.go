@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/kylycht/exchange/internal/fake"
+	exchange "github.com/kylycht/exchange/model"
+)
+
+func newTestResolver() *Resolver {
+	return &Resolver{
+		Cache: fake.NewCache(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000}),
+		Storage: fake.NewStorage(
+			exchange.Currency{Name: "BITCOIN", Symbol: "BTC", CurrencyType: exchange.Crypto, IsAvailable: true, Decimals: 8, DisplaySymbol: "₿", Aliases: []string{"XBT"}},
+			exchange.Currency{Name: "DOLLAR", Symbol: "USD", CurrencyType: exchange.Fiat, IsAvailable: true, NumericCode: 840, Decimals: 2, DisplaySymbol: "$"},
+			exchange.Currency{Name: "EURO", Symbol: "EUR", CurrencyType: exchange.Fiat, IsAvailable: false},
+			exchange.Currency{Name: "GOLD", Symbol: "XAU", CurrencyType: exchange.Metal, IsAvailable: false},
+		),
+	}
+}
+
+func newTestClient(r *Resolver) *client.Client {
+	return client.New(handler.NewDefaultServer(NewExecutableSchema(Config{Resolvers: r})))
+}
+
+func TestCurrencies(t *testing.T) {
+	c := newTestClient(newTestResolver())
+
+	tests := []struct {
+		name    string
+		query   string
+		symbols []string
+	}{
+		{"all", `{ currencies { symbol } }`, []string{"BTC", "USD", "EUR", "XAU"}},
+		{"fiat", `{ currencies(type: FIAT) { symbol } }`, []string{"USD", "EUR"}},
+		{"available fiat", `{ currencies(type: FIAT, available: true) { symbol } }`, []string{"USD"}},
+		{"metal", `{ currencies(type: METAL) { symbol } }`, []string{"XAU"}},
+		{"unavailable", `{ currencies(available: false) { symbol } }`, []string{"EUR", "XAU"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Currencies []struct{ Symbol string }
+			}
+			c.MustPost(tt.query, &resp)
+
+			if len(resp.Currencies) != len(tt.symbols) {
+				t.Fatalf("expected %d currencies, got %d", len(tt.symbols), len(resp.Currencies))
+			}
+
+			for i, symbol := range tt.symbols {
+				if resp.Currencies[i].Symbol != symbol {
+					t.Errorf("expected %s at %d, got %s", symbol, i, resp.Currencies[i].Symbol)
+				}
+			}
+		})
+	}
+}
+
+func TestCurrencyMetadata(t *testing.T) {
+	c := newTestClient(newTestResolver())
+
+	var resp struct {
+		Currencies []struct {
+			Symbol        string
+			NumericCode   *int
+			Decimals      int
+			DisplaySymbol string
+			Aliases       []string
+			Chains        []string
+		}
+	}
+	c.MustPost(`{ currencies(available: true) { symbol numericCode decimals displaySymbol aliases chains } }`, &resp)
+
+	if len(resp.Currencies) != 2 {
+		t.Fatalf("expected 2 currencies, got %+v", resp.Currencies)
+	}
+
+	btc, usd := resp.Currencies[0], resp.Currencies[1]
+
+	if btc.NumericCode != nil || btc.Decimals != 8 || btc.DisplaySymbol != "₿" || len(btc.Aliases) != 1 || btc.Aliases[0] != "XBT" || btc.Chains == nil {
+		t.Errorf("unexpected BTC metadata: %+v", btc)
+	}
+
+	if usd.NumericCode == nil || *usd.NumericCode != 840 || usd.Decimals != 2 || usd.DisplaySymbol != "$" || len(usd.Aliases) != 0 {
+		t.Errorf("unexpected USD metadata: %+v", usd)
+	}
+}
+
+func TestRatesAndConvert(t *testing.T) {
+	c := newTestClient(newTestResolver())
+
+	var resp struct {
+		Rate    struct{ Rate float64 }
+		Rates   []struct{ From, To string }
+		Convert struct{ Result float64 }
+	}
+	c.MustPost(`{
+		rate(from: "BTC", to: "USD") { rate }
+		rates(pairs: [{from: "BTC", to: "USD"}, {from: "USD", to: "BTC"}]) { from to }
+		convert(from: "BTC", to: "USD", amount: 1.5) { result }
+	}`, &resp)
+
+	if resp.Rate.Rate != 60000 {
+		t.Errorf("expected rate 60000, got %f", resp.Rate.Rate)
+	}
+
+	if len(resp.Rates) != 2 || resp.Rates[1].From != "USD" || resp.Rates[1].To != "BTC" {
+		t.Errorf("unexpected rates: %+v", resp.Rates)
+	}
+
+	if resp.Convert.Result != 90000 {
+		t.Errorf("expected result 90000, got %f", resp.Convert.Result)
+	}
+}
+
+func TestRatesTooManyPairs(t *testing.T) {
+	c := newTestClient(newTestResolver())
+
+	pairs := strings.Repeat(`{from: "BTC", to: "USD"},`, maxPairs+1)
+
+	var resp struct{}
+	if err := c.Post(`{ rates(pairs: [`+pairs+`]) { rate } }`, &resp); err == nil {
+		t.Fatal("expected error for too many pairs")
+	}
+}
+
+func TestUnknownPair(t *testing.T) {
+	c := newTestClient(newTestResolver())
+
+	var resp struct{}
+	if err := c.Post(`{ rate(from: "CNY", to: "EUR") { rate } }`, &resp); err == nil {
+		t.Fatal("expected error for unknown pair")
+	}
+}
+
+func TestRateUpdated(t *testing.T) {
+	r := newTestResolver()
+	cache := r.Cache.(*fake.Cache)
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	ratesC, err := r.Subscription().RateUpdated(ctx, "BTC", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectRate := func(expected float64) {
+		t.Helper()
+
+		select {
+		case rate := <-ratesC:
+			if rate.Rate != expected {
+				t.Fatalf("expected rate %f, got %f", expected, rate.Rate)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected rate %f, got nothing", expected)
+		}
+	}
+
+	expectRate(60000)
+
+	// unchanged rate must not be emitted
+	cache.SetRate("BTC", "USD", 60000)
+	cache.SetRate("BTC", "USD", 61000)
+	expectRate(61000)
+
+	cancelFn()
+
+	select {
+	case _, isOpen := <-ratesC:
+		if isOpen {
+			t.Fatal("expected subscription to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not closed after cancellation")
+	}
+}
@@ -0,0 +1,23 @@
+// Package auth guards admin routes by the bearer token
+package auth
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/keyauth"
+)
+
+// Admin requires `Authorization: Bearer <token>` header,
+// every request is rejected while the token is not configured
+func Admin(token string) fiber.Handler {
+	return keyauth.New(keyauth.Config{
+		Validator: func(_ *fiber.Ctx, key string) (bool, error) {
+			if token == "" || subtle.ConstantTimeCompare([]byte(key), []byte(token)) != 1 {
+				return false, keyauth.ErrMissingOrMalformedAPIKey
+			}
+
+			return true, nil
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdmin(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		header   string
+		expected int
+	}{
+		{"valid token", "secret", "Bearer secret", fiber.StatusOK},
+		{"invalid token", "secret", "Bearer guess", fiber.StatusUnauthorized},
+		{"missing header", "secret", "", fiber.StatusUnauthorized},
+		{"token not configured", "", "Bearer ", fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/admin", Admin(tt.token), func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(fiber.MethodGet, "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.header)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,683 @@
+// Package fake provides in-memory implementations of the
+// storage and service interfaces to be reused across tests
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+)
+
+// Storage is in-memory storage.Storage
+type Storage struct {
+	lock       sync.RWMutex     // guards currencies
+	Currencies []model.Currency // Currencies known to the storage
+	Err        error            // Err returned by every call when set
+}
+
+// NewStorage creates storage holding given currencies
+func NewStorage(currencies ...model.Currency) *Storage {
+	return &Storage{Currencies: currencies}
+}
+
+// Load implements storage.Storage.
+func (s *Storage) Load(ctx context.Context) ([]model.Currency, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+
+	var currencies []model.Currency
+
+	now := time.Now()
+
+	for _, c := range s.Currencies {
+		if !c.IsAvailable || !c.ActiveAt(now) {
+			continue
+		}
+
+		currencies = append(currencies, c)
+	}
+
+	return currencies, nil
+}
+
+// List implements storage.Storage.
+func (s *Storage) List(ctx context.Context) ([]model.Currency, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+
+	return append([]model.Currency(nil), s.Currencies...), nil
+}
+
+// AddCurrency implements storage.Storage.
+func (s *Storage) AddCurrency(ctx context.Context, currency model.Currency) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	for _, c := range s.Currencies {
+		if strings.EqualFold(c.Symbol, currency.Symbol) {
+			return storage.ErrAlreadyExists
+		}
+	}
+
+	s.Currencies = append(s.Currencies, currency)
+
+	return nil
+}
+
+// DisableCurrency implements storage.Storage.
+func (s *Storage) DisableCurrency(ctx context.Context, symbol string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	for i, c := range s.Currencies {
+		if strings.EqualFold(c.Symbol, symbol) {
+			s.Currencies[i].IsAvailable = false
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
+
+// Exchange is in-memory service.Exchange,
+// rates are keyed by BASE/TARGET pair
+type Exchange struct {
+	lock  sync.RWMutex       // guards rates and calls
+	Rates map[string]float64 // Rates served by the exchange
+	Err   error              // Err returned by every call when set
+	Calls int                // Calls number of calls made
+}
+
+// NewExchange creates exchange serving given rates
+func NewExchange(rates map[string]float64) *Exchange {
+	if rates == nil {
+		rates = make(map[string]float64)
+	}
+
+	return &Exchange{Rates: rates}
+}
+
+// SetRate updates rate for the pair
+func (e *Exchange) SetRate(base, target string, rate float64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.Rates[base+"/"+target] = rate
+}
+
+// SetErr sets error returned by every call
+func (e *Exchange) SetErr(err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.Err = err
+}
+
+// CallCount returns number of calls made
+func (e *Exchange) CallCount() int {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.Calls
+}
+
+func (e *Exchange) lookup(base, target string) (float64, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.Calls++
+
+	if e.Err != nil {
+		return 0, e.Err
+	}
+
+	rate, ok := e.Rates[base+"/"+target]
+	if !ok {
+		return 0, fmt.Errorf("no rate for pair: %s/%s", base, target)
+	}
+
+	return rate, nil
+}
+
+// GetRate implements service.Exchange.
+func (e *Exchange) GetRate(ctx context.Context, from, to string) (model.ExchangeRate, error) {
+	rate, err := e.lookup(from, to)
+	if err != nil {
+		return model.ExchangeRate{}, err
+	}
+
+	return model.ExchangeRate{
+		Base:   model.Currency{Symbol: from, CurrencyType: model.Fiat},
+		Target: model.Currency{Symbol: to, CurrencyType: model.Crypto},
+		Rate:   rate,
+	}, nil
+}
+
+// GetCryptoRates implements service.Exchange.
+func (e *Exchange) GetCryptoRates(ctx context.Context, pairs []string) ([]model.ExchangeRate, error) {
+	var result []model.ExchangeRate
+
+	for _, pair := range pairs {
+		tokens := strings.Split(pair, "/")
+
+		rate, err := e.lookup(tokens[0], tokens[1])
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, model.ExchangeRate{
+			Base:   model.Currency{Symbol: tokens[0], CurrencyType: model.Crypto},
+			Target: model.Currency{Symbol: tokens[1], CurrencyType: model.Fiat},
+			Rate:   rate,
+		})
+	}
+
+	return result, nil
+}
+
+// GetAllRates implements service.Exchange.
+func (e *Exchange) GetAllRates(ctx context.Context, currencies []model.Currency) service.LookUp {
+	return e.GetPairRates(ctx, service.Pairs(currencies))
+}
+
+// GetPairRates implements service.Exchange.
+// Lookup error is set only when every
+// pair failed, same as upstream client
+func (e *Exchange) GetPairRates(ctx context.Context, pairs []service.Pair) service.LookUp {
+	result := service.LookUp{
+		Rates:      make(model.Rates),
+		PairErrors: make(map[string]error),
+	}
+
+	var lastErr error
+
+	for _, pair := range pairs {
+		if rate, err := e.lookup(pair.Base.Symbol, pair.Target.Symbol); err != nil {
+			result.PairErrors[pair.String()] = err
+			lastErr = err
+		} else {
+			result.Rates.Put(pair.Base.Symbol, pair.Target.Symbol, rate)
+		}
+	}
+
+	if len(result.Rates) == 0 {
+		result.LookupErr = lastErr
+	}
+
+	return result
+}
+
+// Cache is in-memory storage.Cache,
+// rates are keyed by BASE/TARGET pair
+type Cache struct {
+	lock        sync.RWMutex               // guards rates and subscribers
+	rates       map[string]float64         // cached rates
+	updatedAt   time.Time                  // time of the latest SetRate, zero initially
+	currencies  map[string]model.Currency  // metadata of the currencies by symbol
+	subscribers map[chan struct{}]struct{} // listeners notified on every update
+	err         error                      // error of every lookup, nil by default
+}
+
+// NewCache creates cache holding given rates
+func NewCache(rates map[string]float64) *Cache {
+	if rates == nil {
+		rates = make(map[string]float64)
+	}
+
+	return &Cache{
+		rates:       rates,
+		currencies:  make(map[string]model.Currency),
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// SetCurrency registers metadata of the currency,
+// currencies without metadata are served as crypto
+func (c *Cache) SetCurrency(currency model.Currency) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.currencies[currency.Symbol] = currency
+}
+
+// SetErr fails every lookup with err until reset with nil
+func (c *Cache) SetErr(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.err = err
+}
+
+// Currency implements storage.Cache.
+func (c *Cache) Currency(symbol string) (model.Currency, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	currency, ok := c.currencies[c.resolve(symbol)]
+	return currency, ok
+}
+
+// resolve maps alias or chain qualified symbol
+// to the symbol, must be called under the lock
+func (c *Cache) resolve(symbol string) string {
+	symbol = strings.ToUpper(symbol)
+
+	for _, currency := range c.currencies {
+		for _, alias := range currency.Aliases {
+			if strings.EqualFold(alias, symbol) {
+				return currency.Symbol
+			}
+		}
+
+		for _, chain := range currency.Chains {
+			if strings.EqualFold(currency.Symbol+"-"+chain, symbol) {
+				return currency.Symbol
+			}
+		}
+	}
+
+	return symbol
+}
+
+// currency returns metadata of the symbol,
+// must be called under the lock
+func (c *Cache) currency(symbol string) model.Currency {
+	if currency, ok := c.currencies[symbol]; ok {
+		return currency
+	}
+
+	return model.Currency{Symbol: symbol, CurrencyType: model.Crypto, Decimals: model.DefaultDecimals(model.Crypto)}
+}
+
+// Get implements storage.Cache.
+// Pairs without rate are unsupported
+func (c *Cache) Get(ctx context.Context, pair storage.Pair) (model.ExchangeRate, error) {
+	if err := ctx.Err(); err != nil {
+		return model.ExchangeRate{}, err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.err != nil {
+		return model.ExchangeRate{}, c.err
+	}
+
+	from := c.resolve(pair.From)
+	to := c.resolve(pair.To)
+
+	rate, ok := c.rates[from+"/"+to]
+	if !ok {
+		return model.ExchangeRate{}, fmt.Errorf("%w: %s/%s", storage.ErrUnsupportedPair, from, to)
+	}
+
+	return model.ExchangeRate{
+		Base:      c.currency(from),
+		Target:    c.currency(to),
+		Rate:      rate,
+		Timestamp: c.updatedAt,
+	}, nil
+}
+
+// Snapshot implements storage.Cache.
+// Every rate is exposed as crypto to fiat
+func (c *Cache) Snapshot() model.RateSnapshot {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	snapshot := model.RateSnapshot{
+		Rates:     make(model.Rates),
+		Timestamp: c.updatedAt,
+	}
+
+	for pair, rate := range c.rates {
+		tokens := strings.Split(pair, "/")
+		snapshot.Rates.Put(tokens[0], tokens[1], rate)
+	}
+
+	return snapshot
+}
+
+// Subscribe implements storage.Cache.
+func (c *Cache) Subscribe() (<-chan struct{}, func()) {
+	updatesC := make(chan struct{})
+
+	c.lock.Lock()
+	c.subscribers[updatesC] = struct{}{}
+	c.lock.Unlock()
+
+	return updatesC, func() {
+		c.lock.Lock()
+		delete(c.subscribers, updatesC)
+		c.lock.Unlock()
+	}
+}
+
+// SetRate updates rate for the pair and
+// blocks until every subscriber is notified
+func (c *Cache) SetRate(base, target string, rate float64) {
+	c.lock.Lock()
+	c.rates[base+"/"+target] = rate
+	c.updatedAt = time.Now().UTC()
+
+	var subscribers []chan struct{}
+	for updatesC := range c.subscribers {
+		subscribers = append(subscribers, updatesC)
+	}
+	c.lock.Unlock()
+
+	for _, updatesC := range subscribers {
+		updatesC <- struct{}{}
+	}
+}
+
+// QuoteStorage is in-memory storage.QuoteStorage
+type QuoteStorage struct {
+	lock   sync.Mutex             // guards quotes
+	quotes map[string]model.Quote // quotes keyed by ID
+}
+
+// NewQuoteStorage creates empty quote storage
+func NewQuoteStorage() *QuoteStorage {
+	return &QuoteStorage{quotes: make(map[string]model.Quote)}
+}
+
+// CreateQuote implements storage.QuoteStorage.
+func (s *QuoteStorage) CreateQuote(ctx context.Context, quote model.Quote) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.quotes[quote.ID]; ok {
+		return fmt.Errorf("duplicate quote: %s", quote.ID)
+	}
+
+	s.quotes[quote.ID] = quote
+	return nil
+}
+
+// GetQuote implements storage.QuoteStorage.
+// Malformed ids are rejected as by the uuid column
+func (s *QuoteStorage) GetQuote(ctx context.Context, id string) (model.Quote, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return model.Quote{}, fmt.Errorf("invalid input syntax for type uuid: %q", id)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	quote, ok := s.quotes[id]
+	if !ok {
+		return model.Quote{}, storage.ErrNotFound
+	}
+
+	return quote, nil
+}
+
+// SettleQuote implements storage.QuoteStorage.
+func (s *QuoteStorage) SettleQuote(ctx context.Context, quote model.Quote) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stored, ok := s.quotes[quote.ID]
+	if !ok || stored.Status != model.QuotePending {
+		return storage.ErrQuoteNotPending
+	}
+
+	stored.Status = quote.Status
+	s.quotes[quote.ID] = stored
+
+	return nil
+}
+
+// PricingStorage is in-memory storage.PricingStorage
+type PricingStorage struct {
+	lock  sync.RWMutex        // guards rules
+	Rules []model.PricingRule // Rules known to the storage
+	Err   error               // Err returned by every call when set
+}
+
+// NewPricingStorage creates storage holding given rules
+func NewPricingStorage(rules ...model.PricingRule) *PricingStorage {
+	return &PricingStorage{Rules: rules}
+}
+
+// LoadPricingRules implements storage.PricingStorage.
+func (s *PricingStorage) LoadPricingRules(ctx context.Context) ([]model.PricingRule, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+
+	return append([]model.PricingRule(nil), s.Rules...), nil
+}
+
+// LedgerStorage is in-memory storage.LedgerStorage
+type LedgerStorage struct {
+	lock    sync.RWMutex             // guards records
+	records []model.ConversionRecord // records saved so far
+	Err     error                    // Err returned by every call when set
+}
+
+// NewLedgerStorage creates storage holding given records
+func NewLedgerStorage(records ...model.ConversionRecord) *LedgerStorage {
+	return &LedgerStorage{records: records}
+}
+
+// SetErr fails every call with err until reset with nil,
+// safe to call while the storage is in use
+func (s *LedgerStorage) SetErr(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Err = err
+}
+
+// Records returns copy of the saved records
+func (s *LedgerStorage) Records() []model.ConversionRecord {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]model.ConversionRecord(nil), s.records...)
+}
+
+// SaveConversions implements storage.LedgerStorage.
+func (s *LedgerStorage) SaveConversions(ctx context.Context, records []model.ConversionRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	s.records = append(s.records, records...)
+	return nil
+}
+
+// FindConversions implements storage.LedgerStorage.
+func (s *LedgerStorage) FindConversions(ctx context.Context, filter model.ConversionFilter) ([]model.ConversionRecord, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+
+	var result []model.ConversionRecord
+
+	for _, r := range s.records {
+		if !filter.Since.IsZero() && r.CreatedAt.Before(filter.Since) {
+			continue
+		}
+
+		if !filter.Until.IsZero() && !r.CreatedAt.Before(filter.Until) {
+			continue
+		}
+
+		if filter.Client != "" && r.Client != filter.Client {
+			continue
+		}
+
+		result = append(result, r)
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// HistoryStorage is in-memory storage.HistoryStorage
+type HistoryStorage struct {
+	lock      sync.RWMutex         // guards snapshots
+	snapshots []model.RateSnapshot // snapshots ordered by time taken
+	Err       error                // Err returned by every call when set
+}
+
+// NewHistoryStorage creates storage holding given snapshots
+func NewHistoryStorage(snapshots ...model.RateSnapshot) *HistoryStorage {
+	return &HistoryStorage{snapshots: snapshots}
+}
+
+// SetErr sets error returned by every call
+func (s *HistoryStorage) SetErr(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Err = err
+}
+
+// Snapshots returns copy of the saved snapshots
+func (s *HistoryStorage) Snapshots() []model.RateSnapshot {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]model.RateSnapshot(nil), s.snapshots...)
+}
+
+// SaveSnapshot implements storage.HistoryStorage.
+func (s *HistoryStorage) SaveSnapshot(ctx context.Context, snapshot model.RateSnapshot) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	s.snapshots = append(s.snapshots, snapshot)
+	return nil
+}
+
+// SnapshotAt implements storage.HistoryStorage.
+func (s *HistoryStorage) SnapshotAt(ctx context.Context, at time.Time) (model.RateSnapshot, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.Err != nil {
+		return model.RateSnapshot{}, s.Err
+	}
+
+	for i := len(s.snapshots) - 1; i >= 0; i-- {
+		if !s.snapshots[i].Timestamp.After(at) {
+			return s.snapshots[i], nil
+		}
+	}
+
+	return model.RateSnapshot{}, storage.ErrNotFound
+}
+
+// SnapshotStorage is in-memory storage.SnapshotStorage
+type SnapshotStorage struct {
+	lock     sync.RWMutex         // guards snapshot
+	snapshot *model.CacheSnapshot // latest saved snapshot
+	saves    int                  // number of saved snapshots
+	Err      error                // Err returned by every call when set
+}
+
+// NewSnapshotStorage creates storage holding given snapshot
+func NewSnapshotStorage(snapshot *model.CacheSnapshot) *SnapshotStorage {
+	return &SnapshotStorage{snapshot: snapshot}
+}
+
+// SaveCacheSnapshot implements storage.SnapshotStorage.
+func (s *SnapshotStorage) SaveCacheSnapshot(ctx context.Context, snapshot model.CacheSnapshot) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	s.snapshot = &snapshot
+	s.saves++
+	return nil
+}
+
+// Saves returns number of saved snapshots
+func (s *SnapshotStorage) Saves() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.saves
+}
+
+// LoadCacheSnapshot implements storage.SnapshotStorage.
+func (s *SnapshotStorage) LoadCacheSnapshot(ctx context.Context) (model.CacheSnapshot, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.Err != nil {
+		return model.CacheSnapshot{}, s.Err
+	}
+
+	if s.snapshot == nil {
+		return model.CacheSnapshot{}, storage.ErrNotFound
+	}
+
+	return *s.snapshot, nil
+}
+
+// CurrencyFeed is in-memory storage.CurrencyFeed
+// announcing changes on demand
+type CurrencyFeed struct {
+	changesC chan struct{} // changes not consumed yet
+}
+
+// NewCurrencyFeed creates feed without changes
+func NewCurrencyFeed() *CurrencyFeed {
+	return &CurrencyFeed{changesC: make(chan struct{}, 1)}
+}
+
+// Notify announces change of the currencies
+func (f *CurrencyFeed) Notify() {
+	f.changesC <- struct{}{}
+}
+
+// WatchCurrencies implements storage.CurrencyFeed.
+func (f *CurrencyFeed) WatchCurrencies(ctx context.Context) (<-chan struct{}, error) {
+	return f.changesC, nil
+}
@@ -0,0 +1,89 @@
+// Package logging configures the global logger and
+// correlates logs of the request by its request ID
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FormatJSON    = "json"    // one JSON object per line
+	FormatConsole = "console" // human readable, colored
+)
+
+// requestIDKey is the key fiber requestid middleware stores the ID under
+const requestIDKey = "requestid"
+
+// Configure sets level and format of the global logger,
+// loggers of contexts without request fall back to it
+func Configure(level string, format string, w io.Writer) error {
+	lvl := zerolog.InfoLevel
+
+	if level != "" {
+		var err error
+		if lvl, err = zerolog.ParseLevel(level); err != nil {
+			return fmt.Errorf("unknown log level: %s", level)
+		}
+	}
+
+	switch format {
+	case "", FormatJSON:
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339}
+	default:
+		return fmt.Errorf("unknown log format: %s", format)
+	}
+
+	zerolog.SetGlobalLevel(lvl)
+	log.Logger = zerolog.New(w).With().Timestamp().Logger()
+	zerolog.DefaultContextLogger = &log.Logger
+
+	return nil
+}
+
+// WithRequestID returns context carrying logger
+// which adds the request ID to every entry
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return log.With().Str("requestID", requestID).Logger().WithContext(ctx)
+}
+
+// Middleware carries logger of the request in the user context of fiber
+// and logs every request once served, it must follow requestid middleware
+func Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+
+		requestID, _ := ctx.Locals(requestIDKey).(string)
+		ctx.SetUserContext(WithRequestID(ctx.UserContext(), requestID))
+
+		err := ctx.Next()
+
+		status := ctx.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		log.Ctx(ctx.UserContext()).Info().
+			Str("method", ctx.Method()).
+			Str("path", ctx.Path()).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Str("ip", ctx.IP()).
+			Int("bytes", len(ctx.Response().Body())).
+			Msg("request served")
+
+		return err
+	}
+}
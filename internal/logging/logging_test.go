@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+
+	if err := Configure("debug", FormatJSON, &out); err != nil {
+		t.Fatal(err)
+	}
+	defer Configure("", "", &bytes.Buffer{})
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Use(Middleware())
+	app.Get("/convert", func(ctx *fiber.Ctx) error {
+		log.Ctx(ctx.UserContext()).Debug().Msg("converting")
+		return fiber.NewError(fiber.StatusBadRequest, "invalid amount")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/convert?amount=x", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestID := resp.Header.Get(fiber.HeaderXRequestID)
+	if requestID == "" {
+		t.Fatal("expected request ID")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected handler and access log, got %q", out.String())
+	}
+
+	entries := make([]map[string]interface{}, 0, len(lines))
+
+	for _, line := range lines {
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry["requestID"] != requestID {
+			t.Errorf("expected request ID %s, got %v", requestID, entry["requestID"])
+		}
+
+		entries = append(entries, entry)
+	}
+
+	access := entries[1]
+	if access["message"] != "request served" || access["status"] != float64(fiber.StatusBadRequest) ||
+		access["method"] != "GET" || access["path"] != "/convert" {
+		t.Errorf("unexpected access log: %v", access)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer Configure("", "", &bytes.Buffer{})
+
+	var out bytes.Buffer
+
+	if err := Configure("warn", FormatConsole, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Info().Msg("hidden")
+	log.Warn().Str("pair", "BTC/USD").Msg("shown")
+
+	if strings.Contains(out.String(), "hidden") || !strings.Contains(out.String(), "shown") || strings.HasPrefix(out.String(), "{") {
+		t.Errorf("expected console warnings only, got %q", out.String())
+	}
+
+	if zerolog.GlobalLevel() != zerolog.WarnLevel {
+		t.Errorf("expected warn level, got %s", zerolog.GlobalLevel())
+	}
+
+	if err := Configure("verbose", "", &out); err == nil {
+		t.Error("expected unknown level error")
+	}
+
+	if err := Configure("", "xml", &out); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
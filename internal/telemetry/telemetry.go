@@ -0,0 +1,129 @@
+// Package telemetry configures tracing, instruments fiber
+// requests and propagates trace context to the upstream
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentation = "github.com/kylycht/exchange" // name of the tracer
+	serviceName     = "exchange"                    // service.name of exported spans
+)
+
+// Shutdown flushes spans not exported yet and stops exporter
+type Shutdown func(ctx context.Context) error
+
+// Tracer returns tracer of the service, spans are
+// not recorded unless exporter is configured
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Configure propagates W3C trace context and baggage of the requests
+// and, unless exporter is nil, exports spans sampled by ratio of the
+// new traces, traces of the callers are sampled as decided by them
+func Configure(exporter sdktrace.SpanExporter, sampleRatio float64) Shutdown {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown
+}
+
+// NewOTLPExporter creates exporter sending spans to
+// OTLP/HTTP endpoint, e.g. localhost:4318
+func NewOTLPExporter(ctx context.Context, endpoint string, insecure bool) (sdktrace.SpanExporter, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// End records err on the span, if any, and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Inject propagates trace context of ctx to the outbound request
+func Inject(ctx context.Context, req *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+// Middleware starts span of every request continuing trace of the
+// caller, the span is carried in the user context of fiber
+func Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		carrier := propagation.HeaderCarrier{}
+		ctx.Request().Header.VisitAll(func(key, value []byte) {
+			carrier.Set(string(key), string(value))
+		})
+
+		parent := otel.GetTextMapPropagator().Extract(ctx.UserContext(), carrier)
+		requestID, _ := ctx.Locals("requestid").(string)
+
+		spanCtx, span := Tracer().Start(parent, ctx.Method()+" "+ctx.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", ctx.Method()),
+				attribute.String("http.target", ctx.OriginalURL()),
+				attribute.String("http.request_id", requestID),
+			),
+		)
+		defer span.End()
+
+		ctx.SetUserContext(spanCtx)
+
+		err := ctx.Next()
+
+		status := ctx.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		route := ctx.Route().Path
+
+		span.SetName(ctx.Method() + " " + route)
+		span.SetAttributes(attribute.String("http.route", route), attribute.Int("http.status_code", status))
+
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
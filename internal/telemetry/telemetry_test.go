@@ -0,0 +1,76 @@
+package telemetry
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	Configure(nil, 1)
+
+	var handlerSpan trace.SpanContext
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Use(Middleware())
+	app.Get("/rates/:symbol", func(ctx *fiber.Ctx) error {
+		handlerSpan = trace.SpanContextFromContext(ctx.UserContext())
+		return fiber.NewError(fiber.StatusServiceUnavailable, "rates are stale")
+	})
+
+	req := httptest.NewRequest("GET", "/rates/BTC", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected single span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != "GET /rates/:symbol" {
+		t.Errorf("expected span named by route, got %s", span.Name)
+	}
+
+	// trace of the caller is continued
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected trace of the caller, got %s of parent %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+
+	if handlerSpan.SpanID() != span.SpanContext.SpanID() {
+		t.Errorf("expected span in user context, got %s", handlerSpan.SpanID())
+	}
+
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+
+	if attributes["http.status_code"].AsInt64() != fiber.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %v", attributes["http.status_code"].Emit())
+	}
+
+	if attributes["http.request_id"].AsString() != resp.Header.Get(fiber.HeaderXRequestID) {
+		t.Errorf("expected request ID %s, got %s", resp.Header.Get(fiber.HeaderXRequestID), attributes["http.request_id"].Emit())
+	}
+
+	if span.Status.Code != codes.Error {
+		t.Errorf("expected error status, got %v", span.Status)
+	}
+}
@@ -1,23 +1,50 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"time"
+
+	"github.com/eapache/go-resiliency/retrier"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
+	"github.com/kylycht/exchange/controller/anomalies"
+	"github.com/kylycht/exchange/controller/conversions"
 	"github.com/kylycht/exchange/controller/converter"
+	"github.com/kylycht/exchange/controller/divergence"
+	"github.com/kylycht/exchange/controller/graphql"
+	"github.com/kylycht/exchange/controller/portfolio"
+	"github.com/kylycht/exchange/controller/quote"
+	"github.com/kylycht/exchange/controller/refresh"
 	_ "github.com/kylycht/exchange/docs"
+	"github.com/kylycht/exchange/internal/auth"
+	"github.com/kylycht/exchange/internal/logging"
+	"github.com/kylycht/exchange/internal/telemetry"
 	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/service/anomaly"
 	"github.com/kylycht/exchange/service/forex"
+	"github.com/kylycht/exchange/service/history"
+	"github.com/kylycht/exchange/service/ledger"
+	"github.com/kylycht/exchange/service/pricing"
+	"github.com/kylycht/exchange/service/reconcile"
+	"github.com/kylycht/exchange/service/replay"
+	"github.com/kylycht/exchange/service/schedule"
+	"github.com/kylycht/exchange/service/valuation"
 	"github.com/kylycht/exchange/storage"
 	"github.com/kylycht/exchange/storage/cache"
 	"github.com/kylycht/exchange/storage/persistence"
+	"github.com/kylycht/exchange/storage/redis"
+	"github.com/kylycht/exchange/storage/snapshot"
 	_ "github.com/lib/pq"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 //	@title			C2F F2C Converter
@@ -25,21 +52,13 @@ import (
 //	@description	Crypto-to-Fiat and Fiat-to-Crypto converter
 
 // @host		localhost:3000
-func main() {
-	content, err := os.ReadFile("config.yaml")
-	if err != nil {
-		log.Error().Err(err).Msg("unable to read configuration file")
-		os.Exit(1)
-	}
-	fmt.Println(string(content))
-	cfg := Config{}
-	if err := yaml.Unmarshal(content, &cfg); err != nil {
-		log.Error().Err(err).Msg("unable to read configuration file")
-		os.Exit(1)
-	}
 
-	if err := New(cfg); err != nil {
-		log.Error().Err(err).Msg("unable to initialize application")
+// @securityDefinitions.apikey	AdminToken
+// @in							header
+// @name						Authorization
+func main() {
+	if err := newCLI(os.Stdout).Run(os.Args); err != nil {
+		log.Error().Err(err).Msg("command failed")
 		os.Exit(1)
 	}
 }
@@ -50,13 +69,23 @@ func New(cfg Config) error {
 }
 
 type Application struct {
-	cfg            Config           // application configuration
-	fiberApp       *fiber.App       // underlying fiber application
-	db             storage.Storage  // persistence provider
-	dbConn         *sql.DB          // underlying persistence connection
-	cache          storage.Cache    // cache provider for rates
-	exchangeClient service.Exchange // exchange rates provider
-	stopC          chan os.Signal   // handle interrupt for clean up(close connections, etc)
+	cfg            Config                 // application configuration
+	fiberApp       *fiber.App             // underlying fiber application
+	db             storage.Storage        // persistence provider
+	quotes         storage.QuoteStorage   // persistence provider for quotes
+	ledger         storage.LedgerStorage  // persistence provider for conversion records
+	ledgerWriter   *ledger.Writer         // async writer of conversion records
+	history        storage.HistoryStorage // persistence provider for historical rates
+	archiver       *history.Archiver      // archiver of rate snapshots
+	dbConn         *sql.DB                // underlying persistence connection
+	cache          storage.Cache          // cache provider for rates
+	exchangeClient service.Exchange       // exchange rates provider
+	pricer         service.Pricer         // pricing of the conversions
+	validator      service.Validator      // validation of the obtained rates
+	reconciler     service.Reconciler     // reconciliation of the opposite pairs
+	scheduler      service.Scheduler      // refresh schedule of the individual pairs
+	stopTracing    telemetry.Shutdown     // flushes spans not exported yet
+	stopC          chan os.Signal         // handle interrupt for clean up(close connections, etc)
 }
 
 func (a *Application) init() error {
@@ -64,16 +93,22 @@ func (a *Application) init() error {
 	a.stopC = make(chan os.Signal)
 	signal.Notify(a.stopC, os.Interrupt)
 
-	connStr := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable",
-		a.cfg.DBUsername,
-		a.cfg.DBPassword,
-		a.cfg.DBHost,
-		a.cfg.DBPort,
-		a.cfg.DBName,
-	)
-	log.Debug().Str("connStr", connStr).Msg("initialize db connection")
+	var exporter sdktrace.SpanExporter
+	if a.cfg.TraceEndpoint != "" {
+		otlp, err := telemetry.NewOTLPExporter(context.Background(), a.cfg.TraceEndpoint, a.cfg.TraceInsecure)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to create trace exporter")
+			return err
+		}
+
+		exporter = otlp
+	}
+
+	a.stopTracing = telemetry.Configure(exporter, a.cfg.traceSampleRatio())
 
-	dbConn, err := sql.Open("postgres", connStr)
+	log.Debug().Str("host", a.cfg.DBHost).Str("db", a.cfg.DBName).Msg("initialize db connection")
+
+	dbConn, err := openDB(context.Background(), a.cfg)
 	if err != nil {
 		log.Error().Err(err).Msg("unable to connect to db")
 		return err
@@ -81,21 +116,91 @@ func (a *Application) init() error {
 
 	a.dbConn = dbConn
 	a.db = persistence.New(dbConn)
+	a.quotes = persistence.NewQuoteStore(dbConn)
+	a.ledger = persistence.NewLedgerStore(dbConn)
+	a.history = persistence.NewHistoryStore(dbConn)
 
-	exchangeClient, err := forex.New(a.cfg.ExchangeAPIKey)
+	exchangeClient, err := newExchangeClient(a.cfg)
 	if err != nil {
 		log.Error().Err(err).Msg("unable to create exchange client")
 		return err
 	}
 
 	a.exchangeClient = exchangeClient
-	mcache, err := cache.New(a.exchangeClient, a.db)
+	anomalyOpts := []anomaly.Option{
+		anomaly.WithMaxDeviation(a.cfg.AnomalyMaxDeviation),
+		anomaly.WithMaxInverseMismatch(a.cfg.AnomalyMaxInverseMismatch),
+		anomaly.WithAlertAfter(a.cfg.AnomalyAlertAfter),
+		anomaly.WithConfirmAfter(a.cfg.AnomalyConfirmAfter),
+	}
+
+	if a.cfg.AnomalyAlertURL != "" {
+		anomalyOpts = append(anomalyOpts, anomaly.WithAlert(anomaly.Webhook(a.cfg.AnomalyAlertURL, http.DefaultClient)))
+	}
+
+	a.validator = anomaly.New(anomalyOpts...)
+
+	policy, err := reconcile.ParsePolicy(a.cfg.ReconcilePolicy)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid reconciliation policy")
+		return err
+	}
+
+	a.reconciler = reconcile.New(policy)
+
+	scheduleOpts := []schedule.Option{
+		schedule.WithInterval(a.cfg.RefreshInterval),
+		schedule.WithIntervals(a.cfg.RefreshIntervals),
+		schedule.WithMaxPairs(a.cfg.RefreshMaxPairs),
+		schedule.WithRecentWindow(a.cfg.RefreshRecentWindow),
+		schedule.WithColdInterval(a.cfg.RefreshColdInterval),
+		schedule.WithHotThreshold(a.cfg.RefreshHotThreshold),
+	}
+
+	if a.cfg.RefreshJitter > 0 {
+		scheduleOpts = append(scheduleOpts, schedule.WithJitter(a.cfg.RefreshJitter))
+	}
+
+	a.scheduler = schedule.New(scheduleOpts...)
+
+	cacheOpts := []cache.Option{
+		cache.WithValidator(a.validator),
+		cache.WithReconciler(a.reconciler),
+		cache.WithScheduler(a.scheduler),
+	}
+
+	if a.cfg.CurrencyFeed {
+		cacheOpts = append(cacheOpts, cache.WithCurrencyFeed(persistence.NewCurrencyFeed(a.cfg.DSN())))
+	}
+
+	switch a.cfg.SnapshotStore {
+	case "file":
+		cacheOpts = append(cacheOpts, cache.WithSnapshots(snapshot.NewFile(a.cfg.SnapshotPath), a.cfg.SnapshotMaxAge))
+	case "db":
+		cacheOpts = append(cacheOpts, cache.WithSnapshots(persistence.NewSnapshotStore(dbConn), a.cfg.SnapshotMaxAge))
+	}
+
+	rateCache, err := a.newCache(cacheOpts...)
 	if err != nil {
 		log.Error().Err(err).Msg("unable to create cache")
 		return err
 	}
 
-	a.cache = mcache
+	a.cache = rateCache
+	a.archiver = history.New(a.cache, a.history, a.cfg.HistoryInterval)
+
+	pricer, err := pricing.New(a.cache, persistence.NewPricingStore(dbConn))
+	if err != nil {
+		log.Error().Err(err).Msg("unable to create pricing engine")
+		return err
+	}
+
+	a.pricer = pricer
+
+	if a.cfg.LedgerMode != "off" {
+		a.ledgerWriter = ledger.NewWriter(a.ledger, ledger.WithBufferSize(a.cfg.LedgerBufferSize))
+	}
+
 	a.buildRoutes()
 	go a.stop()
 	log.Debug().Msg("preparing fiber http server")
@@ -107,14 +212,144 @@ func (a *Application) init() error {
 	return nil
 }
 
+// openDB opens connection pool of the configured database and pings
+// it, retrying while the database is not reachable, e.g. still starting
+func openDB(ctx context.Context, cfg Config) (*sql.DB, error) {
+	dbConn, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+
+	dbConn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	dbConn.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	dbConn.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	if cfg.DBMaxIdleConns > 0 {
+		dbConn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	}
+
+	ping := retrier.New(retrier.ExponentialBackoff(cfg.dbConnectRetries(), time.Second), nil)
+
+	err = ping.RunFn(ctx, func(ctx context.Context, retries int) error {
+		err := dbConn.PingContext(ctx)
+		if err != nil {
+			log.Warn().Err(err).Int("attempt", retries+1).Msg("db is not reachable")
+		}
+
+		return err
+	})
+	if err != nil {
+		dbConn.Close()
+		return nil, err
+	}
+
+	return dbConn, nil
+}
+
+// newExchangeClient creates rates provider selected by the configuration
+func newExchangeClient(cfg Config) (service.Exchange, error) {
+	var opts []forex.Option
+	if cfg.ExchangeBaseURL != "" {
+		opts = append(opts, forex.WithBaseURL(cfg.ExchangeBaseURL))
+	}
+
+	switch cfg.ExchangeProvider {
+	case "", "fastforex":
+		return forex.New(cfg.ExchangeAPIKey, opts...)
+
+	case "replay":
+		replayOpts := []replay.Option{replay.WithSpeed(cfg.ReplaySpeed)}
+		if cfg.ReplayLoop {
+			replayOpts = append(replayOpts, replay.WithLoop())
+		}
+
+		return replay.New(cfg.FixturesPath, replayOpts...)
+
+	case "record":
+		client, err := forex.New(cfg.ExchangeAPIKey, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return replay.NewRecorder(client, cfg.FixturesPath)
+	}
+
+	return nil, fmt.Errorf("unknown exchange provider: %s", cfg.ExchangeProvider)
+}
+
+// newCache creates cache backend selected by the configuration
+func (a *Application) newCache(opts ...cache.Option) (storage.Cache, error) {
+	switch a.cfg.CacheBackend {
+	case "", "memory":
+		return cache.New(a.exchangeClient, a.db, opts...)
+
+	case "redis":
+		client := goredis.NewClient(&goredis.Options{
+			Addr:     a.cfg.RedisAddr,
+			Password: a.cfg.RedisPassword,
+			DB:       a.cfg.RedisDB,
+		})
+
+		elector := redis.NewElector(client, "exchange:leader", a.cfg.instanceID(), a.cfg.leaderTTL())
+		feed := redis.NewFeed(client, "exchange:snapshot", "exchange:snapshots")
+
+		return cache.NewReplicated(elector, feed, a.exchangeClient, a.db, opts...)
+
+	case "postgres":
+		elector := persistence.NewElector(a.dbConn, "exchange:leader")
+		feed := persistence.NewSnapshotFeed(a.dbConn, a.cfg.DSN())
+
+		return cache.NewReplicated(elector, feed, a.exchangeClient, a.db, opts...)
+	}
+
+	return nil, fmt.Errorf("unknown cache backend: %s", a.cfg.CacheBackend)
+}
+
 func (a *Application) buildRoutes() {
+	a.fiberApp.Use(requestid.New())
+	a.fiberApp.Use(telemetry.Middleware())
+	a.fiberApp.Use(logging.Middleware())
 	a.fiberApp.Get("/swagger/*", swagger.HandlerDefault)
-	a.fiberApp.Get("/convert", converter.New(a.cache).Convert)
+
+	var converterOpts []converter.Option
+	if a.ledgerWriter != nil {
+		converterOpts = append(converterOpts, converter.WithRecorder(a.ledgerWriter, a.cfg.LedgerMode == "flagged"))
+	}
+
+	a.fiberApp.Get("/convert", converter.New(a.pricer, converterOpts...).Convert)
+	admin := auth.Admin(a.cfg.AdminToken)
+
+	a.fiberApp.Get("/conversions", admin, conversions.New(a.ledger).List)
+	a.fiberApp.Get("/rates/divergence", divergence.New(a.reconciler).Get)
+	a.fiberApp.Get("/rates/anomalies", anomalies.New(a.validator).List)
+	a.fiberApp.Get("/admin/refresh", admin, refresh.New(a.scheduler).Stats)
+	a.fiberApp.Post("/portfolio/value", portfolio.New(valuation.New(a.cache, a.history)).Value)
+	a.fiberApp.All("/graphql", graphql.New(a.cache, a.db).Serve)
+
+	quoter := quote.New(a.pricer, a.cache, a.quotes, a.cfg.QuoteTTL, a.cfg.QuoteTolerance)
+	a.fiberApp.Post("/quotes", quoter.Create)
+	a.fiberApp.Post("/quotes/:id/accept", quoter.Accept)
 }
 
 func (a *Application) stop() {
 	<-a.stopC
 	a.fiberApp.Shutdown()
+	if a.ledgerWriter != nil {
+		a.ledgerWriter.Close()
+	}
+	a.archiver.Close()
+	// replicated cache resigns leadership for the next replica
+	if closer, ok := a.cache.(interface{ Close() }); ok {
+		closer.Close()
+	}
 	a.dbConn.Close()
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancelFn()
+
+	if err := a.stopTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("unable to flush spans")
+	}
+
 	os.Exit(0)
 }
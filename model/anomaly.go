@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Anomaly holds rate rejected by validation,
+// the last good rate is served instead
+type Anomaly struct {
+	Pair     string    `json:"pair"`      // Pair as BASE/TARGET
+	Rate     float64   `json:"rate"`      // Latest rejected rate
+	LastGood float64   `json:"last_good"` // Rate served instead, zero if there is none
+	Reason   string    `json:"reason"`    // Reason of the latest rejection
+	Count    int       `json:"count"`     // Number of consecutive rejections
+	Since    time.Time `json:"since"`     // Time of the first consecutive rejection
+}
@@ -1,25 +1,154 @@
 package model
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // unexported type to disable any new types
 type currency string
 
 const (
-	Fiat   currency = currency("FIAT")   // Fiat represents physical currency
-	Crypto currency = currency("CRYPTO") // Crypto represents crypto currency
+	Fiat       currency = currency("FIAT")       // Fiat represents physical currency
+	Crypto     currency = currency("CRYPTO")     // Crypto represents crypto currency
+	Metal      currency = currency("METAL")      // Metal represents precious metal, e.g. XAU or XAG
+	Stablecoin currency = currency("STABLECOIN") // Stablecoin represents token pegged to fiat, e.g. USDT
+	Commodity  currency = currency("COMMODITY")  // Commodity represents traded commodity, e.g. oil
 )
 
+// CurrencyTypes lists every supported currency type
+var CurrencyTypes = []currency{Fiat, Crypto, Metal, Stablecoin, Commodity}
+
+// defaultDecimals holds minor units of currencies without metadata
+var defaultDecimals = map[currency]int{
+	Fiat:       2,
+	Crypto:     8,
+	Metal:      4,
+	Stablecoin: 6,
+	Commodity:  4,
+}
+
+// ParseCurrencyType returns currency type by its name,
+// unknown types are rejected
+func ParseCurrencyType(s string) (currency, error) {
+	for _, t := range CurrencyTypes {
+		if strings.EqualFold(s, string(t)) {
+			return t, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown currency type: %q", s)
+}
+
 // Currency holds information
 // on the operating currency
 type Currency struct {
-	Name         string   // Name of the currency
-	Symbol       string   // Symbol of the currency
-	CurrencyType currency // Currency type
+	Name          string    // Name of the currency
+	Symbol        string    // Symbol of the currency
+	CurrencyType  currency  // Currency type
+	IsAvailable   bool      // Whether currency is enabled for conversions
+	NumericCode   int       // ISO 4217 numeric code, zero if currency has none
+	Decimals      int       // Minor unit decimals amounts are rounded to
+	DisplaySymbol string    // Symbol used for display, e.g. € or ₿
+	Aliases       []string  // Alternative symbols resolved to the Symbol, e.g. XBT
+	Chains        []string  // Networks token is issued on, e.g. ERC20 or TRC20
+	ActiveFrom    time.Time // Currency is not served before, ignored when zero
+	ActiveUntil   time.Time // Currency is not served from, ignored when zero
+}
+
+// ActiveAt reports whether currency
+// is within its active date range
+func (c Currency) ActiveAt(t time.Time) bool {
+	if !c.ActiveFrom.IsZero() && t.Before(c.ActiveFrom) {
+		return false
+	}
+
+	return c.ActiveUntil.IsZero() || t.Before(c.ActiveUntil)
+}
+
+// DefaultDecimals returns minor unit decimals
+// of the currency type without metadata
+func DefaultDecimals(currencyType currency) int {
+	if decimals, ok := defaultDecimals[currencyType]; ok {
+		return decimals
+	}
+
+	return defaultDecimals[Crypto]
 }
 
 // ExchangeRate holds information
 // for given exchange rate
 type ExchangeRate struct {
-	Base   Currency // Base currency
-	Target Currency // Target currency
-	Rate   float64  // Exchange rate
+	Base      Currency  // Base currency
+	Target    Currency  // Target currency
+	Rate      float64   // Exchange rate
+	Timestamp time.Time // Time the rate was obtained
+	Stale     bool      // Rate is served from the snapshot saved before restart
+}
+
+// Rates is a graph of exchange rates
+// keyed by base and then by target symbol
+type Rates map[string]map[string]float64
+
+// Put sets rate of the pair
+func (r Rates) Put(base, target string, rate float64) {
+	if _, ok := r[base]; !ok {
+		r[base] = make(map[string]float64)
+	}
+
+	r[base][target] = rate
+}
+
+// Direct returns rate of the pair obtained
+// from upstream either as is or inverted
+func (r Rates) Direct(base, target string) (float64, bool) {
+	if rate, ok := r[base][target]; ok && rate != 0 {
+		return rate, true
+	}
+
+	if rate, ok := r[target][base]; ok && rate != 0 {
+		return 1 / rate, true
+	}
+
+	return 0, false
+}
+
+// RateSnapshot holds every cached rate
+// as of a single refresh
+type RateSnapshot struct {
+	Rates      Rates                // Rates keyed by base and then by target symbol
+	Timestamp  time.Time            // Time the rates were obtained
+	Timestamps map[string]time.Time // Time pairs were obtained keyed by BASE/TARGET, if other than Timestamp
+	MaxAge     time.Duration        // Rates obtained longer ago are not served, zero for any age
+	Stale      bool                 // Rates are served from the snapshot saved before restart
+}
+
+// ObtainedAt returns time rate of the pair
+// or of its opposite pair was obtained
+func (s RateSnapshot) ObtainedAt(base, target string) time.Time {
+	if t, ok := s.Timestamps[base+"/"+target]; ok {
+		return t
+	}
+
+	if t, ok := s.Timestamps[target+"/"+base]; ok {
+		return t
+	}
+
+	return s.Timestamp
+}
+
+// Expired reports whether rate of the pair
+// is older than MaxAge and can't be served
+func (s RateSnapshot) Expired(base, target string) bool {
+	return s.MaxAge > 0 && time.Since(s.ObtainedAt(base, target)) > s.MaxAge
+}
+
+// CacheSnapshot holds state of the cache persisted after
+// every refresh to serve rates on start when upstream is down
+type CacheSnapshot struct {
+	Rates      Rates                `json:"rates"`                // Rates keyed by base and then by target symbol
+	Currencies []Currency           `json:"currencies"`           // Currencies served along with the rates
+	Timestamp  time.Time            `json:"timestamp"`            // Time the rates were obtained
+	Timestamps map[string]time.Time `json:"timestamps,omitempty"` // Time pairs were obtained keyed by BASE/TARGET, if other than Timestamp
 }
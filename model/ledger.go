@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// ConversionRecord holds audit trail
+// entry of the served conversion
+type ConversionRecord struct {
+	RequestID string    `json:"request_id"` // ID of the request conversion was served for
+	Client    string    `json:"client"`     // Client requested the conversion
+	From      string    `json:"from"`       // From currency symbol
+	To        string    `json:"to"`         // To currency symbol
+	Amount    float64   `json:"amount"`     // Amount of from currency
+	Rate      float64   `json:"rate"`       // Rate applied to the conversion
+	Result    float64   `json:"result"`     // Amount of to currency served
+	RateTime  time.Time `json:"rate_time"`  // Time the rate was obtained
+	CreatedAt time.Time `json:"created_at"` // Time the conversion was served
+}
+
+// ConversionFilter holds criteria
+// to query served conversions
+type ConversionFilter struct {
+	Since  time.Time // Since includes conversions served at or after, ignored when zero
+	Until  time.Time // Until includes conversions served before, ignored when zero
+	Client string    // Client requested the conversion, ignored when empty
+	Limit  int       // Limit max number of records
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Holding holds amount of
+// the currency in the basket
+type Holding struct {
+	Symbol string  `json:"symbol" example:"BTC"` // Currency symbol
+	Amount float64 `json:"amount" example:"1.5"` // Amount of the currency
+}
+
+// ValuationLine holds value of
+// the single holding
+type ValuationLine struct {
+	Symbol string  `json:"symbol"` // Currency symbol
+	Amount float64 `json:"amount"` // Amount of the currency
+	Rate   float64 `json:"rate"`   // Rate to the reporting currency
+	Value  float64 `json:"value"`  // Value in the reporting currency
+}
+
+// Valuation holds value of the basket
+// in the reporting currency
+type Valuation struct {
+	Currency string          `json:"currency"`  // Reporting currency symbol
+	Total    float64         `json:"total"`     // Total value in the reporting currency
+	Lines    []ValuationLine `json:"lines"`     // Breakdown per holding
+	RateTime time.Time       `json:"rate_time"` // Time the rates were obtained
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// PricingRule holds margin applied on conversions.
+// Rule matches either the exact pair by symbols or
+// any pair of given currency types, empty symbols
+// and types match everything
+type PricingRule struct {
+	From       string   // From currency symbol
+	To         string   // To currency symbol
+	FromType   currency // From currency type
+	ToType     currency // To currency type
+	Spread     float64  // Spread between bid and ask relative to the mid rate, e.g. 0.002
+	FixedFee   float64  // Fixed fee in `to` currency
+	PercentFee float64  // Fee as a fraction of the gross amount, e.g. 0.001
+	MinFee     float64  // Minimum fee in `to` currency
+}
+
+// Conversion holds breakdown of
+// the priced conversion
+type Conversion struct {
+	From     string    `json:"from"`            // From currency symbol
+	To       string    `json:"to"`              // To currency symbol
+	Amount   float64   `json:"amount"`          // Amount of from currency
+	MidRate  float64   `json:"mid_rate"`        // Mid market rate
+	Rate     float64   `json:"rate"`            // Rate applied after the spread
+	Gross    float64   `json:"gross"`           // Amount of to currency before fees
+	Fee      float64   `json:"fee"`             // Fee in to currency
+	Net      float64   `json:"net"`             // Amount of to currency after fees
+	RateTime time.Time `json:"rate_time"`       // Time the mid rate was obtained
+	Stale    bool      `json:"stale,omitempty"` // Mid rate is served from the snapshot saved before restart
+	Base     Currency  `json:"-"`               // Metadata of from currency
+	Target   Currency  `json:"-"`               // Metadata of to currency
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// unexported type to disable any new statuses
+type quoteStatus string
+
+const (
+	QuotePending  quoteStatus = quoteStatus("PENDING")  // QuotePending quote awaits acceptance
+	QuoteAccepted quoteStatus = quoteStatus("ACCEPTED") // QuoteAccepted quote was executed at the locked rate
+	QuoteExpired  quoteStatus = quoteStatus("EXPIRED")  // QuoteExpired quote was accepted after its expiry
+	QuoteRejected quoteStatus = quoteStatus("REJECTED") // QuoteRejected market moved past tolerance
+)
+
+// Quote holds priced conversion locked
+// at the rate for a short window
+type Quote struct {
+	ID        string      `json:"id"`         // ID of the quote
+	From      string      `json:"from"`       // From currency symbol
+	To        string      `json:"to"`         // To currency symbol
+	Amount    float64     `json:"amount"`     // Amount of from currency
+	MidRate   float64     `json:"mid_rate"`   // Mid market rate the quote was priced at
+	Rate      float64     `json:"rate"`       // Locked rate applied after the spread
+	Gross     float64     `json:"gross"`      // Amount of to currency before fees
+	Fee       float64     `json:"fee"`        // Fee in to currency
+	Net       float64     `json:"net"`        // Amount of to currency after fees
+	Status    quoteStatus `json:"status"`     // Status of the quote
+	CreatedAt time.Time   `json:"created_at"` // Time quote was created
+	ExpiresAt time.Time   `json:"expires_at"` // Time after which quote can not be accepted
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Divergence holds mismatch of the rate of the pair
+// and inverted rate of the opposite pair
+type Divergence struct {
+	Pair       string  `json:"pair"`       // Pair priced in fiat as BASE/TARGET, e.g. BTC/USD
+	Rate       float64 `json:"rate"`       // Rate of the pair, e.g. BTC/USD
+	Inverse    float64 `json:"inverse"`    // Rate of the opposite pair, e.g. USD/BTC
+	Divergence float64 `json:"divergence"` // Value gained (or lost if negative) by a round trip, rate * inverse - 1
+}
+
+// Reconciliation holds divergences
+// measured by the latest refresh
+type Reconciliation struct {
+	Policy       string       `json:"policy"`        // Policy applied to the rates
+	Pairs        []Divergence `json:"pairs"`         // Pairs obtained in both directions
+	MaxAbs       float64      `json:"max_abs"`       // Max absolute divergence
+	ReconciledAt time.Time    `json:"reconciled_at"` // Time of the reconciliation
+}
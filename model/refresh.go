@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// PairStats holds demand and
+// refresh schedule of the pair
+type PairStats struct {
+	Pair            string    `json:"pair"`             // Pair as BASE/TARGET
+	Requests        int       `json:"requests"`         // Requests within the window
+	LastRequested   time.Time `json:"last_requested"`   // Time of the latest request, zero if never requested
+	Lane            string    `json:"lane"`             // Lane the pair is refreshed in, hot or cold
+	IntervalSeconds float64   `json:"interval_seconds"` // Refresh interval within the lane
+	Refreshed       time.Time `json:"refreshed"`        // Time of the latest refresh
+	Due             time.Time `json:"due"`              // Time of the next refresh
+}
+
+// RefreshStats holds demand and
+// refresh schedule of every pair
+type RefreshStats struct {
+	WindowSeconds float64     `json:"window_seconds"` // Sliding window requests are counted in
+	Hot           int         `json:"hot"`            // Pairs in the hot lane
+	Cold          int         `json:"cold"`           // Pairs in the slow lane
+	Pairs         []PairStats `json:"pairs"`          // Pairs by requests, the most requested first
+}
@@ -0,0 +1,291 @@
+package anomaly
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultMaxDeviation       float64 = 0.2  // max relative change from the last good rate
+	defaultMaxInverseMismatch float64 = 0.05 // max relative mismatch of the rate and inverted opposite rate
+	defaultAlertAfter         int     = 3    // consecutive rejections of the pair before alert
+	defaultConfirmAfter       int     = 5    // consecutive consistent rejections accepted as the new level
+)
+
+var (
+	// ErrNonFinite is reported for NaN and infinite rates
+	ErrNonFinite = errors.New("rate is not finite")
+	// ErrNonPositive is reported for zero and negative rates
+	ErrNonPositive = errors.New("rate is not positive")
+	// ErrDeviation is reported for rates too far from the last good rate
+	ErrDeviation = errors.New("rate deviates from the last good rate")
+	// ErrInverseMismatch is reported when rate does not match the inverted opposite rate
+	ErrInverseMismatch = errors.New("rate does not match inverted opposite rate")
+)
+
+// Detector validates rates obtained from upstream and
+// quarantines anomalies, the last good rate is served
+// until the pair recovers or the new level is confirmed
+type Detector struct {
+	lock               sync.RWMutex            // guards quarantine
+	quarantine         map[string]*quarantined // rejected pairs keyed by BASE/TARGET
+	maxDeviation       float64                 // max relative change from the last good rate
+	maxInverseMismatch float64                 // max relative mismatch of the rate and inverted opposite rate
+	alertAfter         int                     // consecutive rejections of the pair before alert
+	confirmAfter       int                     // consecutive consistent rejections accepted as the new level
+	alertFn            func(model.Anomaly)     // called on repeated anomalies, optional
+	now                func() time.Time        // clock used to timestamp anomalies
+}
+
+// quarantined holds rejected pair
+// along with the latest rejection
+type quarantined struct {
+	model.Anomaly
+	err    error // err of the latest rejection
+	streak int   // consecutive deviations consistent with each other
+}
+
+// Option configures the detector
+type Option func(*Detector)
+
+// WithMaxDeviation sets max relative change of the
+// rate from the last good one, e.g. 0.2 for 20%
+func WithMaxDeviation(deviation float64) Option {
+	return func(d *Detector) {
+		if deviation > 0 {
+			d.maxDeviation = deviation
+		}
+	}
+}
+
+// WithMaxInverseMismatch sets max relative mismatch between
+// the rate and inverted opposite rate, e.g. 0.05 for 5%
+func WithMaxInverseMismatch(mismatch float64) Option {
+	return func(d *Detector) {
+		if mismatch > 0 {
+			d.maxInverseMismatch = mismatch
+		}
+	}
+}
+
+// WithAlertAfter sets number of consecutive
+// rejections of the pair before alert
+func WithAlertAfter(n int) Option {
+	return func(d *Detector) {
+		if n > 0 {
+			d.alertAfter = n
+		}
+	}
+}
+
+// WithConfirmAfter sets number of consecutive rejections consistent
+// with each other after which rate is accepted as the new level
+func WithConfirmAfter(n int) Option {
+	return func(d *Detector) {
+		if n > 0 {
+			d.confirmAfter = n
+		}
+	}
+}
+
+// WithAlert sets function called on repeated anomalies
+// in addition to the error logged
+func WithAlert(fn func(model.Anomaly)) Option {
+	return func(d *Detector) {
+		d.alertFn = fn
+	}
+}
+
+func New(opts ...Option) *Detector {
+	d := &Detector{
+		quarantine:         make(map[string]*quarantined),
+		maxDeviation:       defaultMaxDeviation,
+		maxInverseMismatch: defaultMaxInverseMismatch,
+		alertAfter:         defaultAlertAfter,
+		confirmAfter:       defaultConfirmAfter,
+		now:                time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+var _ service.Validator = (*Detector)(nil)
+
+// Validate implements service.Validator.
+// Rates must be finite, positive, within max deviation from
+// the previous rate and match the inverted opposite rate
+func (d *Detector) Validate(previous, next model.Rates) (model.Rates, []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	result := make(model.Rates)
+	rejected := make(map[[2]string]error)
+
+	for base, targets := range next {
+		for target, rate := range targets {
+			if err := d.check(previous, base, target, rate); err != nil {
+				rejected[[2]string{base, target}] = err
+				continue
+			}
+
+			result.Put(base, target, rate)
+		}
+	}
+
+	// both sides are rejected as there is no telling which one is wrong
+	for base, targets := range result {
+		for target, rate := range targets {
+			inverse, ok := result[target][base]
+			if !ok || base > target {
+				continue
+			}
+
+			if mismatch := math.Abs(rate*inverse - 1); mismatch > d.maxInverseMismatch {
+				err := fmt.Errorf("%w: %.2f%%", ErrInverseMismatch, mismatch*100)
+				rejected[[2]string{base, target}] = err
+				rejected[[2]string{target, base}] = err
+			}
+		}
+	}
+
+	for pair := range rejected {
+		delete(result[pair[0]], pair[1])
+	}
+
+	for base, targets := range result {
+		for target := range targets {
+			delete(d.quarantine, base+"/"+target)
+		}
+	}
+
+	var substituted []string
+
+	for pair, err := range rejected {
+		base, target := pair[0], pair[1]
+
+		lastGood := previous[base][target]
+		if lastGood != 0 {
+			result.Put(base, target, lastGood)
+			substituted = append(substituted, base+"/"+target)
+		}
+
+		d.reject(base, target, next[base][target], lastGood, err)
+	}
+
+	for base, targets := range result {
+		if len(targets) == 0 {
+			delete(result, base)
+		}
+	}
+
+	sort.Strings(substituted)
+
+	return result, substituted
+}
+
+// Quarantined returns currently rejected pairs
+func (d *Detector) Quarantined() []model.Anomaly {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	anomalies := make([]model.Anomaly, 0, len(d.quarantine))
+	for _, q := range d.quarantine {
+		anomalies = append(anomalies, q.Anomaly)
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].Pair < anomalies[j].Pair
+	})
+
+	return anomalies
+}
+
+// check validates single rate against
+// the previous one, must be called under the lock
+func (d *Detector) check(previous model.Rates, base, target string, rate float64) error {
+	if math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return ErrNonFinite
+	}
+
+	if rate <= 0 {
+		return ErrNonPositive
+	}
+
+	lastGood, ok := previous[base][target]
+	if !ok || lastGood <= 0 {
+		return nil
+	}
+
+	deviation := math.Abs(rate-lastGood) / lastGood
+	if deviation <= d.maxDeviation {
+		return nil
+	}
+
+	// rates far from the last good one but consistent with
+	// each other for long enough are the new market level
+	if q, ok := d.quarantine[base+"/"+target]; ok && q.streak >= d.confirmAfter && d.consistent(q, rate) {
+		log.Warn().Str("pair", base+"/"+target).Float64("rate", rate).Float64("lastGood", lastGood).
+			Int("anomalies", q.Count).Msg("rate level confirmed")
+		return nil
+	}
+
+	return fmt.Errorf("%w: %.2f%%", ErrDeviation, deviation*100)
+}
+
+// consistent reports whether rate is within max deviation from
+// the latest deviated rate of the pair, must be called under the lock
+func (d *Detector) consistent(q *quarantined, rate float64) bool {
+	return errors.Is(q.err, ErrDeviation) && math.Abs(rate-q.Rate)/q.Rate <= d.maxDeviation
+}
+
+// reject quarantines the rate and alerts on
+// repeated anomalies, must be called under the lock
+func (d *Detector) reject(base, target string, rate, lastGood float64, err error) {
+	pair := base + "/" + target
+
+	q, ok := d.quarantine[pair]
+	if !ok {
+		q = &quarantined{Anomaly: model.Anomaly{Pair: pair, Since: d.now().UTC()}}
+		d.quarantine[pair] = q
+	}
+
+	switch {
+	case !errors.Is(err, ErrDeviation):
+		q.streak = 0
+	case d.consistent(q, rate):
+		q.streak++
+	default:
+		q.streak = 1
+	}
+
+	q.err = err
+	q.Rate = rate
+	q.LastGood = lastGood
+	q.Reason = err.Error()
+	q.Count++
+
+	log.Warn().Err(err).Str("pair", pair).Float64("rate", rate).Float64("lastGood", lastGood).Msg("rate quarantined")
+
+	if q.Count%d.alertAfter != 0 {
+		return
+	}
+
+	log.Error().Str("pair", pair).Int("anomalies", q.Count).Time("since", q.Since).Str("reason", q.Reason).
+		Msg("repeated rate anomalies")
+
+	if d.alertFn != nil {
+		d.alertFn(q.Anomaly)
+	}
+}
@@ -0,0 +1,156 @@
+package anomaly
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kylycht/exchange/model"
+)
+
+func TestValidate(t *testing.T) {
+	previous := model.Rates{
+		"BTC": {"USD": 60000},
+		"USD": {"BTC": 1.0 / 60000},
+		"ETH": {"USD": 3000},
+	}
+
+	tests := []struct {
+		name        string
+		next        model.Rates
+		want        model.Rates
+		rejected    []string
+		substituted []string
+	}{
+		{
+			name: "valid",
+			next: model.Rates{"BTC": {"USD": 61000}, "USD": {"BTC": 1.0 / 61000}, "ETH": {"USD": 3100}},
+			want: model.Rates{"BTC": {"USD": 61000}, "USD": {"BTC": 1.0 / 61000}, "ETH": {"USD": 3100}},
+		},
+		{
+			name:        "zero rate keeps last good",
+			next:        model.Rates{"ETH": {"USD": 0}},
+			want:        model.Rates{"ETH": {"USD": 3000}},
+			rejected:    []string{"ETH/USD"},
+			substituted: []string{"ETH/USD"},
+		},
+		{
+			name:        "non finite rates",
+			next:        model.Rates{"ETH": {"USD": math.NaN()}, "BTC": {"USD": math.Inf(1)}},
+			want:        model.Rates{"ETH": {"USD": 3000}, "BTC": {"USD": 60000}},
+			rejected:    []string{"BTC/USD", "ETH/USD"},
+			substituted: []string{"BTC/USD", "ETH/USD"},
+		},
+		{
+			name:        "deviation",
+			next:        model.Rates{"ETH": {"USD": 30}},
+			want:        model.Rates{"ETH": {"USD": 3000}},
+			rejected:    []string{"ETH/USD"},
+			substituted: []string{"ETH/USD"},
+		},
+		{
+			name:        "inverse mismatch rejects both sides",
+			next:        model.Rates{"BTC": {"USD": 60000}, "USD": {"BTC": 1.0 / 55000}},
+			want:        model.Rates{"BTC": {"USD": 60000}, "USD": {"BTC": 1.0 / 60000}},
+			rejected:    []string{"BTC/USD", "USD/BTC"},
+			substituted: []string{"BTC/USD", "USD/BTC"},
+		},
+		{
+			name:     "new pair without last good",
+			next:     model.Rates{"XAU": {"USD": -1}, "XAG": {"USD": 30}},
+			want:     model.Rates{"XAG": {"USD": 30}},
+			rejected: []string{"XAU/USD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New()
+
+			got, substituted := d.Validate(previous, tt.next)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+
+			if strings.Join(substituted, ",") != strings.Join(tt.substituted, ",") {
+				t.Errorf("expected %v substituted, got %v", tt.substituted, substituted)
+			}
+
+			for base, targets := range tt.want {
+				for target, rate := range targets {
+					if got[base][target] != rate {
+						t.Errorf("%s/%s: expected %v, got %v", base, target, rate, got[base][target])
+					}
+				}
+			}
+
+			quarantined := d.Quarantined()
+			if len(quarantined) != len(tt.rejected) {
+				t.Fatalf("expected %v quarantined, got %+v", tt.rejected, quarantined)
+			}
+
+			for i, pair := range tt.rejected {
+				if quarantined[i].Pair != pair || quarantined[i].Count != 1 || quarantined[i].Reason == "" {
+					t.Errorf("unexpected anomaly: %+v", quarantined[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAlert(t *testing.T) {
+	var alerts []model.Anomaly
+
+	d := New(WithAlertAfter(2), WithAlert(func(a model.Anomaly) {
+		alerts = append(alerts, a)
+	}))
+
+	previous := model.Rates{"BTC": {"USD": 60000}}
+
+	for i := 0; i < 4; i++ {
+		previous, _ = d.Validate(previous, model.Rates{"BTC": {"USD": 0}})
+	}
+
+	if len(alerts) != 2 || alerts[0].Count != 2 || alerts[1].Count != 4 || alerts[1].LastGood != 60000 {
+		t.Fatalf("expected alert on every 2nd anomaly, got %+v", alerts)
+	}
+
+	// recovered pair leaves the quarantine
+	if _, substituted := d.Validate(previous, model.Rates{"BTC": {"USD": 60500}}); len(substituted) != 0 {
+		t.Errorf("expected recovered rate to be served, got %v substituted", substituted)
+	}
+
+	if quarantined := d.Quarantined(); len(quarantined) != 0 {
+		t.Errorf("expected empty quarantine, got %+v", quarantined)
+	}
+}
+
+func TestValidateConfirmsNewLevel(t *testing.T) {
+	d := New(WithConfirmAfter(3), WithMaxDeviation(0.1))
+
+	previous := model.Rates{"BTC": {"USD": 60000}}
+
+	// inconsistent anomalies never confirm each other
+	for _, rate := range []float64{30000, 90000, 30000, 90000} {
+		previous, _ = d.Validate(previous, model.Rates{"BTC": {"USD": rate}})
+		if previous["BTC"]["USD"] != 60000 {
+			t.Fatalf("expected last good rate to be kept, got %v", previous)
+		}
+	}
+
+	for _, rate := range []float64{30000, 30500, 30200} {
+		previous, _ = d.Validate(previous, model.Rates{"BTC": {"USD": rate}})
+		if previous["BTC"]["USD"] != 60000 {
+			t.Fatalf("expected last good rate to be kept, got %v", previous)
+		}
+	}
+
+	previous, _ = d.Validate(previous, model.Rates{"BTC": {"USD": 30100}})
+	if previous["BTC"]["USD"] != 30100 {
+		t.Fatalf("expected new level to be confirmed, got %v", previous)
+	}
+
+	if quarantined := d.Quarantined(); len(quarantined) != 0 {
+		t.Errorf("expected empty quarantine, got %+v", quarantined)
+	}
+}
@@ -0,0 +1,55 @@
+package anomaly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/rs/zerolog/log"
+)
+
+const webhookTimeout = time.Second * 5 // timeout of single alert delivery
+
+// Webhook returns alert which posts the anomaly as JSON to the url,
+// alerts are delivered in the background so that refresh is not held
+func Webhook(url string, client *http.Client) func(model.Anomaly) {
+	return func(anomaly model.Anomaly) {
+		go func() {
+			if err := post(client, url, anomaly); err != nil {
+				log.Error().Err(err).Str("pair", anomaly.Pair).Msg("unable to deliver anomaly alert")
+			}
+		}()
+	}
+}
+
+func post(client *http.Client, url string, anomaly model.Anomaly) error {
+	body, err := json.Marshal(anomaly)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancelFn()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+)
+
+func TestWebhook(t *testing.T) {
+	alertC := make(chan model.Anomaly, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var anomaly model.Anomaly
+		if err := json.NewDecoder(r.Body).Decode(&anomaly); err != nil {
+			t.Error(err)
+		}
+
+		alertC <- anomaly
+	}))
+	defer server.Close()
+
+	d := New(WithAlertAfter(2), WithAlert(Webhook(server.URL, server.Client())))
+
+	previous := model.Rates{"BTC": {"USD": 60000}}
+	for i := 0; i < 2; i++ {
+		previous, _ = d.Validate(previous, model.Rates{"BTC": {"USD": 0}})
+	}
+
+	select {
+	case anomaly := <-alertC:
+		if anomaly.Pair != "BTC/USD" || anomaly.Count != 2 || anomaly.LastGood != 60000 {
+			t.Errorf("unexpected alert: %+v", anomaly)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected alert to be posted")
+	}
+}
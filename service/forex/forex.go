@@ -3,24 +3,30 @@ package forex
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/kylycht/exchange/internal/telemetry"
 	"github.com/kylycht/exchange/model"
 	"github.com/kylycht/exchange/service"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/sync/semaphore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 )
 
 const (
-	baseURL string = "https://api.fastforex.io/" // base URL of Forex API
+	defaultBaseURL  string = "https://api.fastforex.io/" // base URL of Forex API
+	cryptoBatchSize int    = 1                           // pairs per crypto request, api allows 10, but is broken
+	cryptoWorkers   int    = 30                          // max concurrent crypto requests
+	fiatWorkers     int    = 5                           // max concurrent fiat requests
 )
 
 type Response struct {
@@ -31,13 +37,36 @@ type Response struct {
 }
 
 type client struct {
-	baseURL     *url.URL      // Base URL for API requests
-	httpClient  *http.Client  // HTTP client used to communicate with the API.
-	rateLimiter *rate.Limiter // Rate limiter for forex api
+	baseURL       *url.URL      // Base URL for API requests
+	httpClient    *http.Client  // HTTP client used to communicate with the API.
+	rateLimiter   *rate.Limiter // Rate limiter for forex api
+	fetchTimeout  time.Duration // Timeout of single batch request
+	lookupTimeout time.Duration // Timeout of C2F or F2C lookup within the burst of the rate limiter
 }
 
-func New(apiKey string) (service.Exchange, error) {
-	base, err := url.Parse(baseURL)
+// Option configures the client
+type Option func(*client) error
+
+// WithBaseURL overrides base URL of the API,
+// e.g. to point the client to the test server
+func WithBaseURL(baseURL string) Option {
+	return func(c *client) error {
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL += "/"
+		}
+
+		base, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+
+		c.baseURL = base
+		return nil
+	}
+}
+
+func New(apiKey string, opts ...Option) (service.Exchange, error) {
+	base, err := url.Parse(defaultBaseURL)
 	if err != nil {
 		return nil, err
 	}
@@ -56,19 +85,43 @@ func New(apiKey string) (service.Exchange, error) {
 				},
 			),
 		},
-		baseURL: base,
+		baseURL:       base,
+		fetchTimeout:  time.Second * 3,
+		lookupTimeout: time.Second * 5,
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
 	}
 
 	return c, nil
 }
 
-func (f *client) Do(ctx context.Context, req *http.Request, v interface{}) error {
-	err := f.rateLimiter.Wait(ctx)
-	if err != nil {
+// Do sends the request within span of the requested pairs,
+// trace context is propagated to the API
+func (f *client) Do(ctx context.Context, req *http.Request, v interface{}) (err error) {
+	pairs := requestedPairs(req.URL.Query())
+
+	ctx, span := telemetry.Tracer().Start(ctx, "forex "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.StringSlice("forex.pairs", pairs),
+			attribute.Int("forex.batch_size", len(pairs)),
+		),
+	)
+	defer func() { telemetry.End(span, err) }()
+
+	if err = f.rateLimiter.Wait(ctx); err != nil {
 		return err
 	}
 
-	log.Debug().Str("url", req.URL.String()).Msg("fetching information from API")
+	log.Ctx(ctx).Debug().Str("path", req.URL.Path).Msg("fetching information from API")
+
+	req = req.WithContext(ctx)
+	telemetry.Inject(ctx, req)
 
 	resp, err := f.httpClient.Do(req)
 	if err != nil {
@@ -77,6 +130,8 @@ func (f *client) Do(ctx context.Context, req *http.Request, v interface{}) error
 
 	defer resp.Body.Close()
 
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("unable to fetch rate due to code: %d", resp.StatusCode)
 	}
@@ -98,6 +153,15 @@ func (f *client) Do(ctx context.Context, req *http.Request, v interface{}) error
 	return err
 }
 
+// requestedPairs returns pairs of the fetch-one or fetch-multi query
+func requestedPairs(query url.Values) []string {
+	if pairs := query.Get("pairs"); pairs != "" {
+		return strings.Split(pairs, ",")
+	}
+
+	return []string{query.Get("from") + "/" + query.Get("to")}
+}
+
 // GetRate implements service.Exchange.
 // GET /fetch-one?from=USD&to=BTC
 func (f *client) GetRate(ctx context.Context, from, to string) (model.ExchangeRate, error) {
@@ -106,7 +170,7 @@ func (f *client) GetRate(ctx context.Context, from, to string) (model.ExchangeRa
 		return model.ExchangeRate{}, err
 	}
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
 		return model.ExchangeRate{}, err
 	}
@@ -124,6 +188,11 @@ func (f *client) GetRate(ctx context.Context, from, to string) (model.ExchangeRa
 		return model.ExchangeRate{}, err
 	}
 
+	rate, ok := r.Results[to]
+	if !ok || !valid(rate) {
+		return model.ExchangeRate{}, fmt.Errorf("no rate returned for pair: %s/%s", from, to)
+	}
+
 	return model.ExchangeRate{
 		Base: model.Currency{
 			Symbol:       r.Base,
@@ -133,7 +202,7 @@ func (f *client) GetRate(ctx context.Context, from, to string) (model.ExchangeRa
 			Symbol:       to,
 			CurrencyType: model.Crypto,
 		},
-		Rate: r.Results[to],
+		Rate: rate,
 	}, nil
 }
 
@@ -145,7 +214,7 @@ func (f *client) GetCryptoRates(ctx context.Context, pairs []string) ([]model.Ex
 		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +224,7 @@ func (f *client) GetCryptoRates(ctx context.Context, pairs []string) ([]model.Ex
 
 	req.URL.RawQuery = query.Encode()
 
-	log.Debug().Str("pairs", strings.Join(pairs, ",")).Msg("fetching for pairs")
+	log.Ctx(ctx).Debug().Str("pairs", strings.Join(pairs, ",")).Msg("fetching for pairs")
 
 	resp := struct {
 		Prices map[string]float64 `json:"prices"`
@@ -170,6 +239,10 @@ func (f *client) GetCryptoRates(ctx context.Context, pairs []string) ([]model.Ex
 
 	for pair, rate := range resp.Prices {
 		tokens := strings.Split(pair, "/")
+		if len(tokens) != 2 {
+			log.Ctx(ctx).Warn().Str("pair", pair).Msg("skipping price of malformed pair")
+			continue
+		}
 
 		result = append(result, model.ExchangeRate{
 			Base:   model.Currency{Symbol: tokens[0], CurrencyType: model.Crypto},
@@ -181,232 +254,249 @@ func (f *client) GetCryptoRates(ctx context.Context, pairs []string) ([]model.Ex
 	return result, nil
 }
 
-func (f *client) getCryptoRates(ctx context.Context, symbols []string) (map[string]map[string]float64, error) {
-	log.Debug().Msg("fetching crypto rates")
+// fetchResult holds outcome of a single job
+type fetchResult struct {
+	rates []model.ExchangeRate // rates obtained by the job
+	err   error                // error of the job
+}
 
-	var (
-		resultsC      = make(chan model.ExchangeRate)
-		cryptoToFiat  = make(map[string]map[string]float64)
-		sem           = semaphore.NewWeighted(30)
-		leftToProcess = len(symbols)
-		batchSize     = 1 // api allows 10, but is broken
-		batchNum      = int(math.Ceil(float64(leftToProcess) / float64(batchSize)))
-		wg            = sync.WaitGroup{}
-		mergeDoneC    = make(chan struct{})
-	)
+// fetchAll runs fetch for every job on the pool of at most
+// `workers` goroutines and waits until all of them return.
+// Failure of a single job does not affect the others,
+// remaining jobs are skipped only once ctx is done
+func (f *client) fetchAll(ctx context.Context, workers int, jobs [][]string, fetch func(context.Context, []string) ([]model.ExchangeRate, error)) []fetchResult {
+	results := make([]fetchResult, len(jobs))
 
-	go func() {
-		mergeCtx, mergeCanlceFn := context.WithTimeout(ctx, time.Second*3)
-		defer mergeCanlceFn()
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
 
-		f.mergeResults(mergeCtx, resultsC, cryptoToFiat)
-		for v, m := range cryptoToFiat {
-			for xx, r := range m {
-				log.Debug().Str(v, xx).Float64("rate", r).Msg("found rate")
-			}
+	for i := range jobs {
+		i := i
+
+		if gCtx.Err() != nil {
+			results[i].err = gCtx.Err()
+			continue
 		}
 
-		log.Debug().Msg("finished merging crypto pair results")
+		g.Go(func() error {
+			if err := gCtx.Err(); err != nil {
+				results[i].err = err
+				return err
+			}
 
-		mergeDoneC <- struct{}{}
-	}()
+			fetchCtx, cancelFn := context.WithTimeout(gCtx, f.fetchTimeout)
+			defer cancelFn()
 
-	go func() {
-		wg.Wait()
-		close(resultsC)
-		log.Debug().Msg("all crypto go routines completed")
-	}()
+			results[i].rates, results[i].err = fetch(fetchCtx, jobs[i])
+			return nil
+		})
+	}
 
-	start := 0
-	end := 0
+	// errors are kept per job, group fails
+	// only when parent ctx is done
+	_ = g.Wait()
 
-	log.Debug().Int("batchNum", batchNum).Msg("preparing batches to process")
+	return results
+}
 
-	wg.Add(batchNum)
-	for batchNum > 0 {
-		if leftToProcess > batchSize {
-			start = end
-			end = start + batchSize
-		} else {
-			start = end
-			end = start + leftToProcess
-		}
+// merge folds results of the jobs into rates lookup and errors of
+// individual pairs, error is returned only if every job failed
+func merge(jobs [][]string, results []fetchResult) (model.Rates, map[string]error, error) {
+	var (
+		rates    = make(model.Rates)
+		pairErrs = make(map[string]error)
+		failed   = 0
+		firstErr error
+	)
 
-		ctx, cancelFn := context.WithTimeout(ctx, time.Second*3)
-		defer cancelFn()
+	for i, res := range results {
+		if res.err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = res.err
+			}
 
-		if err := sem.Acquire(ctx, 1); err != nil {
-			log.Error().Err(err).Msg("unable to acquire semaphore")
-			return nil, err
+			for _, pair := range jobs[i] {
+				pairErrs[pair] = res.err
+			}
+			continue
 		}
 
-		go func(resultC chan model.ExchangeRate, from, to int) {
-			defer wg.Done()
-			defer sem.Release(1)
-
-			rates, err := f.GetCryptoRates(ctx, symbols[from:to])
-			if err != nil {
-				log.Error().Err(err).Str("pair", strings.Join(symbols[from:to], ",")).Msg("unable to fetch crypto rates")
-				return
+		for _, er := range res.rates {
+			if valid(er.Rate) {
+				rates.Put(er.Base.Symbol, er.Target.Symbol, er.Rate)
 			}
+		}
 
-			for i := 0; i < len(rates); i++ {
-				resultC <- rates[i]
+		// upstream silently omits pairs it does not know,
+		// pairs returned without valid rate fail as well
+		for _, pair := range jobs[i] {
+			tokens := strings.Split(pair, "/")
+			if _, ok := rates[tokens[0]][tokens[1]]; !ok {
+				pairErrs[pair] = fmt.Errorf("no rate returned for pair: %s", pair)
 			}
-
-		}(resultsC, start, end)
-
-		batchNum--
-		leftToProcess -= batchSize
+		}
 	}
 
-	// wait until all results from go routines are merged
-	<-mergeDoneC
+	if failed > 0 && failed == len(results) {
+		return rates, pairErrs, fmt.Errorf("all %d requests failed: %w", failed, firstErr)
+	}
 
-	return cryptoToFiat, nil
+	return rates, pairErrs, nil
 }
 
-func (f *client) mergeResults(ctx context.Context, resultsC chan model.ExchangeRate, storage map[string]map[string]float64) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
+func (f *client) getCryptoRates(ctx context.Context, pairs []string) (model.Rates, map[string]error, error) {
+	var jobs [][]string
 
-		case er, isOpen := <-resultsC:
-			if !isOpen {
-				break
-			}
-
-			if _, ok := storage[er.Base.Symbol]; !ok {
-				storage[er.Base.Symbol] = map[string]float64{er.Target.Symbol: er.Rate}
-				continue
-			}
-
-			storage[er.Base.Symbol][er.Target.Symbol] = er.Rate
+	for start := 0; start < len(pairs); start += cryptoBatchSize {
+		end := start + cryptoBatchSize
+		if end > len(pairs) {
+			end = len(pairs)
 		}
-	}
-}
-
-func (f *client) getFiatRates(ctx context.Context, fiatTargets map[string]string) (map[string]map[string]float64, error) {
-	var (
-		resultsC     = make(chan model.ExchangeRate)
-		fiatToCrypto = make(map[string]map[string]float64)
-		sem          = semaphore.NewWeighted(5)
-		wg           = sync.WaitGroup{}
-		mergeDoneC   = make(chan struct{})
-	)
 
-	go func() {
-		mergeCtx, mergeCanlceFn := context.WithTimeout(ctx, time.Second*3)
-		defer mergeCanlceFn()
+		jobs = append(jobs, pairs[start:end])
+	}
 
-		f.mergeResults(mergeCtx, resultsC, fiatToCrypto)
-		mergeDoneC <- struct{}{}
+	log.Ctx(ctx).Debug().Int("batchNum", len(jobs)).Msg("fetching crypto rates")
 
-	}()
+	results := f.fetchAll(ctx, cryptoWorkers, jobs, f.GetCryptoRates)
 
-	go func() {
-		wg.Wait()
-		close(resultsC)
-		log.Debug().Msg("fiat cache go routines compeleted")
-	}()
+	return merge(jobs, results)
+}
 
-	wg.Add(len(fiatTargets))
+func (f *client) getFiatRates(ctx context.Context, pairs []string) (model.Rates, map[string]error, error) {
+	jobs := make([][]string, 0, len(pairs))
+	for _, pair := range pairs {
+		jobs = append(jobs, []string{pair})
+	}
 
-	for fiatSymbol, cyrptoSymbol := range fiatTargets {
-		log.Debug().Str(fiatSymbol, cyrptoSymbol).Msg("fetching data")
+	log.Ctx(ctx).Debug().Int("pairs", len(jobs)).Msg("fetching fiat rates")
 
-		fetchCtx, cancelFn := context.WithTimeout(ctx, time.Second*3)
-		defer cancelFn()
+	results := f.fetchAll(ctx, fiatWorkers, jobs, func(ctx context.Context, pair []string) ([]model.ExchangeRate, error) {
+		tokens := strings.Split(pair[0], "/")
 
-		if err := sem.Acquire(fetchCtx, 1); err != nil {
-			log.Error().Err(err).Msg("unable to acquire semaphore")
+		rate, err := f.GetRate(ctx, tokens[0], tokens[1])
+		if err != nil {
 			return nil, err
 		}
 
-		go func(ctx context.Context, fs, cs string, resultC chan model.ExchangeRate) {
-			defer wg.Done()
-			defer sem.Release(1)
-
-			resp, err := f.GetRate(fetchCtx, fs, cs)
-			if err != nil {
-				log.Error().Err(err).Str("fiatSymbol", fs).Str("cryptoSymbol", cs).Msg("unable to fetch rate")
-				return
-			}
+		return []model.ExchangeRate{rate}, nil
+	})
 
-			log.Debug().Str(fs, cs).Msg("fetched data")
-			resultC <- resp
-
-		}(ctx, fiatSymbol, cyrptoSymbol, resultsC)
-	}
-
-	<-mergeDoneC
+	return merge(jobs, results)
+}
 
-	return fiatToCrypto, nil
+// GetAllRates implements service.Exchange.
+// Convenient method to fetch all exchange rates of the currencies
+func (f *client) GetAllRates(ctx context.Context, currencies []model.Currency) service.LookUp {
+	return f.GetPairRates(ctx, service.Pairs(currencies))
 }
 
-// GetRates implements service.Exchange.
-// Convenient method to fetch all exchange rates
-// for C2F and F2C
-func (f *client) GetAllRates(ctx context.Context, cryptos, fiats []model.Currency) service.LookUp {
+// GetPairRates implements service.Exchange.
+// Crypto and stablecoin prices in fiat are fetched
+// from crypto API, remaining pairs one by one
+func (f *client) GetPairRates(ctx context.Context, pairs []service.Pair) service.LookUp {
 	var (
-		// all possible combinations of CCC/FFF
-		cryptoCombos []string
-		// all possible cryptos that will be
-		// quried for given fiat
-		fiatTargets = make(map[string]string)
-		// final response
-		result service.LookUp
-		// lookup map for fiat to crypto rates
-		fiatToCryptoRates map[string]map[string]float64
-		fiatFetchErr      error
-		// lookup map for crypto to fiat rates
-		cryptoToFiatRates map[string]map[string]float64
-		cryptoFetchErr    error
+		// pairs served by crypto API, e.g. BTC/USD
+		cryptoPairs []string
+		// pairs fetched one by one, e.g. USD/BTC or XAU/USD
+		fiatPairs []string
+		// rates of every group
+		cryptoRates, fiatRates model.Rates
+		// errors of individual pairs
+		cryptoPairErrs, fiatPairErrs map[string]error
+		// errors of the groups
+		cryptoErr, fiatErr error
 	)
 
-	for _, fiat := range fiats {
-		for _, crypto := range cryptos {
-			// for each fiat we will issue request to fetch rate for given crypto
-			fiatTargets[fiat.Symbol] = crypto.Symbol
-			// create combinations of CCC/FFF and issue 10 pair for each request
-			cryptoCombos = append(cryptoCombos, crypto.Symbol+"/"+fiat.Symbol)
+	for _, pair := range pairs {
+		if pair.Target.CurrencyType == model.Fiat && isCryptoPriced(pair.Base) {
+			cryptoPairs = append(cryptoPairs, pair.String())
+		} else {
+			fiatPairs = append(fiatPairs, pair.String())
 		}
 	}
 
-	wg := sync.WaitGroup{}
+	// both groups share the rate limiter
+	requests := len(fiatPairs) + (len(cryptoPairs)+cryptoBatchSize-1)/cryptoBatchSize
+	lookupTimeout := f.lookupBudget(requests)
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	g := errgroup.Group{}
 
-		fiatCtx, fiatCancelFn := context.WithTimeout(ctx, time.Second*5)
+	g.Go(func() error {
+		fiatCtx, fiatCancelFn := context.WithTimeout(ctx, lookupTimeout)
 		defer fiatCancelFn()
 
-		if fiatToCryptoRates, fiatFetchErr = f.getFiatRates(fiatCtx, fiatTargets); fiatFetchErr != nil {
-			result.FiatLookupErr = fiatFetchErr
-		}
-	}()
+		fiatRates, fiatPairErrs, fiatErr = f.getFiatRates(fiatCtx, fiatPairs)
+		return nil
+	})
+
+	g.Go(func() error {
+		cryptoCtx, cryptoCancelFn := context.WithTimeout(ctx, lookupTimeout)
+		defer cryptoCancelFn()
+
+		cryptoRates, cryptoPairErrs, cryptoErr = f.getCryptoRates(cryptoCtx, cryptoPairs)
+		return nil
+	})
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		cryptoCtx, cryptoCanelFn := context.WithTimeout(ctx, time.Second*5)
-		defer cryptoCanelFn()
+	_ = g.Wait()
 
-		if cryptoToFiatRates, cryptoFetchErr = f.getCryptoRates(cryptoCtx, cryptoCombos); cryptoFetchErr != nil {
-			result.CryptoLookupErr = cryptoFetchErr
+	result := service.LookUp{
+		Rates:      make(model.Rates),
+		PairErrors: make(map[string]error, len(fiatPairErrs)+len(cryptoPairErrs)),
+	}
+
+	for _, rates := range []model.Rates{fiatRates, cryptoRates} {
+		for base, targets := range rates {
+			for target, rate := range targets {
+				result.Rates.Put(base, target, rate)
+			}
 		}
-	}()
+	}
 
-	wg.Wait()
-	result.CryptoToFiat = cryptoToFiatRates
-	result.FiatToCrypto = fiatToCryptoRates
+	for pair, err := range fiatPairErrs {
+		result.PairErrors[pair] = err
+	}
+	for pair, err := range cryptoPairErrs {
+		result.PairErrors[pair] = err
+	}
 
-	log.Debug().Msg("obtained rates for symbols")
+	if len(result.Rates) == 0 && len(result.PairErrors) > 0 {
+		result.LookupErr = errors.Join(fiatErr, cryptoErr)
+		if result.LookupErr == nil {
+			result.LookupErr = fmt.Errorf("no rate obtained for %d pairs", len(result.PairErrors))
+		}
+	}
+
+	log.Ctx(ctx).Debug().Int("failedPairs", len(result.PairErrors)).Msg("obtained rates for symbols")
 	return result
 }
 
+// lookupBudget returns timeout of the lookup making given number
+// of requests, requests past the burst of the rate limiter wait
+// for their turn on top of lookupTimeout
+func (f *client) lookupBudget(requests int) time.Duration {
+	limit := f.rateLimiter.Limit()
+	queued := requests - f.rateLimiter.Burst()
+
+	if limit == rate.Inf || limit <= 0 || queued <= 0 {
+		return f.lookupTimeout
+	}
+
+	return f.lookupTimeout + time.Duration(float64(queued)/float64(limit)*float64(time.Second))
+}
+
+// valid reports whether rate returned by upstream can be served
+func valid(rate float64) bool {
+	return rate > 0 && !math.IsInf(rate, 0)
+}
+
+// isCryptoPriced reports whether fiat price
+// of the currency is served by crypto API
+func isCryptoPriced(c model.Currency) bool {
+	return c.CurrencyType == model.Crypto || c.CurrencyType == model.Stablecoin
+}
+
 type roundTripperFn func(*http.Request) (*http.Response, error)
 
 func (fn roundTripperFn) RoundTrip(r *http.Request) (*http.Response, error) {
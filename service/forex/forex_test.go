@@ -0,0 +1,638 @@
+package forex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/internal/telemetry"
+	"github.com/kylycht/exchange/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/goleak"
+	"golang.org/x/time/rate"
+)
+
+// testServer mimics fastforex API
+type testServer struct {
+	rates    map[string]float64 // rates keyed by BASE/TARGET
+	failing  map[string]bool    // pairs answered with 500
+	delay    time.Duration      // delay of every response
+	lock     sync.Mutex         // guards requests
+	requests []string           // pairs requested
+	parents  []string           // traceparent headers received
+	inFlight atomic.Int32       // requests currently processed
+	maxLoad  atomic.Int32       // max requests processed simultaneously
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	load := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	for {
+		max := s.maxLoad.Load()
+		if load <= max || s.maxLoad.CompareAndSwap(max, load) {
+			break
+		}
+	}
+
+	s.lock.Lock()
+	s.parents = append(s.parents, r.Header.Get("traceparent"))
+	s.lock.Unlock()
+
+	if r.URL.Query().Get("api_key") != "key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	select {
+	case <-time.After(s.delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	query := r.URL.Query()
+
+	switch r.URL.Path {
+	case "/fetch-one":
+		from, to := query.Get("from"), query.Get("to")
+		pair := from + "/" + to
+		s.record(pair)
+
+		rate, ok := s.rates[pair]
+		if !ok || s.failing[pair] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Base: from, Results: map[string]float64{to: rate}})
+
+	case "/crypto/fetch-prices":
+		pairs := strings.Split(query.Get("pairs"), ",")
+		prices := make(map[string]float64)
+
+		for _, pair := range pairs {
+			s.record(pair)
+
+			if s.failing[pair] {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if rate, ok := s.rates[pair]; ok {
+				prices[pair] = rate
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"prices": prices})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *testServer) record(pair string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, pair)
+}
+
+func (s *testServer) traceParents() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.parents...)
+}
+
+func (s *testServer) requested() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func closeIdleConnections() {
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+}
+
+func newTestClient(t *testing.T, s *testServer) *client {
+	t.Helper()
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() {
+		srv.Close()
+		closeIdleConnections()
+	})
+
+	exchange, err := New("key", WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := exchange.(*client)
+	c.rateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	return c
+}
+
+// newRawClient creates client of the API answered by handler
+func newRawClient(t *testing.T, handler http.HandlerFunc) *client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		srv.Close()
+		closeIdleConnections()
+	})
+
+	exchange, err := New("key", WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := exchange.(*client)
+	c.rateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	return c
+}
+
+func cryptoPairs(n int) ([]string, map[string]float64) {
+	pairs := make([]string, 0, n)
+	rates := make(map[string]float64, n)
+
+	for i := 0; i < n; i++ {
+		pair := fmt.Sprintf("C%d/USD", i)
+		pairs = append(pairs, pair)
+		rates[pair] = float64(i + 1)
+	}
+
+	return pairs, rates
+}
+
+func TestWithBaseURL(t *testing.T) {
+	exchange, err := New("key", WithBaseURL("http://localhost:8080/api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := exchange.(*client).baseURL.Parse("fetch-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.String() != "http://localhost:8080/api/fetch-one" {
+		t.Errorf("unexpected url: %s", u)
+	}
+}
+
+func TestGetRate(t *testing.T) {
+	c := newTestClient(t, &testServer{rates: map[string]float64{"USD/BTC": 0.00002}})
+
+	r, err := c.GetRate(context.Background(), "USD", "BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Base.Symbol != "USD" || r.Target.Symbol != "BTC" || r.Rate != 0.00002 {
+		t.Errorf("unexpected rate: %+v", r)
+	}
+
+	if r.Base.CurrencyType != model.Fiat || r.Target.CurrencyType != model.Crypto {
+		t.Errorf("unexpected currency types: %+v", r)
+	}
+}
+
+func TestGetRateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  *testServer
+		timeout time.Duration
+	}{
+		{"status code", &testServer{}, time.Second},
+		{"timeout", &testServer{rates: map[string]float64{"USD/BTC": 1}, delay: time.Second}, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.server)
+
+			ctx, cancelFn := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancelFn()
+
+			if _, err := c.GetRate(ctx, "USD", "BTC"); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestGetRateMissing(t *testing.T) {
+	tests := []struct {
+		name    string
+		results map[string]float64
+	}{
+		{"missing", map[string]float64{"ETH": 0.0003}},
+		{"zero", map[string]float64{"BTC": 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRawClient(t, func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(Response{Base: "USD", Results: tt.results})
+			})
+
+			if _, err := c.GetRate(context.Background(), "USD", "BTC"); err == nil {
+				t.Fatal("expected error when rate is not returned")
+			}
+		})
+	}
+}
+
+func TestGetCryptoRatesMalformed(t *testing.T) {
+	c := newRawClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"prices": map[string]float64{"BTCUSD": 1, "BTC/USD": 60000}})
+	})
+
+	rates, err := c.GetCryptoRates(context.Background(), []string{"BTC/USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 1 || rates[0].Rate != 60000 {
+		t.Errorf("expected malformed pair to be skipped, got %+v", rates)
+	}
+}
+
+func TestLookupBudget(t *testing.T) {
+	c := &client{rateLimiter: rate.NewLimiter(rate.Every(time.Second), 10), lookupTimeout: time.Second * 5}
+
+	for requests, want := range map[int]time.Duration{0: time.Second * 5, 10: time.Second * 5, 40: time.Second * 35} {
+		if got := c.lookupBudget(requests); got != want {
+			t.Errorf("%d requests: expected %s, got %s", requests, want, got)
+		}
+	}
+}
+
+func TestGetCryptoRates(t *testing.T) {
+	c := newTestClient(t, &testServer{rates: map[string]float64{"BTC/USD": 60000, "ETH/USD": 3000}})
+
+	rates, err := c.GetCryptoRates(context.Background(), []string{"BTC/USD", "ETH/USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 2 {
+		t.Fatalf("expected 2 rates, got %d", len(rates))
+	}
+
+	for _, r := range rates {
+		if r.Base.CurrencyType != model.Crypto || r.Target.CurrencyType != model.Fiat {
+			t.Errorf("unexpected currency types: %+v", r)
+		}
+	}
+}
+
+func TestGetCryptoRatesBatching(t *testing.T) {
+	pairs, rates := cryptoPairs(5)
+	s := &testServer{rates: rates}
+	c := newTestClient(t, s)
+
+	result, pairErrs, err := c.getCryptoRates(context.Background(), pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != len(pairs) || len(pairErrs) != 0 {
+		t.Fatalf("expected %d rates and no errors, got %d rates and %v", len(pairs), len(result), pairErrs)
+	}
+
+	// every pair is requested separately
+	if requested := s.requested(); len(requested) != len(pairs) {
+		t.Errorf("expected %d requests, got %d", len(pairs), len(requested))
+	}
+
+	for i := range pairs {
+		base := fmt.Sprintf("C%d", i)
+		if result[base]["USD"] != float64(i+1) {
+			t.Errorf("expected %s rate %d, got %f", base, i+1, result[base]["USD"])
+		}
+	}
+}
+
+func TestSemaphoreLimits(t *testing.T) {
+	t.Run("crypto", func(t *testing.T) {
+		pairs, rates := cryptoPairs(60)
+		s := &testServer{rates: rates, delay: 20 * time.Millisecond}
+		c := newTestClient(t, s)
+
+		if _, _, err := c.getCryptoRates(context.Background(), pairs); err != nil {
+			t.Fatal(err)
+		}
+
+		if max := s.maxLoad.Load(); max > 30 || max < 2 {
+			t.Errorf("expected between 2 and 30 concurrent requests, got %d", max)
+		}
+	})
+
+	t.Run("fiat", func(t *testing.T) {
+		var pairs []string
+		rates := make(map[string]float64)
+
+		for i := 0; i < 20; i++ {
+			pair := fmt.Sprintf("F%d/BTC", i)
+			pairs = append(pairs, pair)
+			rates[pair] = float64(i + 1)
+		}
+
+		s := &testServer{rates: rates, delay: 20 * time.Millisecond}
+		c := newTestClient(t, s)
+
+		result, _, err := c.getFiatRates(context.Background(), pairs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != len(pairs) {
+			t.Errorf("expected %d rates, got %d", len(pairs), len(result))
+		}
+
+		if max := s.maxLoad.Load(); max > 5 || max < 2 {
+			t.Errorf("expected between 2 and 5 concurrent requests, got %d", max)
+		}
+	})
+}
+
+func TestPartialFailures(t *testing.T) {
+	pairs, rates := cryptoPairs(4)
+	delete(rates, "C2/USD")
+	s := &testServer{rates: rates, failing: map[string]bool{"C1/USD": true, "C3/USD": true}}
+	c := newTestClient(t, s)
+
+	result, pairErrs, err := c.getCryptoRates(context.Background(), pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 1 || result["C0"]["USD"] != 1 {
+		t.Fatalf("expected only C0 rate, got %v", result)
+	}
+
+	// failed and omitted pairs are reported
+	for _, pair := range []string{"C1/USD", "C2/USD", "C3/USD"} {
+		if pairErrs[pair] == nil {
+			t.Errorf("expected error for pair %s", pair)
+		}
+	}
+
+	if len(pairErrs) != 3 {
+		t.Errorf("expected 3 pair errors, got %v", pairErrs)
+	}
+}
+
+func TestAllFailed(t *testing.T) {
+	pairs, rates := cryptoPairs(3)
+	s := &testServer{rates: rates, failing: map[string]bool{"C0/USD": true, "C1/USD": true, "C2/USD": true}}
+	c := newTestClient(t, s)
+
+	_, pairErrs, err := c.getCryptoRates(context.Background(), pairs)
+	if err == nil {
+		t.Fatal("expected error when every batch failed")
+	}
+
+	if len(pairErrs) != len(pairs) {
+		t.Errorf("expected %d pair errors, got %d", len(pairs), len(pairErrs))
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	pairs, rates := cryptoPairs(3)
+	s := &testServer{rates: rates, delay: time.Second}
+	c := newTestClient(t, s)
+	c.fetchTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+
+	result, pairErrs, err := c.getCryptoRates(context.Background(), pairs)
+	if err == nil {
+		t.Error("expected error when every batch timed out")
+	}
+
+	if len(result) != 0 || len(pairErrs) != len(pairs) {
+		t.Errorf("expected no rates and %d errors, got %d rates and %d errors", len(pairs), len(result), len(pairErrs))
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected fetch to time out, took %s", elapsed)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	pairs, rates := cryptoPairs(100)
+	s := &testServer{rates: rates, delay: time.Second}
+	srv := httptest.NewServer(s)
+
+	exchange, err := New("key", WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := exchange.(*client)
+	c.rateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelFn()
+
+	start := time.Now()
+
+	_, pairErrs, err := c.getCryptoRates(ctx, pairs)
+	if err == nil {
+		t.Error("expected error after cancellation")
+	}
+
+	if len(pairErrs) != len(pairs) {
+		t.Errorf("expected every pair to fail, got %d errors", len(pairErrs))
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected pipeline to stop after cancellation, took %s", elapsed)
+	}
+
+	srv.Close()
+	closeIdleConnections()
+
+	// no worker may outlive the pipeline
+	goleak.VerifyNone(t)
+}
+
+func TestMerge(t *testing.T) {
+	jobs := [][]string{{"BTC/USD", "BTC/EUR"}, {"ETH/USD"}}
+
+	results := []fetchResult{
+		{rates: []model.ExchangeRate{
+			{Base: model.Currency{Symbol: "BTC"}, Target: model.Currency{Symbol: "USD"}, Rate: 1},
+			{Base: model.Currency{Symbol: "BTC"}, Target: model.Currency{Symbol: "EUR"}, Rate: 0},
+		}},
+		{err: errors.New("upstream is down")},
+	}
+
+	rates, pairErrs, err := merge(jobs, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rates["BTC"]["USD"] != 1 || len(rates) != 1 {
+		t.Errorf("unexpected rates: %v", rates)
+	}
+
+	// BTC/EUR is returned without valid rate, ETH/USD failed
+	if pairErrs["BTC/EUR"] == nil || pairErrs["ETH/USD"] == nil || len(pairErrs) != 2 {
+		t.Errorf("unexpected pair errors: %v", pairErrs)
+	}
+}
+
+func TestGetAllRates(t *testing.T) {
+	s := &testServer{rates: map[string]float64{
+		"BTC/USD": 60000, "BTC/EUR": 55000,
+		"USD/BTC": 0.00002, "EUR/BTC": 0.000018,
+	}}
+	c := newTestClient(t, s)
+
+	lookup := c.GetAllRates(context.Background(), []model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+		{Symbol: "EUR", CurrencyType: model.Fiat},
+	})
+
+	if lookup.LookupErr != nil {
+		t.Fatal(lookup.LookupErr)
+	}
+
+	if lookup.Rates["BTC"]["EUR"] != 55000 {
+		t.Errorf("expected C2F rate 55000, got %f", lookup.Rates["BTC"]["EUR"])
+	}
+
+	if lookup.Rates["EUR"]["BTC"] != 0.000018 {
+		t.Errorf("expected F2C rate 0.000018, got %f", lookup.Rates["EUR"]["BTC"])
+	}
+
+	if len(lookup.PairErrors) != 0 {
+		t.Errorf("expected no pair errors, got %v", lookup.PairErrors)
+	}
+}
+
+func TestGetAllRatesEveryCryptoPerFiat(t *testing.T) {
+	s := &testServer{rates: map[string]float64{
+		"BTC/USD": 60000, "ETH/USD": 3000,
+		"USD/BTC": 0.00002, "USD/ETH": 0.0003,
+	}}
+	c := newTestClient(t, s)
+
+	lookup := c.GetAllRates(context.Background(), []model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto},
+		{Symbol: "ETH", CurrencyType: model.Crypto},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+	})
+
+	if len(lookup.Rates["USD"]) != 2 {
+		t.Errorf("expected F2C rates for every crypto, got %v", lookup.Rates["USD"])
+	}
+}
+
+func TestGetAllRatesCurrencyTypes(t *testing.T) {
+	s := &testServer{rates: map[string]float64{
+		"XAU/USD": 2300, "USD/XAU": 1.0 / 2300,
+		"USDT/USD": 1, "USD/USDT": 1,
+	}}
+	c := newTestClient(t, s)
+
+	lookup := c.GetAllRates(context.Background(), []model.Currency{
+		{Symbol: "XAU", CurrencyType: model.Metal},
+		{Symbol: "USDT", CurrencyType: model.Stablecoin},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+	})
+
+	if lookup.LookupErr != nil || len(lookup.PairErrors) != 0 {
+		t.Fatal(lookup.LookupErr, lookup.PairErrors)
+	}
+
+	if lookup.Rates["XAU"]["USD"] != 2300 || lookup.Rates["USDT"]["USD"] != 1 {
+		t.Errorf("unexpected rates: %v", lookup.Rates)
+	}
+}
+
+func TestGetAllRatesFailure(t *testing.T) {
+	s := &testServer{}
+	c := newTestClient(t, s)
+
+	lookup := c.GetAllRates(context.Background(), []model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+	})
+
+	if lookup.LookupErr == nil {
+		t.Error("expected lookup error when every pair failed")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	telemetry.Configure(nil, 1)
+
+	s := &testServer{rates: map[string]float64{"BTC/USD": 60000}, failing: map[string]bool{"ETH/USD": true}}
+	c := newTestClient(t, s)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "refresh")
+	c.GetCryptoRates(ctx, []string{"BTC/USD"})
+	c.GetCryptoRates(ctx, []string{"ETH/USD"})
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 2 request spans and parent, got %d", len(spans))
+	}
+
+	for i, span := range spans[:2] {
+		if span.Name != "forex /crypto/fetch-prices" || span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("unexpected span %s of parent %s", span.Name, span.Parent.SpanID())
+		}
+
+		attributes := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			attributes[kv.Key] = kv.Value
+		}
+
+		status := []int64{http.StatusOK, http.StatusInternalServerError}[i]
+		if attributes["http.status_code"].AsInt64() != status || attributes["forex.batch_size"].AsInt64() != 1 {
+			t.Errorf("expected status %d of single pair batch, got %v", status, span.Attributes)
+		}
+
+		if failed := span.Status.Code == codes.Error; failed != (i == 1) {
+			t.Errorf("unexpected span status %v", span.Status)
+		}
+
+		// trace context is propagated to the API
+		traceParent := fmt.Sprintf("00-%s-%s-01", span.SpanContext.TraceID(), span.SpanContext.SpanID())
+		if parents := s.traceParents(); parents[i] != traceParent {
+			t.Errorf("expected traceparent %s, got %s", traceParent, parents[i])
+		}
+	}
+}
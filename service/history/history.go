@@ -0,0 +1,90 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultInterval = time.Hour
+	saveTimeout     = time.Second * 30
+)
+
+// Archiver persists cache snapshots for
+// historical lookups, at most once per interval
+type Archiver struct {
+	cache     storage.Cache          // cache provider for rates
+	history   storage.HistoryStorage // persistence provider for snapshots
+	interval  time.Duration          // min time between two saved snapshots
+	savedAt   time.Time              // time of the latest saved snapshot
+	doneC     chan struct{}          // chan to signal archiver stoppage
+	stoppedC  chan struct{}          // chan closed once archiver stopped
+	closeOnce sync.Once              // guards doneC from being closed twice
+}
+
+func New(cache storage.Cache, history storage.HistoryStorage, interval time.Duration) *Archiver {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	a := &Archiver{
+		cache:    cache,
+		history:  history,
+		interval: interval,
+		doneC:    make(chan struct{}),
+		stoppedC: make(chan struct{}),
+	}
+
+	updatesC, cancelFn := cache.Subscribe()
+
+	go func() {
+		defer close(a.stoppedC)
+		defer cancelFn()
+
+		// cache is already populated on creation
+		a.save()
+
+		for {
+			select {
+			case <-a.doneC:
+				return
+
+			case <-updatesC:
+				a.save()
+			}
+		}
+	}()
+
+	return a
+}
+
+// Close stops archiving and waits for
+// the pending save to complete
+func (a *Archiver) Close() {
+	a.closeOnce.Do(func() {
+		close(a.doneC)
+	})
+
+	<-a.stoppedC
+}
+
+func (a *Archiver) save() {
+	snapshot := a.cache.Snapshot()
+	if snapshot.Timestamp.IsZero() || snapshot.Timestamp.Sub(a.savedAt) < a.interval {
+		return
+	}
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancelFn()
+
+	if err := a.history.SaveSnapshot(ctx, snapshot); err != nil {
+		log.Error().Err(err).Time("takenAt", snapshot.Timestamp).Msg("unable to save rates snapshot")
+		return
+	}
+
+	a.savedAt = snapshot.Timestamp
+}
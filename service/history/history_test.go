@@ -0,0 +1,82 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/internal/fake"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	cache := fake.NewCache(nil)
+	cache.SetRate("BTC", "USD", 60000)
+
+	history := fake.NewHistoryStorage()
+	a := New(cache, history, time.Millisecond*50)
+	defer a.Close()
+
+	// initial snapshot is saved right away
+	waitFor(t, func() bool { return len(history.Snapshots()) == 1 })
+
+	// refresh within the interval is skipped
+	cache.SetRate("BTC", "USD", 61000)
+	if saved := len(history.Snapshots()); saved != 1 {
+		t.Fatalf("expected single snapshot, got %d", saved)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	cache.SetRate("BTC", "USD", 62000)
+
+	waitFor(t, func() bool { return len(history.Snapshots()) == 2 })
+
+	snapshots := history.Snapshots()
+	if rate := snapshots[0].Rates["BTC"]["USD"]; rate != 60000 {
+		t.Errorf("expected first snapshot rate 60000, got %f", rate)
+	}
+
+	if rate := snapshots[1].Rates["BTC"]["USD"]; rate != 62000 {
+		t.Errorf("expected second snapshot rate 62000, got %f", rate)
+	}
+}
+
+func TestArchiverSkipsEmptyCache(t *testing.T) {
+	history := fake.NewHistoryStorage()
+	a := New(fake.NewCache(nil), history, time.Millisecond)
+	a.Close()
+	a.Close()
+
+	if saved := len(history.Snapshots()); saved != 0 {
+		t.Fatalf("expected no snapshots, got %d", saved)
+	}
+}
+
+func TestArchiverRetriesAfterFailure(t *testing.T) {
+	cache := fake.NewCache(nil)
+	cache.SetRate("BTC", "USD", 60000)
+
+	history := fake.NewHistoryStorage()
+	history.SetErr(errors.New("db is down"))
+
+	a := New(cache, history, time.Hour)
+	defer a.Close()
+
+	// failed save does not count towards the interval
+	cache.SetRate("BTC", "USD", 61000)
+	history.SetErr(nil)
+	cache.SetRate("BTC", "USD", 62000)
+
+	waitFor(t, func() bool { return len(history.Snapshots()) == 1 })
+}
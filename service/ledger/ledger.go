@@ -0,0 +1,192 @@
+package ledger
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultBufferSize    int           = 1024        // records queued before new ones are dropped
+	defaultBatchSize     int           = 100         // records persisted in a single write
+	defaultFlushInterval time.Duration = time.Second // max time record stays in the batch
+	saveTimeout          time.Duration = time.Second * 5
+)
+
+// Writer persists conversion records asynchronously,
+// records are batched by size or flush interval.
+// Records which failed to be saved are kept and retried
+// every flush interval, up to the buffer size of them
+type Writer struct {
+	lock          sync.RWMutex                // guards recordC from being written after close
+	closed        bool                        // closed is set once writer stops accepting records
+	recordC       chan model.ConversionRecord // buffered queue of pending records
+	ledger        storage.LedgerStorage       // persistence provider for records
+	batchSize     int                         // records persisted in a single write
+	flushInterval time.Duration               // max time record stays in the batch
+	maxPending    int                         // records kept for retry, the oldest are dropped first
+	doneC         chan struct{}               // chan to signal all records were flushed
+	closeOnce     sync.Once                   // guards recordC from being closed twice
+}
+
+// Option configures the writer
+type Option func(*Writer)
+
+// WithBufferSize sets number of records queued
+// before new ones are dropped
+func WithBufferSize(size int) Option {
+	return func(w *Writer) {
+		if size > 0 {
+			w.recordC = make(chan model.ConversionRecord, size)
+		}
+	}
+}
+
+// WithBatchSize sets number of records
+// persisted in a single write
+func WithBatchSize(size int) Option {
+	return func(w *Writer) {
+		if size > 0 {
+			w.batchSize = size
+		}
+	}
+}
+
+// WithFlushInterval sets max time
+// record stays in the batch
+func WithFlushInterval(interval time.Duration) Option {
+	return func(w *Writer) {
+		if interval > 0 {
+			w.flushInterval = interval
+		}
+	}
+}
+
+func NewWriter(ledger storage.LedgerStorage, opts ...Option) *Writer {
+	w := &Writer{
+		recordC:       make(chan model.ConversionRecord, defaultBufferSize),
+		ledger:        ledger,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		doneC:         make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	w.maxPending = cap(w.recordC)
+	if w.maxPending < w.batchSize {
+		w.maxPending = w.batchSize
+	}
+
+	go w.run()
+
+	return w
+}
+
+var _ service.Recorder = (*Writer)(nil)
+
+// Record implements service.Recorder.
+// Record is dropped when the buffer is full
+// or the writer is closed
+func (w *Writer) Record(record model.ConversionRecord) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	if w.closed {
+		log.Warn().Str("requestID", record.RequestID).Msg("ledger is closed, dropping conversion record")
+		return
+	}
+
+	select {
+	case w.recordC <- record:
+	default:
+		log.Warn().Str("requestID", record.RequestID).Msg("ledger buffer is full, dropping conversion record")
+	}
+}
+
+// Close stops accepting records and
+// waits until queued ones are flushed
+func (w *Writer) Close() {
+	w.closeOnce.Do(func() {
+		w.lock.Lock()
+		w.closed = true
+		close(w.recordC)
+		w.lock.Unlock()
+	})
+
+	<-w.doneC
+}
+
+func (w *Writer) run() {
+	defer close(w.doneC)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	var (
+		pending = make([]model.ConversionRecord, 0, w.batchSize)
+		err     error // error of the latest flush, full batches wait for the retry
+	)
+
+	for {
+		select {
+		case record, ok := <-w.recordC:
+			if !ok {
+				if pending, _ = w.flush(pending); len(pending) > 0 {
+					log.Error().Int("records", len(pending)).Msg("ledger is closed, dropping unsaved conversion records")
+				}
+				return
+			}
+
+			pending = append(pending, record)
+
+			if excess := len(pending) - w.maxPending; excess > 0 {
+				log.Warn().Int("records", excess).Msg("ledger is unavailable, dropping the oldest conversion records")
+				pending = append(pending[:0], pending[excess:]...)
+			}
+
+			if err == nil && len(pending) >= w.batchSize {
+				pending, err = w.flush(pending)
+			}
+
+		case <-ticker.C:
+			pending, err = w.flush(pending)
+		}
+	}
+}
+
+// flush saves pending records in batches and
+// returns records left unsaved by the failed batch
+func (w *Writer) flush(pending []model.ConversionRecord) ([]model.ConversionRecord, error) {
+	saved := 0
+
+	for saved < len(pending) {
+		batch := pending[saved:]
+		if len(batch) > w.batchSize {
+			batch = batch[:w.batchSize]
+		}
+
+		if err := w.save(batch); err != nil {
+			log.Error().Err(err).Int("records", len(pending)-saved).Msg("unable to save conversion records, retrying")
+			return append(pending[:0], pending[saved:]...), err
+		}
+
+		saved += len(batch)
+	}
+
+	return pending[:0], nil
+}
+
+func (w *Writer) save(batch []model.ConversionRecord) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancelFn()
+
+	return w.ledger.SaveConversions(ctx, batch)
+}
@@ -0,0 +1,144 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+)
+
+func records(n int) []model.ConversionRecord {
+	result := make([]model.ConversionRecord, n)
+	for i := range result {
+		result[i] = model.ConversionRecord{RequestID: fmt.Sprintf("req-%d", i), From: "BTC", To: "USD"}
+	}
+
+	return result
+}
+
+func TestWriterFlushOnClose(t *testing.T) {
+	store := fake.NewLedgerStorage()
+	w := NewWriter(store, WithBatchSize(3), WithFlushInterval(time.Hour))
+
+	for _, r := range records(7) {
+		w.Record(r)
+	}
+
+	w.Close()
+
+	saved := store.Records()
+	if len(saved) != 7 {
+		t.Fatalf("expected 7 records, got %d", len(saved))
+	}
+
+	for i, r := range saved {
+		if want := fmt.Sprintf("req-%d", i); r.RequestID != want {
+			t.Errorf("expected %s at %d, got %s", want, i, r.RequestID)
+		}
+	}
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	store := fake.NewLedgerStorage()
+	w := NewWriter(store, WithBatchSize(100), WithFlushInterval(time.Millisecond*10))
+	defer w.Close()
+
+	w.Record(records(1)[0])
+
+	deadline := time.Now().Add(time.Second)
+	for len(store.Records()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("record was not flushed within interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingStore holds writes until released
+type blockingStore struct {
+	*fake.LedgerStorage
+	releaseC chan struct{}
+}
+
+func (s *blockingStore) SaveConversions(ctx context.Context, records []model.ConversionRecord) error {
+	<-s.releaseC
+	return s.LedgerStorage.SaveConversions(ctx, records)
+}
+
+func TestWriterDropsWhenFull(t *testing.T) {
+	store := &blockingStore{LedgerStorage: fake.NewLedgerStorage(), releaseC: make(chan struct{})}
+	w := NewWriter(store, WithBufferSize(2), WithBatchSize(1), WithFlushInterval(time.Hour))
+
+	// at most one record is held by the blocked
+	// write, the rest either fits the buffer or is dropped
+	for _, r := range records(100) {
+		w.Record(r)
+	}
+
+	close(store.releaseC)
+	w.Close()
+
+	if saved := len(store.Records()); saved < 2 || saved > 3 {
+		t.Fatalf("expected 2 or 3 records to be saved, got %d", saved)
+	}
+}
+
+func TestWriterRecordAfterClose(t *testing.T) {
+	store := fake.NewLedgerStorage()
+	w := NewWriter(store)
+	w.Close()
+	w.Close()
+
+	w.Record(records(1)[0])
+
+	if saved := len(store.Records()); saved != 0 {
+		t.Fatalf("expected no records, got %d", saved)
+	}
+}
+
+func TestWriterSaveError(t *testing.T) {
+	store := fake.NewLedgerStorage()
+	store.Err = errors.New("db is down")
+
+	w := NewWriter(store)
+	w.Record(records(1)[0])
+	w.Close()
+
+	if saved := len(store.Records()); saved != 0 {
+		t.Fatalf("expected no records, got %d", saved)
+	}
+}
+
+func TestWriterRetry(t *testing.T) {
+	store := fake.NewLedgerStorage()
+	store.Err = errors.New("db is down")
+
+	w := NewWriter(store, WithBatchSize(2), WithBufferSize(3), WithFlushInterval(10*time.Millisecond))
+	defer w.Close()
+
+	// the oldest record is dropped once retained records exceed the buffer
+	for _, record := range records(4) {
+		w.Record(record)
+
+		for len(w.recordC) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	store.SetErr(nil)
+
+	deadline := time.Now().Add(time.Second)
+	for len(store.Records()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	saved := store.Records()
+	if len(saved) != 3 || saved[0].RequestID != "req-1" || saved[2].RequestID != "req-3" {
+		t.Fatalf("expected the latest 3 records saved once recovered, got %+v", saved)
+	}
+}
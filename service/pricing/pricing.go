@@ -0,0 +1,267 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	refreshInterval = time.Minute
+	maxUnits        = 1 << 53 // max amount in minor units represented exactly by float64
+	maxSearchUnits  = 1e12    // max estimate in minor units, leaves room for float errors
+)
+
+var (
+	// ErrInvalidAmount is returned for non positive amounts
+	ErrInvalidAmount = errors.New("amount must be positive")
+	// ErrAmountTooSmall is returned when fees exceed the gross amount
+	ErrAmountTooSmall = errors.New("amount is too small to cover fees")
+	// ErrTargetUnreachable is returned when no amount covers the target after fees
+	ErrTargetUnreachable = errors.New("target amount can not be reached")
+)
+
+// Engine prices conversions on top of the cached
+// mid rates using rules loaded from persistence
+type Engine struct {
+	lock           sync.RWMutex           // guards rules
+	rules          []model.PricingRule    // pricing rules
+	cache          storage.Cache          // cache provider for mid rates
+	pricingStorage storage.PricingStorage // persistence provider for rules
+	ticker         *time.Ticker           // ticker to reload rules every X interval
+	doneC          chan struct{}          // chan to signal ticker stoppage
+	closeOnce      sync.Once              // guards doneC from being closed twice
+}
+
+func New(cache storage.Cache, pricingStorage storage.PricingStorage) (*Engine, error) {
+	e := &Engine{
+		cache:          cache,
+		pricingStorage: pricingStorage,
+		doneC:          make(chan struct{}),
+	}
+
+	return e, e.init()
+}
+
+var _ service.Pricer = (*Engine)(nil)
+
+// Close stops periodic reload of the rules
+func (e *Engine) Close() {
+	e.closeOnce.Do(func() {
+		if e.ticker != nil {
+			e.ticker.Stop()
+		}
+		close(e.doneC)
+	})
+}
+
+// Convert implements service.Pricer.
+func (e *Engine) Convert(ctx context.Context, from, to string, amount float64) (model.Conversion, error) {
+	if amount <= 0 || math.IsInf(amount, 0) || math.IsNaN(amount) {
+		return model.Conversion{}, ErrInvalidAmount
+	}
+
+	rateInfo, err := e.cache.Get(ctx, storage.Pair{From: from, To: to})
+	if err != nil {
+		return model.Conversion{}, err
+	}
+
+	conversion := Apply(e.rule(rateInfo), rateInfo, amount)
+	if conversion.Net < 0 {
+		return conversion, ErrAmountTooSmall
+	}
+
+	return conversion, nil
+}
+
+// ConvertTarget implements service.Pricer.
+func (e *Engine) ConvertTarget(ctx context.Context, from, to string, target float64) (model.Conversion, error) {
+	if target <= 0 || math.IsInf(target, 0) || math.IsNaN(target) {
+		return model.Conversion{}, ErrInvalidAmount
+	}
+
+	rateInfo, err := e.cache.Get(ctx, storage.Pair{From: from, To: to})
+	if err != nil {
+		return model.Conversion{}, err
+	}
+
+	return ApplyTarget(e.rule(rateInfo), rateInfo, target)
+}
+
+// Apply prices conversion of the amount at given mid rate.
+// Customer always sells `from` and therefore receives the
+// bid side, which is half of the spread below the mid rate.
+// Amounts are rounded to minor units of `to` in favour of the house
+func Apply(rule model.PricingRule, rateInfo model.ExchangeRate, amount float64) model.Conversion {
+	decimals := rateInfo.Target.Decimals
+
+	rate := rateInfo.Rate * (1 - rule.Spread/2)
+	gross := roundDown(amount*rate, decimals)
+
+	fee := rule.FixedFee + gross*rule.PercentFee
+	if fee < rule.MinFee {
+		fee = rule.MinFee
+	}
+	fee = roundUp(fee, decimals)
+
+	return model.Conversion{
+		From:     rateInfo.Base.Symbol,
+		To:       rateInfo.Target.Symbol,
+		Amount:   amount,
+		MidRate:  rateInfo.Rate,
+		Rate:     rate,
+		Gross:    gross,
+		Fee:      fee,
+		Net:      round(gross-fee, decimals),
+		RateTime: rateInfo.Timestamp,
+		Stale:    rateInfo.Stale,
+		Base:     rateInfo.Base,
+		Target:   rateInfo.Target,
+	}
+}
+
+// ApplyTarget prices conversion which yields at least `target` of the
+// `to` currency, amount is the smallest one in minor units of `from`
+// for which Apply covers the target after spread, fees and rounding
+func ApplyTarget(rule model.PricingRule, rateInfo model.ExchangeRate, target float64) (model.Conversion, error) {
+	rate := rateInfo.Rate * (1 - rule.Spread/2)
+	if rate <= 0 || rule.PercentFee >= 1 {
+		return model.Conversion{}, ErrTargetUnreachable
+	}
+
+	decimals := rateInfo.Base.Decimals
+	target = roundUp(target, rateInfo.Target.Decimals)
+
+	// net is the lesser of percent and min fee branches,
+	// therefore gross is the greater of their inverses
+	gross := math.Max((target+rule.FixedFee)/(1-rule.PercentFee), target+rule.MinFee)
+
+	// net does not decrease as amount grows, so the smallest
+	// amount is searched in minor units of `from` up to the estimate
+	// extended until rounding of gross and fee no longer leaves it short
+	estimate := gross / rate
+
+	// minor units beyond float precision, e.g. 18 decimals
+	// of ERC20 tokens, are searched in coarser units
+	for decimals > 0 && estimate*math.Pow10(decimals) > maxSearchUnits {
+		decimals--
+	}
+
+	var (
+		scale    = math.Pow10(decimals)
+		amountOf = func(units int64) float64 { return round(float64(units)/scale, decimals) }
+		covers   = func(units int64) bool { return Apply(rule, rateInfo, amountOf(units)).Net >= target }
+		hi       = int64(math.Max(math.Ceil(estimate*scale-roundingEpsilon), 1))
+	)
+
+	for step := int64(1); !covers(hi); step *= 2 {
+		if hi > maxUnits {
+			return model.Conversion{}, ErrTargetUnreachable
+		}
+
+		hi += step
+	}
+
+	units := int64(sort.Search(int(hi), func(i int) bool { return covers(int64(i) + 1) })) + 1
+
+	return Apply(rule, rateInfo, amountOf(units)), nil
+}
+
+// rule returns the most specific rule matching the pair,
+// symbols take precedence over currency types
+func (e *Engine) rule(rateInfo model.ExchangeRate) model.PricingRule {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	best := model.PricingRule{}
+	bestScore := -1
+
+	for _, r := range e.rules {
+		score, ok := match(r, rateInfo)
+		if ok && score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+
+	return best
+}
+
+// match reports whether rule applies to the pair
+// and how specific the rule is
+func match(r model.PricingRule, rateInfo model.ExchangeRate) (int, bool) {
+	score := 0
+
+	matchers := []struct {
+		rule, actual string
+		weight       int
+	}{
+		{r.From, rateInfo.Base.Symbol, 2},
+		{r.To, rateInfo.Target.Symbol, 2},
+		{string(r.FromType), string(rateInfo.Base.CurrencyType), 1},
+		{string(r.ToType), string(rateInfo.Target.CurrencyType), 1},
+	}
+
+	for _, m := range matchers {
+		if m.rule == "" {
+			continue
+		}
+
+		if !strings.EqualFold(m.rule, m.actual) {
+			return 0, false
+		}
+
+		score += m.weight
+	}
+
+	return score, true
+}
+
+func (e *Engine) init() error {
+	if err := e.load(); err != nil {
+		return fmt.Errorf("unable to load pricing rules: %w", err)
+	}
+
+	e.ticker = time.NewTicker(refreshInterval)
+
+	go func() {
+		for {
+			select {
+			case <-e.doneC:
+				return
+
+			case t := <-e.ticker.C:
+				if err := e.load(); err != nil {
+					log.Error().Err(err).Str("time", t.String()).Msg("unable to reload pricing rules, retry in 1 minute")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (e *Engine) load() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancelFn()
+
+	rules, err := e.pricingStorage.LoadPricingRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.lock.Lock()
+	e.rules = rules
+	e.lock.Unlock()
+
+	return nil
+}
@@ -0,0 +1,345 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+)
+
+func rate(base, target string, baseType, targetType model.Currency, r float64) model.ExchangeRate {
+	baseType.Symbol, targetType.Symbol = base, target
+
+	return model.ExchangeRate{Base: baseType, Target: targetType, Rate: r}
+}
+
+var (
+	fiat   = model.Currency{CurrencyType: model.Fiat, Decimals: 2}
+	crypto = model.Currency{CurrencyType: model.Crypto, Decimals: 8}
+	yen    = model.Currency{CurrencyType: model.Fiat, Decimals: 0}
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestApply(t *testing.T) {
+	btcUSD := rate("BTC", "USD", crypto, fiat, 60000)
+
+	tests := []struct {
+		name  string
+		rule  model.PricingRule
+		rate  float64
+		gross float64
+		fee   float64
+	}{
+		{"no margin", model.PricingRule{}, 60000, 60000, 0},
+		{"spread", model.PricingRule{Spread: 0.01}, 59700, 59700, 0},
+		{"fixed fee", model.PricingRule{FixedFee: 5}, 60000, 60000, 5},
+		{"percent fee", model.PricingRule{PercentFee: 0.001}, 60000, 60000, 60},
+		{"fixed and percent fee", model.PricingRule{FixedFee: 5, PercentFee: 0.001}, 60000, 60000, 65},
+		{"min fee", model.PricingRule{PercentFee: 0.0001, MinFee: 10}, 60000, 60000, 10},
+		{"min fee below actual", model.PricingRule{PercentFee: 0.001, MinFee: 10}, 60000, 60000, 60},
+		{"spread and fees", model.PricingRule{Spread: 0.01, PercentFee: 0.001}, 59700, 59700, 59.7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Apply(tt.rule, btcUSD, 1)
+
+			if c.MidRate != 60000 || !almostEqual(c.Rate, tt.rate) || !almostEqual(c.Gross, tt.gross) || !almostEqual(c.Fee, tt.fee) {
+				t.Errorf("unexpected conversion: %+v", c)
+			}
+
+			if !almostEqual(c.Net, c.Gross-c.Fee) {
+				t.Errorf("expected net to be gross minus fee: %+v", c)
+			}
+		})
+	}
+}
+
+func TestRuleMatching(t *testing.T) {
+	rules := []model.PricingRule{
+		{Spread: 0.1},
+		{FromType: model.Crypto, ToType: model.Fiat, Spread: 0.2},
+		{From: "BTC", ToType: model.Fiat, Spread: 0.3},
+		{From: "BTC", To: "USD", Spread: 0.4},
+		{FromType: model.Fiat, To: "ETH", Spread: 0.5},
+	}
+
+	e := &Engine{rules: rules}
+
+	tests := []struct {
+		name   string
+		rate   model.ExchangeRate
+		spread float64
+	}{
+		{"exact pair", rate("BTC", "USD", crypto, fiat, 1), 0.4},
+		{"symbol and type", rate("BTC", "EUR", crypto, fiat, 1), 0.3},
+		{"currency types", rate("ETH", "EUR", crypto, fiat, 1), 0.2},
+		{"type and symbol", rate("USD", "ETH", fiat, crypto, 1), 0.5},
+		{"default", rate("USD", "BTC", fiat, crypto, 1), 0.1},
+		{"case insensitive", rate("btc", "usd", crypto, fiat, 1), 0.4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rule := e.rule(tt.rate); rule.Spread != tt.spread {
+				t.Errorf("expected spread %f, got %f", tt.spread, rule.Spread)
+			}
+		})
+	}
+
+	if rule := (&Engine{}).rule(rate("BTC", "USD", crypto, fiat, 1)); rule != (model.PricingRule{}) {
+		t.Errorf("expected zero rule without rules, got %+v", rule)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	e, err := New(
+		fake.NewCache(map[string]float64{"BTC/USD": 60000}),
+		fake.NewPricingStorage(model.PricingRule{FixedFee: 10}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	c, err := e.Convert(context.Background(), "BTC", "USD", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Gross != 120000 || c.Fee != 10 || c.Net != 119990 {
+		t.Errorf("unexpected conversion: %+v", c)
+	}
+
+	tests := []struct {
+		name   string
+		from   string
+		amount float64
+		err    error
+	}{
+		{"zero amount", "BTC", 0, ErrInvalidAmount},
+		{"NaN amount", "BTC", math.NaN(), ErrInvalidAmount},
+		{"below fee", "BTC", 0.0001, ErrAmountTooSmall},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := e.Convert(context.Background(), tt.from, "USD", tt.amount); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	if _, err := e.Convert(context.Background(), "CNY", "USD", 1); err == nil {
+		t.Error("expected error for unknown pair")
+	}
+}
+
+func TestNewFailure(t *testing.T) {
+	storage := fake.NewPricingStorage()
+	storage.Err = errors.New("db is down")
+
+	if _, err := New(fake.NewCache(nil), storage); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestApplyRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		rate model.ExchangeRate
+		rule model.PricingRule
+		want model.Conversion
+	}{
+		{
+			name: "fiat gross rounded down, fee rounded up",
+			rate: rate("BTC", "USD", crypto, fiat, 60000.129),
+			rule: model.PricingRule{PercentFee: 0.0011},
+			want: model.Conversion{Gross: 60000.12, Fee: 66.01, Net: 59934.11},
+		},
+		{
+			name: "zero decimal fiat",
+			rate: rate("BTC", "JPY", crypto, yen, 9000000.75),
+			rule: model.PricingRule{FixedFee: 0.2},
+			want: model.Conversion{Gross: 9000000, Fee: 1, Net: 8999999},
+		},
+		{
+			name: "crypto",
+			rate: rate("USD", "BTC", fiat, crypto, 0.0000166666666),
+			rule: model.PricingRule{},
+			want: model.Conversion{Gross: 0.00001666, Fee: 0, Net: 0.00001666},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Apply(tt.rule, tt.rate, 1)
+
+			if c.Gross != tt.want.Gross || c.Fee != tt.want.Fee || c.Net != tt.want.Net {
+				t.Errorf("expected gross %v fee %v net %v, got %+v", tt.want.Gross, tt.want.Fee, tt.want.Net, c)
+			}
+		})
+	}
+}
+
+func TestApplyTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   model.ExchangeRate
+		rule   model.PricingRule
+		target float64
+		amount float64
+		net    float64
+	}{
+		{"no margin", rate("BTC", "EUR", crypto, fiat, 50000), model.PricingRule{}, 250, 0.005, 250},
+		{"rounded up to minor unit", rate("BTC", "EUR", crypto, fiat, 30000), model.PricingRule{}, 250, 0.00833334, 250},
+		{"spread and fees", rate("BTC", "EUR", crypto, fiat, 50000), model.PricingRule{Spread: 0.02, FixedFee: 1, PercentFee: 0.01}, 250, 0.00512203, 250},
+		{"min fee", rate("BTC", "EUR", crypto, fiat, 50000), model.PricingRule{PercentFee: 0.001, MinFee: 5}, 250, 0.0051, 250},
+		{"fiat source", rate("USD", "BTC", fiat, crypto, 0.00002), model.PricingRule{FixedFee: 0.00001}, 0.01, 500.5, 0.01},
+		{"minor units beyond float precision", rate("ETH", "USD", model.Currency{CurrencyType: model.Crypto, Decimals: 18}, fiat, 2500), model.PricingRule{FixedFee: 1}, 10000, 4.0004, 10000},
+		{"target beyond minor unit", rate("BTC", "JPY", crypto, yen, 9000000), model.PricingRule{}, 1000.2, 0.00011123, 1001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ApplyTarget(tt.rule, tt.rate, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !almostEqual(c.Amount, tt.amount) || c.Net < tt.net {
+				t.Errorf("expected amount %v for net %v, got %+v", tt.amount, tt.net, c)
+			}
+		})
+	}
+
+	unreachable := []struct {
+		name string
+		rate model.ExchangeRate
+		rule model.PricingRule
+	}{
+		{"zero rate", rate("BTC", "EUR", crypto, fiat, 0), model.PricingRule{}},
+		{"full spread", rate("BTC", "EUR", crypto, fiat, 50000), model.PricingRule{Spread: 2}},
+		{"full percent fee", rate("BTC", "EUR", crypto, fiat, 50000), model.PricingRule{PercentFee: 1}},
+	}
+
+	for _, tt := range unreachable {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ApplyTarget(tt.rule, tt.rate, 250); !errors.Is(err, ErrTargetUnreachable) {
+				t.Errorf("expected %v, got %v", ErrTargetUnreachable, err)
+			}
+		})
+	}
+}
+
+// randomCase generates pair, rule and amount
+// spanning fiat and crypto on both sides
+func randomCase(r *rand.Rand) (model.ExchangeRate, model.PricingRule, float64) {
+	symbols := []model.Currency{
+		{Symbol: "USD", CurrencyType: model.Fiat, Decimals: 2},
+		{Symbol: "JPY", CurrencyType: model.Fiat, Decimals: 0},
+		{Symbol: "KWD", CurrencyType: model.Fiat, Decimals: 3},
+		{Symbol: "BTC", CurrencyType: model.Crypto, Decimals: 8},
+		{Symbol: "ETH", CurrencyType: model.Crypto, Decimals: 18},
+	}
+
+	base := symbols[r.Intn(len(symbols))]
+	target := symbols[r.Intn(len(symbols))]
+
+	rateInfo := model.ExchangeRate{Base: base, Target: target, Rate: math.Pow(10, r.Float64()*10-5)}
+
+	rule := model.PricingRule{
+		Spread:     r.Float64() * 0.05,
+		FixedFee:   r.Float64() * 5,
+		PercentFee: r.Float64() * 0.02,
+		MinFee:     r.Float64() * 10,
+	}
+
+	amount := math.Pow(10, r.Float64()*6) * math.Pow10(-base.Decimals/2)
+
+	return rateInfo, rule, amount
+}
+
+// maxMinorUnits keeps generated amounts within float64 precision of the minor units
+const maxMinorUnits = 1e12
+
+func TestApplyTargetRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 10000; i++ {
+		rateInfo, rule, amount := randomCase(r)
+		unit := math.Pow10(-rateInfo.Base.Decimals)
+
+		if amount/unit > maxMinorUnits || amount*rateInfo.Rate*math.Pow10(rateInfo.Target.Decimals) > maxMinorUnits {
+			continue
+		}
+
+		forward := Apply(rule, rateInfo, roundUp(amount, rateInfo.Base.Decimals))
+		if forward.Net <= 0 {
+			continue
+		}
+
+		reverse, err := ApplyTarget(rule, rateInfo, forward.Net)
+		if err != nil {
+			t.Fatalf("%+v %+v: %v", rateInfo, rule, err)
+		}
+
+		// reverse covers the target
+		if reverse.Net < forward.Net {
+			t.Fatalf("reverse net %v below target %v: %+v %+v", reverse.Net, forward.Net, rateInfo, rule)
+		}
+
+		// reverse never asks for more than forward needed
+		if reverse.Amount > forward.Amount+unit/2 {
+			t.Fatalf("reverse amount %v exceeds forward %v: %+v %+v", reverse.Amount, forward.Amount, rateInfo, rule)
+		}
+
+		// reverse is reproduced by the forward conversion
+		if again := Apply(rule, rateInfo, reverse.Amount); !reflect.DeepEqual(again, reverse) {
+			t.Fatalf("forward of reverse differs: %+v != %+v", again, reverse)
+		}
+
+		// one minor unit less does not cover the target
+		if reverse.Amount > unit {
+			if lower := Apply(rule, rateInfo, round(reverse.Amount-unit, rateInfo.Base.Decimals)); lower.Net >= forward.Net {
+				t.Fatalf("amount %v is not minimal, %v covers target %v", reverse.Amount, lower.Amount, forward.Net)
+			}
+		}
+	}
+}
+
+func TestConvertTarget(t *testing.T) {
+	e, err := New(
+		fake.NewCache(map[string]float64{"BTC/EUR": 50000}),
+		fake.NewPricingStorage(model.PricingRule{FixedFee: 10}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	c, err := e.ConvertTarget(context.Background(), "BTC", "EUR", 240)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Amount != 0.005 || c.Gross != 250 || c.Net != 240 {
+		t.Errorf("unexpected conversion: %+v", c)
+	}
+
+	if _, err := e.ConvertTarget(context.Background(), "BTC", "EUR", -1); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected %v, got %v", ErrInvalidAmount, err)
+	}
+
+	if _, err := e.ConvertTarget(context.Background(), "CNY", "EUR", 1); err == nil {
+		t.Error("expected error for unknown pair")
+	}
+}
@@ -0,0 +1,40 @@
+package pricing
+
+import (
+	"math"
+)
+
+const (
+	roundingEpsilon = 1e-6  // absolute float error tolerated in minor units
+	relativeEpsilon = 1e-14 // relative float error tolerated for large amounts
+)
+
+// snap moves value within float error of the
+// minor unit onto it, so values already rounded
+// are not pushed to the next unit
+func snap(units float64) float64 {
+	nearest := math.Round(units)
+	if math.Abs(units-nearest) <= math.Max(roundingEpsilon, math.Abs(units)*relativeEpsilon) {
+		return nearest
+	}
+
+	return units
+}
+
+// roundDown rounds towards zero
+func roundDown(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Floor(snap(v*p)) / p
+}
+
+// roundUp rounds away from zero
+func roundUp(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Ceil(snap(v*p)) / p
+}
+
+// round rounds to the nearest minor unit
+func round(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,172 @@
+package reconcile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+)
+
+// Policy selects side of the pair
+// served as obtained from upstream
+type Policy string
+
+const (
+	PolicyNone Policy = "none" // PolicyNone serves both sides as obtained
+	PolicyC2F  Policy = "c2f"  // PolicyC2F serves fiat prices, e.g. BTC/USD, and derives the opposite side
+	PolicyF2C  Policy = "f2c"  // PolicyF2C serves fiat side, e.g. USD/BTC, and derives the prices
+)
+
+// ParsePolicy returns policy by its name,
+// empty name stands for PolicyNone
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(s)); p {
+	case "":
+		return PolicyNone, nil
+	case PolicyNone, PolicyC2F, PolicyF2C:
+		return p, nil
+	}
+
+	return "", fmt.Errorf("unknown reconciliation policy: %q", s)
+}
+
+// Reconciler measures divergence between rates of the pairs
+// and their opposite pairs and derives one side from the other
+type Reconciler struct {
+	lock   sync.RWMutex         // guards latest
+	policy Policy               // side of the pair kept as obtained
+	latest model.Reconciliation // divergences measured by the latest reconciliation
+	now    func() time.Time     // clock used to timestamp reconciliation
+}
+
+func New(policy Policy) *Reconciler {
+	return &Reconciler{
+		policy: policy,
+		latest: model.Reconciliation{Policy: string(policy), Pairs: []model.Divergence{}},
+		now:    time.Now,
+	}
+}
+
+var _ service.Reconciler = (*Reconciler)(nil)
+
+// Reconcile implements service.Reconciler.
+// Divergence is measured before the policy is applied, only for
+// pairs whose both sides were obtained, the canonical side is kept
+// if only one side was obtained
+func (r *Reconciler) Reconcile(currencies []model.Currency, rates, obtained model.Rates) model.Rates {
+	fiats := fiatSymbols(currencies)
+
+	report := model.Reconciliation{
+		Policy:       string(r.policy),
+		Pairs:        []model.Divergence{},
+		ReconciledAt: r.now().UTC(),
+	}
+
+	result := make(model.Rates, len(rates))
+
+	for base, targets := range rates {
+		for target, rate := range targets {
+			result.Put(base, target, rate)
+		}
+	}
+
+	for base, targets := range obtained {
+		for target, rate := range targets {
+			// every pair is measured once, from the side priced in fiat
+			if fiats[base] || !fiats[target] {
+				continue
+			}
+
+			inverse, ok := obtained[target][base]
+			if !ok || rate == 0 || inverse == 0 {
+				continue
+			}
+
+			d := model.Divergence{
+				Pair:       base + "/" + target,
+				Rate:       rate,
+				Inverse:    inverse,
+				Divergence: rate*inverse - 1,
+			}
+
+			report.Pairs = append(report.Pairs, d)
+			report.MaxAbs = math.Max(report.MaxAbs, math.Abs(d.Divergence))
+		}
+	}
+
+	for base, targets := range rates {
+		for target, rate := range targets {
+			if rate == 0 || fiats[base] == fiats[target] {
+				continue
+			}
+
+			// canonical side overrides the opposite one
+			switch {
+			case r.policy == PolicyC2F && fiats[target]:
+				result.Put(target, base, 1/rate)
+			case r.policy == PolicyF2C && fiats[base]:
+				result.Put(target, base, 1/rate)
+			}
+		}
+	}
+
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		return report.Pairs[i].Pair < report.Pairs[j].Pair
+	})
+
+	r.lock.Lock()
+	r.latest = report
+	r.lock.Unlock()
+
+	return result
+}
+
+// Pairs implements service.Reconciler.
+// Opposite side of the pair derived by the policy is left out
+func (r *Reconciler) Pairs(pairs []service.Pair) []service.Pair {
+	if r.policy == PolicyNone {
+		return pairs
+	}
+
+	result := make([]service.Pair, 0, len(pairs))
+
+	for _, pair := range pairs {
+		baseFiat := pair.Base.CurrencyType == model.Fiat
+		targetFiat := pair.Target.CurrencyType == model.Fiat
+
+		switch {
+		case r.policy == PolicyC2F && baseFiat && !targetFiat:
+			continue
+		case r.policy == PolicyF2C && !baseFiat && targetFiat:
+			continue
+		}
+
+		result = append(result, pair)
+	}
+
+	return result
+}
+
+// Latest returns divergences measured
+// by the latest reconciliation
+func (r *Reconciler) Latest() model.Reconciliation {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.latest
+}
+
+// fiatSymbols returns whether currencies are fiat keyed by symbol
+func fiatSymbols(currencies []model.Currency) map[string]bool {
+	result := make(map[string]bool, len(currencies))
+	for _, c := range currencies {
+		result[strings.ToUpper(c.Symbol)] = c.CurrencyType == model.Fiat
+	}
+
+	return result
+}
@@ -0,0 +1,142 @@
+package reconcile
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+)
+
+var currencies = []model.Currency{
+	{Symbol: "BTC", CurrencyType: model.Crypto},
+	{Symbol: "XAU", CurrencyType: model.Metal},
+	{Symbol: "USD", CurrencyType: model.Fiat},
+}
+
+func rates() model.Rates {
+	return model.Rates{
+		"BTC": {"USD": 60000},
+		"USD": {"BTC": 1.0 / 59400, "XAU": 1.0 / 2000},
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for input, want := range map[string]Policy{"": PolicyNone, "none": PolicyNone, "C2F": PolicyC2F, "f2c": PolicyF2C} {
+		if got, err := ParsePolicy(input); err != nil || got != want {
+			t.Errorf("%q: expected %s, got %s, %v", input, want, got, err)
+		}
+	}
+
+	if _, err := ParsePolicy("mid"); err == nil {
+		t.Error("expected unknown policy to be rejected")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		want   model.Rates
+	}{
+		{
+			policy: PolicyNone,
+			want:   rates(),
+		},
+		{
+			policy: PolicyC2F,
+			want: model.Rates{
+				"BTC": {"USD": 60000},
+				"USD": {"BTC": 1.0 / 60000, "XAU": 1.0 / 2000},
+			},
+		},
+		{
+			policy: PolicyF2C,
+			want: model.Rates{
+				"BTC": {"USD": 59400},
+				"USD": {"BTC": 1.0 / 59400, "XAU": 1.0 / 2000},
+				"XAU": {"USD": 2000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			r := New(tt.policy)
+
+			input := rates()
+			got := r.Reconcile(currencies, input, input)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+
+			for base, targets := range tt.want {
+				if len(got[base]) != len(targets) {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+
+				for target, rate := range targets {
+					if math.Abs(got[base][target]-rate) > 1e-12*rate {
+						t.Errorf("%s/%s: expected %v, got %v", base, target, rate, got[base][target])
+					}
+				}
+			}
+
+			if input["USD"]["BTC"] != 1.0/59400 {
+				t.Error("expected input rates to be left intact")
+			}
+
+			latest := r.Latest()
+			if latest.Policy != string(tt.policy) || len(latest.Pairs) != 1 || latest.ReconciledAt.IsZero() {
+				t.Fatalf("unexpected reconciliation: %+v", latest)
+			}
+
+			d := latest.Pairs[0]
+			if d.Pair != "BTC/USD" || d.Rate != 60000 || math.Abs(d.Divergence-(60000.0/59400-1)) > 1e-12 || latest.MaxAbs != math.Abs(d.Divergence) {
+				t.Errorf("unexpected divergence: %+v", d)
+			}
+		})
+	}
+}
+
+func TestReconcileObtained(t *testing.T) {
+	r := New(PolicyNone)
+
+	// USD/BTC is cached from the earlier refresh
+	got := r.Reconcile(currencies, rates(), model.Rates{"BTC": {"USD": 60000}})
+
+	if got["USD"]["BTC"] != 1.0/59400 {
+		t.Errorf("expected cached rate to be served, got %v", got["USD"]["BTC"])
+	}
+
+	if latest := r.Latest(); len(latest.Pairs) != 0 || latest.MaxAbs != 0 {
+		t.Errorf("expected no divergence of the pair obtained one side only, got %+v", latest)
+	}
+}
+
+func TestPairs(t *testing.T) {
+	pairs := service.Pairs(currencies)
+
+	tests := []struct {
+		policy Policy
+		want   []string
+	}{
+		{policy: PolicyNone, want: []string{"BTC/USD", "USD/BTC", "XAU/USD", "USD/XAU"}},
+		{policy: PolicyC2F, want: []string{"BTC/USD", "XAU/USD"}},
+		{policy: PolicyF2C, want: []string{"USD/BTC", "USD/XAU"}},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.policy).Pairs(pairs)
+
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.policy, tt.want, got)
+		}
+
+		for i, pair := range got {
+			if pair.String() != tt.want[i] {
+				t.Errorf("%s: expected %s, got %s", tt.policy, tt.want[i], pair)
+			}
+		}
+	}
+}
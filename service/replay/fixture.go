@@ -0,0 +1,155 @@
+package replay
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record holds single recorded exchange rate
+type Record struct {
+	Time   time.Time `json:"time"`   // Time the rate was observed
+	Base   string    `json:"base"`   // Base currency symbol
+	Target string    `json:"target"` // Target currency symbol
+	Rate   float64   `json:"rate"`   // Exchange rate
+}
+
+var csvHeader = []string{"time", "base", "target", "rate"}
+
+// LoadFixtures reads records from the file,
+// format is selected by the file extension(.json or .csv)
+func LoadFixtures(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return readJSON(f)
+	case ".csv":
+		return readCSV(f)
+	}
+
+	return nil, fmt.Errorf("unsupported fixtures format: %s", path)
+}
+
+// WriteFixtures writes records into the file,
+// format is selected by the file extension(.json or .csv)
+func WriteFixtures(path string, records []Record) error {
+	var write func(io.Writer, []Record) error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		write = writeJSON
+	case ".csv":
+		write = writeCSV
+	default:
+		return fmt.Errorf("unsupported fixtures format: %s", path)
+	}
+
+	// write into temporary file first so that
+	// readers never observe partially written fixtures
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f, records); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func readJSON(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func writeJSON(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(records)
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+
+	for i, row := range rows {
+		if len(row) != len(csvHeader) {
+			return nil, fmt.Errorf("line %d: expected %d columns, got %d", i+1, len(csvHeader), len(row))
+		}
+
+		// header is optional
+		if i == 0 && row[0] == csvHeader[0] {
+			continue
+		}
+
+		rec := Record{
+			Base:   strings.ToUpper(row[1]),
+			Target: strings.ToUpper(row[2]),
+		}
+
+		if rec.Time, err = time.Parse(time.RFC3339, row[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		if rec.Rate, err = strconv.ParseFloat(row[3], 64); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+func writeCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		row := []string{
+			rec.Time.UTC().Format(time.RFC3339),
+			rec.Base,
+			rec.Target,
+			strconv.FormatFloat(rec.Rate, 'f', -1, 64),
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
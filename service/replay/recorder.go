@@ -0,0 +1,167 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRecords is the number of records kept in the fixtures,
+// the oldest records are dropped once it is exceeded
+const maxRecords = 100000
+
+// Recorder wraps exchange provider and records
+// every rate it returns into the fixtures file
+type Recorder struct {
+	exchange service.Exchange   // underlying exchange provider
+	path     string             // fixtures file path
+	lock     sync.Mutex         // guards records and latest
+	records  []Record           // rates recorded so far
+	latest   map[string]float64 // latest recorded rate keyed by BASE/TARGET
+	limit    int                // max records kept
+	now      func() time.Time   // clock used to timestamp records
+}
+
+// NewRecorder creates recorder which writes fixtures into given path,
+// existing fixtures are preserved and appended to. Fixtures which
+// cannot be read are reported rather than overwritten
+func NewRecorder(exchange service.Exchange, path string) (*Recorder, error) {
+	r := &Recorder{
+		exchange: exchange,
+		path:     path,
+		latest:   make(map[string]float64),
+		limit:    maxRecords,
+		now:      time.Now,
+	}
+
+	records, err := LoadFixtures(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, rec := range records {
+		r.latest[rec.Base+"/"+rec.Target] = rec.Rate
+	}
+
+	r.records = records
+	r.trim()
+
+	// validate that fixtures can be written at all
+	return r, r.Flush()
+}
+
+// Flush writes all recorded rates into the fixtures file
+func (r *Recorder) Flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return WriteFixtures(r.path, r.records)
+}
+
+// record appends rates which changed since they were recorded
+// last time, the replay serves the latest record until the next
+// one anyway. Reports whether anything was recorded
+func (r *Recorder) record(rates ...model.ExchangeRate) bool {
+	now := r.now().UTC()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	recorded := false
+
+	for _, rate := range rates {
+		pair := rate.Base.Symbol + "/" + rate.Target.Symbol
+		if latest, ok := r.latest[pair]; ok && latest == rate.Rate {
+			continue
+		}
+
+		r.latest[pair] = rate.Rate
+		r.records = append(r.records, Record{
+			Time:   now,
+			Base:   rate.Base.Symbol,
+			Target: rate.Target.Symbol,
+			Rate:   rate.Rate,
+		})
+		recorded = true
+	}
+
+	r.trim()
+
+	return recorded
+}
+
+// trim drops the oldest records above the limit,
+// must be called under the lock or before use
+func (r *Recorder) trim() {
+	if excess := len(r.records) - r.limit; excess > 0 {
+		r.records = append(r.records[:0], r.records[excess:]...)
+	}
+}
+
+func (r *Recorder) flush() {
+	if err := r.Flush(); err != nil {
+		log.Error().Err(err).Str("path", r.path).Msg("unable to write fixtures")
+	}
+}
+
+// GetRate implements service.Exchange.
+func (r *Recorder) GetRate(ctx context.Context, from, to string) (model.ExchangeRate, error) {
+	rate, err := r.exchange.GetRate(ctx, from, to)
+	if err != nil {
+		return rate, err
+	}
+
+	if r.record(rate) {
+		r.flush()
+	}
+
+	return rate, nil
+}
+
+// GetCryptoRates implements service.Exchange.
+func (r *Recorder) GetCryptoRates(ctx context.Context, pairs []string) ([]model.ExchangeRate, error) {
+	rates, err := r.exchange.GetCryptoRates(ctx, pairs)
+	if err != nil {
+		return rates, err
+	}
+
+	if r.record(rates...) {
+		r.flush()
+	}
+
+	return rates, nil
+}
+
+// GetAllRates implements service.Exchange.
+func (r *Recorder) GetAllRates(ctx context.Context, currencies []model.Currency) service.LookUp {
+	return r.GetPairRates(ctx, service.Pairs(currencies))
+}
+
+// GetPairRates implements service.Exchange.
+func (r *Recorder) GetPairRates(ctx context.Context, pairs []service.Pair) service.LookUp {
+	lookup := r.exchange.GetPairRates(ctx, pairs)
+
+	var rates []model.ExchangeRate
+
+	for base, targets := range lookup.Rates {
+		for target, rate := range targets {
+			rates = append(rates, model.ExchangeRate{
+				Base:   model.Currency{Symbol: base},
+				Target: model.Currency{Symbol: target},
+				Rate:   rate,
+			})
+		}
+	}
+
+	if r.record(rates...) {
+		r.flush()
+	}
+
+	return lookup
+}
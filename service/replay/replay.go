@@ -0,0 +1,204 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+)
+
+type exchange struct {
+	timeline map[string][]Record // records for each BASE/TARGET pair sorted by time
+	start    time.Time           // time of the earliest record
+	span     time.Duration       // duration between earliest and latest record
+	started  time.Time           // wall clock time replay was started at
+	speed    float64             // replay speed multiplier
+	loop     bool                // restart timeline after reaching its end
+	now      func() time.Time    // clock used to progress timeline
+}
+
+// Option configures the replay
+type Option func(*exchange)
+
+// WithSpeed sets replay speed, e.g. 60 replays
+// one hour of recorded rates within one minute
+func WithSpeed(speed float64) Option {
+	return func(e *exchange) {
+		if speed > 0 {
+			e.speed = speed
+		}
+	}
+}
+
+// WithLoop restarts the timeline once it reaches the end,
+// otherwise the latest recorded rates are served forever
+func WithLoop() Option {
+	return func(e *exchange) {
+		e.loop = true
+	}
+}
+
+// WithClock overrides clock used to progress the timeline
+func WithClock(now func() time.Time) Option {
+	return func(e *exchange) {
+		e.now = now
+	}
+}
+
+// New creates exchange provider which serves
+// rates from the fixtures file
+func New(path string, opts ...Option) (service.Exchange, error) {
+	records, err := LoadFixtures(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromRecords(records, opts...)
+}
+
+// NewFromRecords creates exchange provider which
+// replays given records, timeline starts at the
+// earliest record at the moment of creation
+func NewFromRecords(records []Record, opts ...Option) (service.Exchange, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no records to replay")
+	}
+
+	e := &exchange{
+		timeline: make(map[string][]Record),
+		speed:    1,
+		now:      time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	end := records[0].Time
+	e.start = records[0].Time
+
+	for _, rec := range records {
+		rec.Base = strings.ToUpper(rec.Base)
+		rec.Target = strings.ToUpper(rec.Target)
+
+		key := rec.Base + "/" + rec.Target
+		e.timeline[key] = append(e.timeline[key], rec)
+
+		if rec.Time.Before(e.start) {
+			e.start = rec.Time
+		}
+
+		if rec.Time.After(end) {
+			end = rec.Time
+		}
+	}
+
+	for _, recs := range e.timeline {
+		sort.SliceStable(recs, func(i, j int) bool {
+			return recs[i].Time.Before(recs[j].Time)
+		})
+	}
+
+	e.span = end.Sub(e.start)
+	e.started = e.now()
+
+	return e, nil
+}
+
+// at returns current position on the timeline
+func (e *exchange) at() time.Time {
+	offset := time.Duration(float64(e.now().Sub(e.started)) * e.speed)
+
+	if e.loop && e.span > 0 {
+		offset %= e.span + time.Nanosecond
+	}
+
+	return e.start.Add(offset)
+}
+
+// lookup returns the latest rate recorded
+// for the pair at the current position
+func (e *exchange) lookup(base, target string) (float64, error) {
+	base = strings.ToUpper(base)
+	target = strings.ToUpper(target)
+
+	recs := e.timeline[base+"/"+target]
+	at := e.at()
+
+	idx := sort.Search(len(recs), func(i int) bool {
+		return recs[i].Time.After(at)
+	})
+
+	if idx == 0 {
+		return 0, fmt.Errorf("no rate recorded for pair %s/%s at %s", base, target, at.Format(time.RFC3339))
+	}
+
+	return recs[idx-1].Rate, nil
+}
+
+// GetRate implements service.Exchange.
+func (e *exchange) GetRate(ctx context.Context, from, to string) (model.ExchangeRate, error) {
+	rate, err := e.lookup(from, to)
+	if err != nil {
+		return model.ExchangeRate{}, err
+	}
+
+	return model.ExchangeRate{
+		Base:   model.Currency{Symbol: strings.ToUpper(from), CurrencyType: model.Fiat},
+		Target: model.Currency{Symbol: strings.ToUpper(to), CurrencyType: model.Crypto},
+		Rate:   rate,
+	}, nil
+}
+
+// GetCryptoRates implements service.Exchange.
+func (e *exchange) GetCryptoRates(ctx context.Context, pairs []string) ([]model.ExchangeRate, error) {
+	var result []model.ExchangeRate
+
+	for _, pair := range pairs {
+		tokens := strings.Split(pair, "/")
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("invalid pair: %s", pair)
+		}
+
+		rate, err := e.lookup(tokens[0], tokens[1])
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, model.ExchangeRate{
+			Base:   model.Currency{Symbol: strings.ToUpper(tokens[0]), CurrencyType: model.Crypto},
+			Target: model.Currency{Symbol: strings.ToUpper(tokens[1]), CurrencyType: model.Fiat},
+			Rate:   rate,
+		})
+	}
+
+	return result, nil
+}
+
+// GetAllRates implements service.Exchange.
+func (e *exchange) GetAllRates(ctx context.Context, currencies []model.Currency) service.LookUp {
+	return e.GetPairRates(ctx, service.Pairs(currencies))
+}
+
+// GetPairRates implements service.Exchange.
+// Pairs without recorded rates are reported in PairErrors
+func (e *exchange) GetPairRates(ctx context.Context, pairs []service.Pair) service.LookUp {
+	result := service.LookUp{
+		Rates:      make(model.Rates),
+		PairErrors: make(map[string]error),
+	}
+
+	for _, pair := range pairs {
+		if rate, err := e.lookup(pair.Base.Symbol, pair.Target.Symbol); err != nil {
+			result.PairErrors[pair.String()] = err
+		} else {
+			result.Rates.Put(pair.Base.Symbol, pair.Target.Symbol, rate)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,215 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+)
+
+var t0 = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func testRecords() []Record {
+	return []Record{
+		{Time: t0, Base: "BTC", Target: "USD", Rate: 100},
+		{Time: t0.Add(time.Minute), Base: "BTC", Target: "USD", Rate: 110},
+		{Time: t0.Add(2 * time.Minute), Base: "BTC", Target: "USD", Rate: 120},
+		{Time: t0.Add(time.Minute), Base: "USD", Target: "BTC", Rate: 0.01},
+	}
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func TestReplayTimeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		elapsed  time.Duration
+		pair     string
+		expected float64
+		wantErr  bool
+	}{
+		{"start", nil, 0, "BTC/USD", 100, false},
+		{"between records", nil, 90 * time.Second, "BTC/USD", 110, false},
+		{"after the end", nil, time.Hour, "BTC/USD", 120, false},
+		{"not recorded yet", nil, 0, "USD/BTC", 0, true},
+		{"recorded later", nil, time.Minute, "USD/BTC", 0.01, false},
+		{"unknown pair", nil, time.Minute, "ETH/USD", 0, true},
+		{"speed", []Option{WithSpeed(60)}, time.Second, "BTC/USD", 110, false},
+		{"loop", []Option{WithLoop()}, 2*time.Minute + 30*time.Second, "BTC/USD", 100, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &testClock{now: time.Now()}
+
+			e, err := NewFromRecords(testRecords(), append(tt.opts, WithClock(clock.Now))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clock.now = clock.now.Add(tt.elapsed)
+
+			rates, err := e.GetCryptoRates(context.Background(), []string{tt.pair})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", rates)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rates[0].Rate != tt.expected {
+				t.Errorf("expected rate %f, got %f", tt.expected, rates[0].Rate)
+			}
+		})
+	}
+}
+
+func TestReplayGetAllRates(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+
+	e, err := NewFromRecords(testRecords(), WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+
+	lookup := e.GetAllRates(context.Background(), []model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto},
+		{Symbol: "ETH", CurrencyType: model.Crypto},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+	})
+
+	if lookup.Rates["BTC"]["USD"] != 110 {
+		t.Errorf("expected C2F rate 110, got %f", lookup.Rates["BTC"]["USD"])
+	}
+
+	if lookup.Rates["USD"]["BTC"] != 0.01 {
+		t.Errorf("expected F2C rate 0.01, got %f", lookup.Rates["USD"]["BTC"])
+	}
+
+	if _, ok := lookup.Rates["ETH"]; ok {
+		t.Error("expected unrecorded pair to be skipped")
+	}
+}
+
+func TestFixturesRoundTrip(t *testing.T) {
+	for _, ext := range []string{".json", ".csv"} {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixtures"+ext)
+
+			if err := WriteFixtures(path, testRecords()); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := LoadFixtures(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := testRecords()
+			if len(records) != len(expected) {
+				t.Fatalf("expected %d records, got %d", len(expected), len(records))
+			}
+
+			for i := range expected {
+				if !records[i].Time.Equal(expected[i].Time) || records[i].Base != expected[i].Base ||
+					records[i].Target != expected[i].Target || records[i].Rate != expected[i].Rate {
+					t.Errorf("expected %+v, got %+v", expected[i], records[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	source, err := NewFromRecords(testRecords())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "recorded.csv")
+
+	recorder, err := NewRecorder(source, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := recorder.GetCryptoRates(context.Background(), []string{"BTC/USD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := LoadFixtures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records[0].Base != "BTC" || records[0].Target != "USD" || records[0].Rate != 100 {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+}
+
+func TestRecorderKeepsFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorded.csv")
+	corrupt := []byte("time,base,target,rate\n2024-06-01T00:00:00Z,BTC,USD\n")
+
+	if err := os.WriteFile(path, corrupt, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewRecorder(fake.NewExchange(nil), path); err == nil {
+		t.Fatal("expected corrupt fixtures to be reported")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(content, corrupt) {
+		t.Errorf("expected fixtures to be kept, got %q", content)
+	}
+}
+
+func TestRecorderLimit(t *testing.T) {
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 100})
+	path := filepath.Join(t.TempDir(), "recorded.csv")
+
+	recorder, err := NewRecorder(exchange, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.limit = 2
+
+	// unchanged rate is recorded once
+	for _, rate := range []float64{100, 100, 110, 120} {
+		exchange.SetRate("BTC", "USD", rate)
+
+		if _, err := recorder.GetCryptoRates(context.Background(), []string{"BTC/USD"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := LoadFixtures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].Rate != 110 || records[1].Rate != 120 {
+		t.Fatalf("expected the latest two rates, got %+v", records)
+	}
+}
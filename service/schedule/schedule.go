@@ -0,0 +1,444 @@
+package schedule
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+)
+
+const (
+	defaultInterval     = time.Minute      // refresh interval of pairs without override
+	defaultJitter       = 0.1              // max relative deviation from the interval
+	defaultRetryAfter   = time.Second * 10 // max delay before failed pair is retried
+	defaultRecentWindow = time.Minute * 5  // pairs requested within the window are refreshed first
+	defaultHotThreshold = 1                // requests within the window which make the pair hot
+	windowBuckets       = 30               // buckets of the sliding window
+
+	LaneHot  = "hot"  // LaneHot refreshes pairs at their interval
+	LaneCold = "cold" // LaneCold refreshes pairs not requested within the window at the cold interval
+)
+
+// Scheduler assigns every pair its own refresh interval,
+// spreads refreshes by jitter and hands out due pairs
+// starting with the recently requested ones. Both directions
+// of the pair share the schedule, so that they are always
+// obtained together and can be validated against each other
+type Scheduler struct {
+	lock         sync.Mutex               // guards entries
+	entries      map[string]*entry        // scheduled pairs keyed by both symbols, see key
+	interval     time.Duration            // refresh interval of pairs without override
+	coldInterval time.Duration            // refresh interval of cold pairs, zero keeps them at their interval
+	hotThreshold int                      // requests within the window which make the pair hot
+	intervals    map[string]time.Duration // overrides keyed by symbol or BASE/TARGET pair
+	jitter       float64                  // max relative deviation from the interval
+	retryAfter   time.Duration            // max delay before failed pair is retried
+	recentWindow time.Duration            // pairs requested within the window are refreshed first
+	maxPairs     int                      // max pairs handed out at once, zero for any number
+	random       func() float64           // source of jitter in [0, 1)
+}
+
+// entry holds schedule of the pair in both directions
+type entry struct {
+	pairs     []service.Pair // scheduled directions of the pair
+	interval  time.Duration  // refresh interval of the pair
+	due       time.Time      // time of the next refresh
+	refreshed time.Time      // time of the latest refresh, zero if never refreshed
+	cold      bool           // pair is refreshed in the slow lane
+	demand    counter        // requests of the pair within the window
+}
+
+// key returns key of the pair
+// shared by both directions
+func key(base, target string) string {
+	base, target = strings.ToUpper(base), strings.ToUpper(target)
+	if base > target {
+		base, target = target, base
+	}
+
+	return base + "/" + target
+}
+
+// counter counts requests within the sliding
+// window split into the ring of buckets
+type counter struct {
+	buckets [windowBuckets]struct {
+		slot  int64 // index of the bucket since the epoch
+		count int   // requests within the bucket
+	}
+	last time.Time // time of the latest request
+}
+
+// add counts request made at `now`
+func (c *counter) add(now time.Time, width time.Duration) {
+	slot := now.UnixNano() / int64(width)
+
+	b := &c.buckets[slot%windowBuckets]
+	if b.slot != slot {
+		b.slot, b.count = slot, 0
+	}
+
+	b.count++
+	c.last = now
+}
+
+// count returns requests made within the window ending at `now`
+func (c *counter) count(now time.Time, width time.Duration) int {
+	slot := now.UnixNano() / int64(width)
+
+	total := 0
+	for _, b := range c.buckets {
+		if b.slot > slot-windowBuckets && b.slot <= slot {
+			total += b.count
+		}
+	}
+
+	return total
+}
+
+// Option configures the scheduler
+type Option func(*Scheduler)
+
+// WithInterval sets refresh interval
+// of the pairs without override
+func WithInterval(interval time.Duration) Option {
+	return func(s *Scheduler) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+// WithIntervals overrides refresh interval by pair, e.g. BTC/USD, which
+// applies in both directions or by symbol, e.g. BTC, which applies to every
+// pair of the currency. Pair of two symbols refreshes at the shorter interval
+func WithIntervals(intervals map[string]time.Duration) Option {
+	return func(s *Scheduler) {
+		for key, interval := range intervals {
+			if interval > 0 {
+				s.intervals[strings.ToUpper(key)] = interval
+			}
+		}
+	}
+}
+
+// WithJitter sets max relative deviation from
+// the interval, e.g. 0.1 for ±10%, zero disables it
+func WithJitter(jitter float64) Option {
+	return func(s *Scheduler) {
+		if jitter >= 0 && jitter < 1 {
+			s.jitter = jitter
+		}
+	}
+}
+
+// WithColdInterval moves pairs not requested within the window to the
+// slow lane refreshed at the interval, unless their own one is longer.
+// Cold pair is promoted back as soon as it is requested
+func WithColdInterval(interval time.Duration) Option {
+	return func(s *Scheduler) {
+		if interval > 0 {
+			s.coldInterval = interval
+		}
+	}
+}
+
+// WithHotThreshold sets requests within
+// the window which make the pair hot
+func WithHotThreshold(n int) Option {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.hotThreshold = n
+		}
+	}
+}
+
+// WithRecentWindow sets sliding window requests are
+// counted in, requested pairs keep priority within it
+func WithRecentWindow(window time.Duration) Option {
+	return func(s *Scheduler) {
+		if window > 0 {
+			s.recentWindow = window
+		}
+	}
+}
+
+// WithMaxPairs limits pairs handed out at once, remaining
+// due pairs stay due, lowest priority pairs wait the longest.
+// Both directions of the pair are handed out together
+func WithMaxPairs(n int) Option {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.maxPairs = n
+		}
+	}
+}
+
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		entries:      make(map[string]*entry),
+		interval:     defaultInterval,
+		hotThreshold: defaultHotThreshold,
+		intervals:    make(map[string]time.Duration),
+		jitter:       defaultJitter,
+		retryAfter:   defaultRetryAfter,
+		recentWindow: defaultRecentWindow,
+		random:       rand.Float64,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+var _ service.Scheduler = (*Scheduler)(nil)
+
+// Update implements service.Scheduler.
+// Pairs already scheduled keep their schedule
+// unless their interval got shorter
+func (s *Scheduler) Update(pairs []service.Pair, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := make(map[string]*entry, len(pairs))
+
+	for _, pair := range pairs {
+		k := key(pair.Base.Symbol, pair.Target.Symbol)
+
+		// opposite direction is already scheduled
+		if e, ok := entries[k]; ok {
+			e.pairs = append(e.pairs, pair)
+			continue
+		}
+
+		interval := s.intervalOf(pair)
+
+		e, ok := s.entries[k]
+		if !ok {
+			entries[k] = &entry{pairs: []service.Pair{pair}, interval: interval, due: now}
+			continue
+		}
+
+		if next := now.Add(s.jittered(interval)); interval < e.interval && next.Before(e.due) {
+			e.due = next
+		}
+
+		e.pairs = []service.Pair{pair}
+		e.interval = interval
+		entries[k] = e
+	}
+
+	s.entries = entries
+}
+
+// Due implements service.Scheduler.
+// Hot pairs go first, the most recently requested
+// first, cold pairs take the rest by due time
+func (s *Scheduler) Due(now time.Time) []service.Pair {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var due []*entry
+
+	for _, e := range s.entries {
+		if !e.due.After(now) {
+			due = append(due, e)
+		}
+	}
+
+	recent := func(e *entry) time.Time {
+		if now.Sub(e.demand.last) > s.recentWindow {
+			return time.Time{}
+		}
+
+		return e.demand.last
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].cold != due[j].cold {
+			return !due[i].cold
+		}
+
+		if ri, rj := recent(due[i]), recent(due[j]); !ri.Equal(rj) {
+			return ri.After(rj)
+		}
+
+		if !due[i].due.Equal(due[j].due) {
+			return due[i].due.Before(due[j].due)
+		}
+
+		return due[i].pairs[0].String() < due[j].pairs[0].String()
+	})
+
+	pairs := make([]service.Pair, 0, 2*len(due))
+	for _, e := range due {
+		// the top priority pair is handed out even if it exceeds the limit
+		if s.maxPairs > 0 && len(pairs) > 0 && len(pairs)+len(e.pairs) > s.maxPairs {
+			break
+		}
+
+		pairs = append(pairs, e.pairs...)
+	}
+
+	return pairs
+}
+
+// Refreshed implements service.Scheduler.
+// Pairs not requested within the window move to the
+// slow lane, pairs failed in either direction are
+// retried within retryAfter
+func (s *Scheduler) Refreshed(pairs []service.Pair, failed map[string]error, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	refreshed := make(map[*entry]bool)
+
+	for _, pair := range pairs {
+		e, ok := s.entries[key(pair.Base.Symbol, pair.Target.Symbol)]
+		if !ok {
+			continue
+		}
+
+		_, pairFailed := failed[pair.String()]
+		refreshed[e] = refreshed[e] || pairFailed
+	}
+
+	for e, pairFailed := range refreshed {
+		e.refreshed = now
+		e.cold = s.coldInterval > 0 && e.demand.count(now, s.bucketWidth()) < s.hotThreshold
+
+		interval := s.laneInterval(e)
+		if pairFailed && s.retryAfter < interval {
+			interval = s.retryAfter
+		}
+
+		e.due = now.Add(s.jittered(interval))
+	}
+}
+
+// Requested implements service.Scheduler.
+// Both directions of the pair are counted as either
+// of them serves the conversion, cold pair which got
+// hot is due once its own interval since refresh passed
+func (s *Scheduler) Requested(base, target string, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.entries[key(base, target)]
+	if !ok {
+		return
+	}
+
+	e.demand.add(now, s.bucketWidth())
+
+	if e.cold && e.demand.count(now, s.bucketWidth()) >= s.hotThreshold {
+		e.cold = false
+
+		if next := e.refreshed.Add(e.interval); next.Before(e.due) {
+			e.due = next
+		}
+	}
+}
+
+// Stats implements service.Scheduler.
+func (s *Scheduler) Stats(now time.Time) model.RefreshStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := model.RefreshStats{
+		WindowSeconds: s.recentWindow.Seconds(),
+		Pairs:         make([]model.PairStats, 0, len(s.entries)),
+	}
+
+	for _, e := range s.entries {
+		lane := LaneHot
+		if e.cold {
+			lane = LaneCold
+			stats.Cold++
+		} else {
+			stats.Hot++
+		}
+
+		stats.Pairs = append(stats.Pairs, model.PairStats{
+			Pair:            e.pairs[0].String(),
+			Requests:        e.demand.count(now, s.bucketWidth()),
+			LastRequested:   e.demand.last,
+			Lane:            lane,
+			IntervalSeconds: s.laneInterval(e).Seconds(),
+			Refreshed:       e.refreshed,
+			Due:             e.due,
+		})
+	}
+
+	sort.Slice(stats.Pairs, func(i, j int) bool {
+		if stats.Pairs[i].Requests != stats.Pairs[j].Requests {
+			return stats.Pairs[i].Requests > stats.Pairs[j].Requests
+		}
+
+		return stats.Pairs[i].Pair < stats.Pairs[j].Pair
+	})
+
+	return stats
+}
+
+// Interval returns refresh interval of the pair
+func (s *Scheduler) Interval(pair service.Pair) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.intervalOf(pair)
+}
+
+// intervalOf resolves interval of the pair
+// by overrides, must be called under the lock
+func (s *Scheduler) intervalOf(pair service.Pair) time.Duration {
+	base, target := strings.ToUpper(pair.Base.Symbol), strings.ToUpper(pair.Target.Symbol)
+
+	for _, key := range []string{base + "/" + target, target + "/" + base} {
+		if interval, ok := s.intervals[key]; ok {
+			return interval
+		}
+	}
+
+	interval := time.Duration(0)
+
+	for _, symbol := range []string{base, target} {
+		if i, ok := s.intervals[symbol]; ok && (interval == 0 || i < interval) {
+			interval = i
+		}
+	}
+
+	if interval == 0 {
+		return s.interval
+	}
+
+	return interval
+}
+
+// laneInterval returns refresh interval of the pair in
+// its current lane, must be called under the lock
+func (s *Scheduler) laneInterval(e *entry) time.Duration {
+	if e.cold && s.coldInterval > e.interval {
+		return s.coldInterval
+	}
+
+	return e.interval
+}
+
+// bucketWidth returns duration of the
+// sliding window bucket
+func (s *Scheduler) bucketWidth() time.Duration {
+	return s.recentWindow / windowBuckets
+}
+
+// jittered returns interval deviated by
+// random jitter, must be called under the lock
+func (s *Scheduler) jittered(interval time.Duration) time.Duration {
+	return interval + time.Duration((s.random()*2-1)*s.jitter*float64(interval))
+}
@@ -0,0 +1,226 @@
+package schedule
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+)
+
+var (
+	btc = model.Currency{Symbol: "BTC", CurrencyType: model.Crypto}
+	eth = model.Currency{Symbol: "ETH", CurrencyType: model.Crypto}
+	usd = model.Currency{Symbol: "USD", CurrencyType: model.Fiat}
+	thb = model.Currency{Symbol: "THB", CurrencyType: model.Fiat}
+)
+
+func names(pairs []service.Pair) []string {
+	result := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		result = append(result, p.String())
+	}
+
+	return result
+}
+
+func TestInterval(t *testing.T) {
+	s := New(WithInterval(time.Minute), WithIntervals(map[string]time.Duration{
+		"btc/usd": time.Second * 10,
+		"BTC":     time.Second * 30,
+		"THB":     time.Hour,
+	}))
+
+	tests := []struct {
+		pair service.Pair
+		want time.Duration
+	}{
+		{pair: service.Pair{Base: btc, Target: usd}, want: time.Second * 10},
+		{pair: service.Pair{Base: usd, Target: btc}, want: time.Second * 10},
+		{pair: service.Pair{Base: btc, Target: thb}, want: time.Second * 30},
+		{pair: service.Pair{Base: eth, Target: thb}, want: time.Hour},
+		{pair: service.Pair{Base: eth, Target: usd}, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := s.Interval(tt.pair); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.pair, tt.want, got)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New(WithJitter(0), WithIntervals(map[string]time.Duration{"BTC/USD": time.Second * 10}))
+
+	pairs := service.Pairs([]model.Currency{btc, usd})
+	s.Update(pairs, now)
+
+	if due := names(s.Due(now)); !reflect.DeepEqual(due, []string{"BTC/USD", "USD/BTC"}) {
+		t.Fatalf("expected new pairs to be due, got %v", due)
+	}
+
+	s.Refreshed(pairs, nil, now)
+
+	if due := s.Due(now.Add(time.Second * 9)); len(due) != 0 {
+		t.Fatalf("expected no pairs due, got %v", names(due))
+	}
+
+	if due := s.Due(now.Add(time.Second * 10)); len(due) != 2 {
+		t.Fatalf("expected pairs due after interval, got %v", names(due))
+	}
+
+	// currencies changed
+	s.Update(service.Pairs([]model.Currency{btc, eth, usd}), now.Add(time.Second))
+
+	if due := names(s.Due(now.Add(time.Second))); !reflect.DeepEqual(due, []string{"ETH/USD", "USD/ETH"}) {
+		t.Fatalf("expected only new pairs to be due, got %v", due)
+	}
+
+	s.Update(service.Pairs([]model.Currency{eth, usd}), now.Add(time.Second*10))
+
+	if due := names(s.Due(now.Add(time.Second * 10))); !reflect.DeepEqual(due, []string{"ETH/USD", "USD/ETH"}) {
+		t.Fatalf("expected removed pairs to be dropped, got %v", due)
+	}
+}
+
+func TestDuePriority(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New(WithJitter(0), WithMaxPairs(2), WithRecentWindow(time.Minute))
+	s.Update(service.Pairs([]model.Currency{btc, eth, usd}), now)
+
+	s.Requested("USD", "ETH", now)
+	s.Requested("BTC", "USD", now.Add(time.Second))
+
+	if due := names(s.Due(now.Add(time.Second))); !reflect.DeepEqual(due, []string{"BTC/USD", "USD/BTC"}) {
+		t.Fatalf("expected the latest requested pairs first, got %v", due)
+	}
+
+	// requests expire after the window
+	if due := names(s.Due(now.Add(time.Minute * 2))); !reflect.DeepEqual(due, []string{"BTC/USD", "USD/BTC"}) {
+		t.Fatalf("expected pairs by due time, got %v", due)
+	}
+}
+
+func TestDueBothDirections(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New(WithJitter(0.5), WithMaxPairs(1))
+
+	pairs := service.Pairs([]model.Currency{btc, usd})
+	s.Update(pairs, now)
+
+	// directions share the schedule whatever the jitter and limit
+	for i := 0; i < 3; i++ {
+		due := s.Due(now)
+		if names := names(due); !reflect.DeepEqual(names, []string{"BTC/USD", "USD/BTC"}) {
+			t.Fatalf("expected both directions due together, got %v", names)
+		}
+
+		s.Refreshed(due[:1], nil, now)
+		now = now.Add(time.Hour)
+	}
+}
+
+func TestRefreshedRetry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New(WithJitter(0), WithInterval(time.Hour))
+
+	pairs := service.Pairs([]model.Currency{btc, usd})
+	s.Update(pairs, now)
+	s.Refreshed(pairs, map[string]error{"USD/BTC": errors.New("upstream is down")}, now)
+
+	if due := names(s.Due(now.Add(defaultRetryAfter))); !reflect.DeepEqual(due, []string{"BTC/USD", "USD/BTC"}) {
+		t.Fatalf("expected failed pair to be retried, got %v", due)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	s := New(WithJitter(0.5))
+
+	for _, r := range []float64{0, 0.5, 0.999} {
+		s.random = func() float64 { return r }
+
+		if got := s.jittered(time.Minute); got < time.Second*30 || got > time.Second*90 {
+			t.Errorf("expected jittered interval within ±50%%, got %s", got)
+		}
+	}
+}
+
+func TestColdLane(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New(WithJitter(0), WithInterval(time.Minute), WithColdInterval(time.Minute*15),
+		WithRecentWindow(time.Minute*5), WithHotThreshold(2))
+
+	pairs := service.Pairs([]model.Currency{btc, eth, usd})
+	s.Update(pairs, now)
+
+	s.Requested("BTC", "USD", now)
+	s.Requested("USD", "BTC", now)
+	s.Requested("ETH", "USD", now)
+	s.Refreshed(pairs, nil, now)
+
+	if due := names(s.Due(now.Add(time.Minute))); !reflect.DeepEqual(due, []string{"BTC/USD", "USD/BTC"}) {
+		t.Fatalf("expected only hot pairs due, got %v", due)
+	}
+
+	stats := s.Stats(now)
+	if stats.Hot != 1 || stats.Cold != 1 || stats.WindowSeconds != 300 || len(stats.Pairs) != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if p := stats.Pairs[0]; p.Pair != "BTC/USD" || p.Requests != 2 || p.Lane != LaneHot || p.IntervalSeconds != 60 || !p.LastRequested.Equal(now) {
+		t.Errorf("unexpected stats of the hot pair: %+v", p)
+	}
+
+	if p := stats.Pairs[1]; p.Pair != "ETH/USD" || p.Requests != 1 || p.Lane != LaneCold || p.IntervalSeconds != 900 {
+		t.Errorf("unexpected stats of the cold pair: %+v", p)
+	}
+
+	// cold pair is promoted once requested enough
+	s.Requested("ETH", "USD", now.Add(time.Minute*2))
+
+	if due := names(s.Due(now.Add(time.Minute * 2))); !reflect.DeepEqual(due, []string{"ETH/USD", "USD/ETH", "BTC/USD", "USD/BTC"}) {
+		t.Fatalf("expected promoted pairs to be due, got %v", due)
+	}
+
+	// requests leave the window
+	later := now.Add(time.Minute * 10)
+	s.Refreshed(pairs, nil, later)
+
+	if due := s.Due(later.Add(time.Minute)); len(due) != 0 {
+		t.Fatalf("expected every pair in the slow lane, got %v", names(due))
+	}
+
+	if due := s.Due(later.Add(time.Minute * 15)); len(due) != 4 {
+		t.Fatalf("expected every pair due at the cold interval, got %v", names(due))
+	}
+}
+
+func TestCounter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	width := time.Second * 10
+
+	c := counter{}
+	for i := 0; i < 30; i++ {
+		c.add(now.Add(width*time.Duration(i)), width)
+	}
+
+	if n := c.count(now.Add(width*29), width); n != 30 {
+		t.Errorf("expected 30 requests within the window, got %d", n)
+	}
+
+	if n := c.count(now.Add(width*39), width); n != 20 {
+		t.Errorf("expected 20 requests within the window, got %d", n)
+	}
+
+	if n := c.count(now.Add(width*100), width); n != 0 {
+		t.Errorf("expected no requests within the window, got %d", n)
+	}
+}
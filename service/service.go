@@ -2,15 +2,55 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/kylycht/exchange/model"
 )
 
+// LookUp holds rates obtained for all pairs,
+// lookup error is set only when no rate
+// could be obtained at all
 type LookUp struct {
-	FiatToCrypto    map[string]map[string]float64
-	CryptoToFiat    map[string]map[string]float64
-	FiatLookupErr   error
-	CryptoLookupErr error
+	Rates      model.Rates      // rates keyed by base and then by target symbol
+	LookupErr  error            // error of the lookup when every pair failed
+	PairErrors map[string]error // errors of individual pairs keyed by BASE/TARGET
+}
+
+// Pair is a pair of currencies
+// rate is obtained upstream for
+type Pair struct {
+	Base   model.Currency
+	Target model.Currency
+}
+
+// String returns pair as BASE/TARGET
+func (p Pair) String() string {
+	return p.Base.Symbol + "/" + p.Target.Symbol
+}
+
+// Pairs returns pairs obtained upstream for given currencies:
+// every non fiat currency is quoted against every fiat in both
+// directions, remaining pairs are derived from the rate graph
+func Pairs(currencies []model.Currency) []Pair {
+	var fiats, others []model.Currency
+
+	for _, c := range currencies {
+		if c.CurrencyType == model.Fiat {
+			fiats = append(fiats, c)
+		} else {
+			others = append(others, c)
+		}
+	}
+
+	pairs := make([]Pair, 0, 2*len(fiats)*len(others))
+
+	for _, fiat := range fiats {
+		for _, other := range others {
+			pairs = append(pairs, Pair{Base: other, Target: fiat}, Pair{Base: fiat, Target: other})
+		}
+	}
+
+	return pairs
 }
 
 // Exchange interface describes
@@ -24,5 +64,88 @@ type Exchange interface {
 	GetCryptoRates(ctx context.Context, pairs []string) ([]model.ExchangeRate, error)
 
 	// GetAllRates returns all valid rates
-	GetAllRates(ctx context.Context, cryptos, fiats []model.Currency) LookUp
+	// of the pairs of given currencies
+	GetAllRates(ctx context.Context, currencies []model.Currency) LookUp
+
+	// GetPairRates returns valid rates of given pairs only
+	GetPairRates(ctx context.Context, pairs []Pair) LookUp
+}
+
+// Validator interface describes validation
+// of the rates obtained from upstream
+type Validator interface {
+	// Validate returns rates safe to serve given the rates served
+	// so far, rejected rates are replaced by the last good ones
+	// and their pairs are reported as BASE/TARGET
+	Validate(previous, next model.Rates) (model.Rates, []string)
+
+	// Quarantined returns pairs whose
+	// latest rates were rejected
+	Quarantined() []model.Anomaly
+}
+
+// Reconciler interface describes reconciliation
+// of the rates obtained for opposite directions
+type Reconciler interface {
+	// Reconcile measures divergence of every pair obtained in both
+	// directions by the latest refresh and returns served rates
+	// consistent according to the policy
+	Reconcile(currencies []model.Currency, rates, obtained model.Rates) model.Rates
+
+	// Pairs returns pairs to be obtained upstream,
+	// sides derived by the policy are left out
+	Pairs(pairs []Pair) []Pair
+
+	// Latest returns divergences measured
+	// by the latest reconciliation
+	Latest() model.Reconciliation
+}
+
+// Scheduler interface describes refresh
+// schedule of the individual pairs
+type Scheduler interface {
+	// Update schedules pairs of the served currencies, new pairs
+	// are due immediately and pairs no longer served are dropped
+	Update(pairs []Pair, now time.Time)
+
+	// Due returns pairs to refresh ordered by priority
+	Due(now time.Time) []Pair
+
+	// Refreshed reschedules pairs after refresh,
+	// failed pairs are keyed by BASE/TARGET
+	Refreshed(pairs []Pair, failed map[string]error, now time.Time)
+
+	// Requested records that rate of the pair was requested
+	Requested(base, target string, now time.Time)
+
+	// Stats returns demand and schedule of every pair
+	Stats(now time.Time) model.RefreshStats
+}
+
+// Pricer interface describes pricing
+// of the conversions
+type Pricer interface {
+	// Convert converts amount of `from` into `to`
+	// applying spread and fees on top of the mid rate
+	Convert(ctx context.Context, from, to string, amount float64) (model.Conversion, error)
+
+	// ConvertTarget computes amount of `from` required
+	// to receive `target` of `to` after spread and fees
+	ConvertTarget(ctx context.Context, from, to string, target float64) (model.Conversion, error)
+}
+
+// Recorder interface describes audit
+// trail of the served conversions
+type Recorder interface {
+	// Record queues conversion record for
+	// persistence, must not block the caller
+	Record(record model.ConversionRecord)
+}
+
+// Valuer interface describes valuation
+// of the multi-currency baskets
+type Valuer interface {
+	// Value returns total of the holdings in the reporting currency,
+	// current rates are used when `at` is zero
+	Value(ctx context.Context, currency string, holdings []model.Holding, at time.Time) (model.Valuation, error)
 }
@@ -0,0 +1,231 @@
+package valuation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+)
+
+var (
+	// ErrEmptyBasket is returned when there are no holdings to value
+	ErrEmptyBasket = errors.New("no holdings to value")
+	// ErrInvalidHolding is returned for negative or non finite amounts
+	ErrInvalidHolding = errors.New("holding amount must be a non negative number")
+	// ErrHistoryUnavailable is returned when historical rates can not be loaded
+	ErrHistoryUnavailable = errors.New("historical rates are unavailable")
+	// ErrNoCurrency is returned when reporting currency is not set
+	ErrNoCurrency = errors.New("reporting currency is required")
+)
+
+// Valuer values baskets of holdings
+// using a single snapshot of the rates
+type Valuer struct {
+	cache   storage.Cache          // cache provider for current rates
+	history storage.HistoryStorage // persistence provider for historical rates
+}
+
+func New(cache storage.Cache, history storage.HistoryStorage) *Valuer {
+	return &Valuer{
+		cache:   cache,
+		history: history,
+	}
+}
+
+var _ service.Valuer = (*Valuer)(nil)
+
+// Value implements service.Valuer.
+func (v *Valuer) Value(ctx context.Context, currency string, holdings []model.Holding, at time.Time) (model.Valuation, error) {
+	if strings.TrimSpace(currency) == "" {
+		return model.Valuation{}, ErrNoCurrency
+	}
+
+	if len(holdings) == 0 {
+		return model.Valuation{}, ErrEmptyBasket
+	}
+
+	snapshot := v.cache.Snapshot()
+	if at.IsZero() && len(snapshot.Rates) == 0 {
+		return model.Valuation{}, storage.ErrProviderDown
+	}
+
+	if !at.IsZero() {
+		var err error
+
+		snapshot, err = v.history.SnapshotAt(ctx, at)
+		if errors.Is(err, storage.ErrNotFound) {
+			return model.Valuation{}, err
+		}
+
+		if err != nil {
+			return model.Valuation{}, fmt.Errorf("%w: %v", ErrHistoryUnavailable, err)
+		}
+	}
+
+	reporting := v.currency(snapshot, currency)
+
+	valuation := model.Valuation{
+		Currency: reporting.Symbol,
+		Lines:    make([]model.ValuationLine, 0, len(holdings)),
+		RateTime: snapshot.Timestamp,
+	}
+
+	for _, h := range holdings {
+		if h.Amount < 0 || math.IsInf(h.Amount, 0) || math.IsNaN(h.Amount) {
+			return model.Valuation{}, fmt.Errorf("%w: %s", ErrInvalidHolding, h.Symbol)
+		}
+
+		symbol := v.currency(snapshot, h.Symbol).Symbol
+
+		rate, err := Rate(snapshot, symbol, reporting.Symbol)
+		if err != nil {
+			return model.Valuation{}, err
+		}
+
+		line := model.ValuationLine{
+			Symbol: symbol,
+			Amount: h.Amount,
+			Rate:   rate,
+			Value:  round(h.Amount*rate, reporting.Decimals),
+		}
+
+		valuation.Lines = append(valuation.Lines, line)
+		valuation.Total += line.Value
+	}
+
+	valuation.Total = round(valuation.Total, reporting.Decimals)
+
+	return valuation, nil
+}
+
+// Rate returns rate of the pair from the snapshot, pairs
+// missing in the snapshot are derived as cross rates along
+// the shortest path of intermediate currencies in the graph.
+// storage.ErrUnknownSymbol is returned for symbols missing in the
+// snapshot, storage.ErrUnsupportedPair when there is no path and
+// storage.ErrStale when the pair or every path is too old to serve
+func Rate(snapshot model.RateSnapshot, from, to string) (float64, error) {
+	known := symbols(snapshot)
+
+	for _, symbol := range []string{from, to} {
+		if _, ok := known[symbol]; !ok {
+			return 0, fmt.Errorf("%w: %s", storage.ErrUnknownSymbol, symbol)
+		}
+	}
+
+	if from == to {
+		return 1, nil
+	}
+
+	// pair obtained from upstream is served as by the cache
+	if _, ok := snapshot.Rates.Direct(from, to); ok && snapshot.Expired(from, to) {
+		return 0, stale(snapshot, from, to)
+	}
+
+	// sorted so that the same path is chosen for every lookup
+	nodes := make([]string, 0, len(known))
+	for symbol := range known {
+		nodes = append(nodes, symbol)
+	}
+	sort.Strings(nodes)
+
+	// breadth first search keeping rate from `from` to every visited
+	// symbol, legs too old to serve are left out of the paths
+	rates := map[string]float64{from: 1}
+	queue := []string{from}
+	var expired error
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, next := range nodes {
+			if _, visited := rates[next]; visited {
+				continue
+			}
+
+			rate, ok := snapshot.Rates.Direct(current, next)
+			if !ok {
+				continue
+			}
+
+			if snapshot.Expired(current, next) {
+				expired = stale(snapshot, current, next)
+				continue
+			}
+
+			rates[next] = rates[current] * rate
+			if next == to {
+				return rates[next], nil
+			}
+
+			queue = append(queue, next)
+		}
+	}
+
+	if expired != nil {
+		return 0, expired
+	}
+
+	return 0, fmt.Errorf("%w: %s/%s", storage.ErrUnsupportedPair, from, to)
+}
+
+// stale returns storage.ErrStale of the pair as reported by the cache
+func stale(snapshot model.RateSnapshot, from, to string) error {
+	return fmt.Errorf("%w: obtained at %s", storage.ErrStale, snapshot.ObtainedAt(from, to).Format(time.RFC3339))
+}
+
+// symbols returns set of the symbols present in the snapshot
+func symbols(snapshot model.RateSnapshot) map[string]struct{} {
+	result := make(map[string]struct{})
+
+	for base, targets := range snapshot.Rates {
+		result[base] = struct{}{}
+		for target := range targets {
+			result[target] = struct{}{}
+		}
+	}
+
+	return result
+}
+
+// currency resolves symbol into currency served by the cache,
+// type of currencies no longer served is inferred from served
+// currencies quoted against them, as only fiat currencies are
+// quoted against other types
+func (v *Valuer) currency(snapshot model.RateSnapshot, symbol string) model.Currency {
+	if c, ok := v.cache.Currency(symbol); ok {
+		return c
+	}
+
+	symbol = strings.ToUpper(symbol)
+
+	c := model.Currency{Symbol: symbol, CurrencyType: model.Crypto}
+
+	for counterpart := range symbols(snapshot) {
+		if _, ok := snapshot.Rates.Direct(symbol, counterpart); !ok {
+			continue
+		}
+
+		if served, ok := v.cache.Currency(counterpart); ok && served.CurrencyType != model.Fiat {
+			c.CurrencyType = model.Fiat
+			break
+		}
+	}
+
+	c.Decimals = model.DefaultDecimals(c.CurrencyType)
+
+	return c
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,225 @@
+package valuation
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+var snapshot = model.RateSnapshot{
+	Rates: model.Rates{
+		"BTC": {"USD": 60000},
+		"ETH": {"USD": 3000},
+		"XAU": {"USD": 2400},
+		"EUR": {"BTC": 0.000025},
+		"JPY": {"BTC": 0.0000001},
+		"GBP": {"CHF": 1.1},
+	},
+	Timestamp: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		rate     float64
+		err      error
+	}{
+		{name: "direct C2F", from: "BTC", to: "USD", rate: 60000},
+		{name: "inverted C2F", from: "USD", to: "BTC", rate: 1.0 / 60000},
+		{name: "direct F2C", from: "EUR", to: "BTC", rate: 0.000025},
+		{name: "fiat cross rate", from: "EUR", to: "USD", rate: 1.5},
+		{name: "crypto cross rate", from: "ETH", to: "BTC", rate: 0.05},
+		{name: "fiat cross rate through inverted legs", from: "USD", to: "JPY", rate: 1.0 / 60000 / 0.0000001},
+		{name: "metal cross rate", from: "XAU", to: "EUR", rate: 1600},
+		{name: "same currency", from: "USD", to: "USD", rate: 1},
+		{name: "unknown symbol", from: "XXX", to: "USD", err: storage.ErrUnknownSymbol},
+		{name: "unknown target", from: "USD", to: "XXX", err: storage.ErrUnknownSymbol},
+		{name: "unknown same currency", from: "XXX", to: "XXX", err: storage.ErrUnknownSymbol},
+		{name: "no path", from: "GBP", to: "USD", err: storage.ErrUnsupportedPair},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := Rate(snapshot, tt.from, tt.to)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %f, %v", tt.err, rate, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !almostEqual(rate, tt.rate) {
+				t.Errorf("expected rate %v, got %v", tt.rate, rate)
+			}
+		})
+	}
+}
+
+func TestRateStale(t *testing.T) {
+	now := time.Now()
+	snapshot := model.RateSnapshot{
+		Rates:      model.Rates{"BTC": {"USD": 60000}, "ETH": {"USD": 3000}, "EUR": {"BTC": 0.000025, "USD": 1.1}},
+		Timestamp:  now,
+		Timestamps: map[string]time.Time{"BTC/USD": now.Add(-time.Hour * 2)},
+		MaxAge:     time.Hour,
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		rate     float64
+		err      error
+	}{
+		{name: "expired pair", from: "BTC", to: "USD", err: storage.ErrStale},
+		{name: "expired opposite pair", from: "USD", to: "BTC", err: storage.ErrStale},
+		{name: "cross rate around expired leg", from: "ETH", to: "BTC", rate: 3000 / 1.1 * 0.000025},
+		{name: "fresh pair", from: "ETH", to: "USD", rate: 3000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := Rate(snapshot, tt.from, tt.to)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %f, %v", tt.err, rate, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !almostEqual(rate, tt.rate) {
+				t.Errorf("expected rate %v, got %v", tt.rate, rate)
+			}
+		})
+	}
+
+	// every path leads through the expired leg
+	snapshot.Rates = model.Rates{"BTC": {"USD": 60000}, "ETH": {"BTC": 0.05}}
+	if _, err := Rate(snapshot, "ETH", "USD"); !errors.Is(err, storage.ErrStale) {
+		t.Errorf("expected %v, got %v", storage.ErrStale, err)
+	}
+}
+
+func TestValue(t *testing.T) {
+	cache := fake.NewCache(map[string]float64{"BTC/USD": 50000, "ETH/USD": 2000, "BTC/EUR": 40000})
+	v := New(cache, fake.NewHistoryStorage(snapshot))
+
+	tests := []struct {
+		name     string
+		currency string
+		holdings []model.Holding
+		at       time.Time
+		lines    []float64
+		total    float64
+		rateTime time.Time
+		err      error
+	}{
+		{
+			name:     "current rates",
+			currency: "usd",
+			holdings: []model.Holding{{Symbol: "btc", Amount: 1.5}, {Symbol: "ETH", Amount: 2}, {Symbol: "USD", Amount: 100.5}},
+			lines:    []float64{75000, 4000, 100.5},
+			total:    79100.5,
+		},
+		{
+			name:     "fiat cross rate",
+			currency: "EUR",
+			holdings: []model.Holding{{Symbol: "USD", Amount: 100}, {Symbol: "BTC", Amount: 1}},
+			lines:    []float64{80, 40000},
+			total:    40080,
+		},
+		{
+			name:     "crypto reporting currency",
+			currency: "BTC",
+			holdings: []model.Holding{{Symbol: "USD", Amount: 1000}},
+			lines:    []float64{0.02},
+			total:    0.02,
+		},
+		{
+			name:     "historical rates",
+			currency: "USD",
+			holdings: []model.Holding{{Symbol: "BTC", Amount: 1}, {Symbol: "EUR", Amount: 10}},
+			at:       snapshot.Timestamp.Add(time.Hour),
+			lines:    []float64{60000, 15},
+			total:    60015,
+			rateTime: snapshot.Timestamp,
+		},
+		{name: "before history", currency: "USD", holdings: []model.Holding{{Symbol: "BTC", Amount: 1}}, at: snapshot.Timestamp.Add(-time.Hour), err: storage.ErrNotFound},
+		{name: "empty basket", currency: "USD", err: ErrEmptyBasket},
+		{name: "no reporting currency", currency: " ", holdings: []model.Holding{{Symbol: "BTC", Amount: 1}}, err: ErrNoCurrency},
+		{name: "negative amount", currency: "USD", holdings: []model.Holding{{Symbol: "BTC", Amount: -1}}, err: ErrInvalidHolding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valuation, err := v.Value(context.Background(), tt.currency, tt.holdings, tt.at)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(valuation.Lines) != len(tt.lines) {
+				t.Fatalf("expected %d lines, got %+v", len(tt.lines), valuation.Lines)
+			}
+
+			for i, value := range tt.lines {
+				if !almostEqual(valuation.Lines[i].Value, value) {
+					t.Errorf("line %d: expected %v, got %+v", i, value, valuation.Lines[i])
+				}
+			}
+
+			if !almostEqual(valuation.Total, tt.total) || !valuation.RateTime.Equal(tt.rateTime) {
+				t.Errorf("expected total %v at %v, got %+v", tt.total, tt.rateTime, valuation)
+			}
+		})
+	}
+
+	if _, err := v.Value(context.Background(), "USD", []model.Holding{{Symbol: "XXX", Amount: 1}}, time.Time{}); err == nil {
+		t.Error("expected error for unknown symbol")
+	}
+}
+
+func TestValueProviderDown(t *testing.T) {
+	v := New(fake.NewCache(nil), fake.NewHistoryStorage())
+
+	_, err := v.Value(context.Background(), "USD", []model.Holding{{Symbol: "BTC", Amount: 1}}, time.Time{})
+	if !errors.Is(err, storage.ErrProviderDown) {
+		t.Fatalf("expected %v, got %v", storage.ErrProviderDown, err)
+	}
+}
+
+func TestValueHistoryUnavailable(t *testing.T) {
+	history := fake.NewHistoryStorage()
+	history.Err = errors.New("db is down")
+
+	v := New(fake.NewCache(nil), history)
+
+	_, err := v.Value(context.Background(), "USD", []model.Holding{{Symbol: "BTC", Amount: 1}}, time.Now())
+	if !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("expected %v, got %v", ErrHistoryUnavailable, err)
+	}
+}
@@ -7,109 +7,353 @@ import (
 	"sync"
 	"time"
 
+	"github.com/kylycht/exchange/internal/telemetry"
 	"github.com/kylycht/exchange/model"
 	"github.com/kylycht/exchange/service"
 	"github.com/kylycht/exchange/storage"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	refreshInterval = time.Minute
+	retryInterval   = time.Second * 10 // interval of upstream retries while serving stale snapshot
+	scheduleTick    = time.Second      // interval due pairs are checked at with the scheduler
+	loadTimeout     = time.Second * 5  // timeout of loading currencies, transient errors are retried within
+	saveInterval    = time.Second * 5  // min time between snapshot saves, refreshes in between are saved together
 )
 
+// unknown is a template of currencies missing in the registry
+var unknown = model.Currency{CurrencyType: model.Crypto}
+
 type MCache struct {
-	lock               sync.RWMutex                  // rw lock guards store
-	fiatToCrypto       map[string]map[string]float64 // lookup for F2C
-	cryptoToFiat       map[string]map[string]float64 // lookup for C2F
-	ticker             *time.Ticker                  // ticker to update cache every X itnerval
-	exchangeClient     service.Exchange              // exchange client to fetch infromation from
-	doneC              chan struct{}                 // chan to signal ticker stoppage
-	persistenceStorage storage.Storage               // persistence provider to obtain currencies
+	lock               sync.RWMutex               // rw lock guards store
+	rates              model.Rates                // rate graph keyed by base and then by target symbol
+	ticker             *time.Ticker               // ticker to update cache every X itnerval
+	exchangeClient     service.Exchange           // exchange client to fetch infromation from
+	doneC              chan struct{}              // chan to signal ticker stoppage
+	closeOnce          sync.Once                  // guards doneC from being closed twice
+	persistenceStorage storage.Storage            // persistence provider to obtain currencies
+	updatedAt          time.Time                  // time rates were obtained
+	currencies         map[string]model.Currency  // served currencies by symbol
+	symbols            map[string]string          // aliases and chain qualified symbols resolved to the symbol
+	subsLock           sync.Mutex                 // guards subscribers
+	subscribers        map[chan struct{}]struct{} // listeners notified after each refresh
+	validator          service.Validator          // validation of the obtained rates, optional
+	reconciler         service.Reconciler         // reconciliation of the opposite pairs, optional
+	snapshots          storage.SnapshotStorage    // persistence of the latest state for warm start, optional
+	maxSnapshotAge     time.Duration              // snapshots older than that are not served, zero for any age
+	stale              bool                       // rates are served from the snapshot until upstream recovers
+	retryInterval      time.Duration              // interval of upstream retries while stale
+	scheduler          service.Scheduler          // refresh schedule of the individual pairs, optional
+	timestamps         map[string]time.Time       // time pairs were obtained keyed by BASE/TARGET, scheduled refresh only
+	loaded             []model.Currency           // currencies pairs are scheduled for, refresh loop only
+	loadedAt           time.Time                  // time currencies were loaded, refresh loop only
+	currencyFeed       storage.CurrencyFeed       // changes of the currency catalog applied right away, optional
+	savedAt            time.Time                  // time the latest snapshot was saved, refresh loop only
+	unsaved            *model.CacheSnapshot       // snapshot waiting for the save interval, refresh loop only
+}
+
+// Option configures the cache
+type Option func(*MCache)
+
+// WithValidator validates rates of every refresh before
+// they are served, rejected rates keep the last good value
+func WithValidator(validator service.Validator) Option {
+	return func(m *MCache) {
+		m.validator = validator
+	}
+}
+
+// WithReconciler reconciles rates of the opposite pairs
+// after every refresh, following validation if any
+func WithReconciler(reconciler service.Reconciler) Option {
+	return func(m *MCache) {
+		m.reconciler = reconciler
+	}
+}
+
+// WithSnapshots saves state of the cache after every refresh,
+// the saved state is served as stale on start if upstream is down
+// and is not older than maxAge, zero maxAge accepts any age.
+// Rates of any source are not served once older than maxAge
+func WithSnapshots(snapshots storage.SnapshotStorage, maxAge time.Duration) Option {
+	return func(m *MCache) {
+		m.snapshots = snapshots
+		m.maxSnapshotAge = maxAge
+	}
+}
+
+// WithScheduler refreshes only pairs due according to the
+// scheduler instead of every pair each refresh interval,
+// currencies are still reloaded every refresh interval
+func WithScheduler(scheduler service.Scheduler) Option {
+	return func(m *MCache) {
+		m.scheduler = scheduler
+	}
+}
+
+// WithCurrencyFeed applies changes of the currency catalog as soon
+// as they are announced: pairs of removed currencies are dropped and
+// only pairs of added ones are fetched, instead of the next refresh
+func WithCurrencyFeed(feed storage.CurrencyFeed) Option {
+	return func(m *MCache) {
+		m.currencyFeed = feed
+	}
 }
 
-func New(exchangeClient service.Exchange, storage storage.Storage) (storage.Cache, error) {
+func New(exchangeClient service.Exchange, storage storage.Storage, opts ...Option) (storage.Cache, error) {
 	c := &MCache{
 		lock:               sync.RWMutex{},
 		exchangeClient:     exchangeClient,
 		persistenceStorage: storage,
+		subscribers:        make(map[chan struct{}]struct{}),
+		doneC:              make(chan struct{}),
+		retryInterval:      retryInterval,
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
 
 	return c, c.init()
 }
 
+// Close stops periodic refresh of the cache
+func (m *MCache) Close() {
+	m.closeOnce.Do(func() {
+		if m.ticker != nil {
+			m.ticker.Stop()
+		}
+		close(m.doneC)
+	})
+}
+
 // Get implements storage.Cache.
-func (m *MCache) Get(from string, to string) (model.ExchangeRate, error) {
+// Rate is looked up as obtained from upstream
+// and falls back to the inverted opposite pair,
+// rates are served until they are older than
+// the max age of the snapshots
+func (m *MCache) Get(ctx context.Context, pair storage.Pair) (rate model.ExchangeRate, err error) {
+	_, span := telemetry.Tracer().Start(ctx, "cache.Get")
+	defer func() {
+		span.SetAttributes(attribute.String("pair", pair.String()), attribute.Bool("rate.stale", rate.Stale))
+		telemetry.End(span, err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return model.ExchangeRate{}, err
+	}
+
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
-	from = strings.ToUpper(from)
-	to = strings.ToUpper(to)
-
-	// lookup as C2F
-	if ratesMap, ok := m.cryptoToFiat[from]; ok {
-		if rate, isPresent := ratesMap[to]; isPresent {
-			return model.ExchangeRate{
-				Base:   model.Currency{Symbol: from, CurrencyType: model.Crypto},
-				Target: model.Currency{Symbol: to, CurrencyType: model.Fiat},
-				Rate:   rate,
-			}, nil
-		}
-		// fallback to F2C and attempt to derive rate:
-		// 	at this point we know that `from` is crypto symbol
-		// 	but no rate is present in the rates map for given `to` symbol
-		// 	attempt to obtain rate from F2C and calculate rate
-		if fiatsRates, hasFiatRate := m.fiatToCrypto[to]; hasFiatRate {
-			if rate, isPresent := fiatsRates[from]; isPresent {
-				return model.ExchangeRate{
-					Base:   model.Currency{Symbol: from, CurrencyType: model.Crypto},
-					Target: model.Currency{Symbol: to, CurrencyType: model.Fiat},
-					Rate:   1.0 / rate,
-				}, nil
-			}
-		}
+	from := m.resolve(pair.From)
+	to := m.resolve(pair.To)
+
+	if m.rates == nil {
+		return model.ExchangeRate{}, storage.ErrProviderDown
 	}
 
-	// lookup as F2C
-	if ratesMap, ok := m.fiatToCrypto[from]; ok {
-		if rate, isPresent := ratesMap[to]; isPresent {
-			return model.ExchangeRate{
-				Base:   model.Currency{Symbol: from, CurrencyType: model.Fiat},
-				Target: model.Currency{Symbol: to, CurrencyType: model.Crypto},
-				Rate:   rate,
-			}, nil
-		}
-		// fallback to C2F and attempt to derive rate:
-		if rates, hasRates := m.cryptoToFiat[to]; hasRates {
-			if rate, isPresent := rates[from]; isPresent {
-				return model.ExchangeRate{
-					Base:   model.Currency{Symbol: from, CurrencyType: model.Fiat},
-					Target: model.Currency{Symbol: to, CurrencyType: model.Crypto},
-					Rate:   1.0 / rate,
-				}, nil
-			}
+	// snapshot served while upstream is down and pairs kept at
+	// the last good rate by the validator age alike
+	if obtainedAt := m.timestamp(from, to); m.maxSnapshotAge > 0 && time.Since(obtainedAt) > m.maxSnapshotAge {
+		return model.ExchangeRate{}, fmt.Errorf("%w: obtained at %s", storage.ErrStale, obtainedAt.Format(time.RFC3339))
+	}
+
+	if m.scheduler != nil {
+		m.scheduler.Requested(from, to, time.Now())
+	}
+
+	direct, ok := m.rates.Direct(from, to)
+	if !ok {
+		log.Ctx(ctx).Debug().Str("from", from).Str("to", to).Msg("rate is not cached")
+		return model.ExchangeRate{}, m.missing(from, to)
+	}
+
+	return model.ExchangeRate{
+		Base:      m.currency(from),
+		Target:    m.currency(to),
+		Rate:      direct,
+		Timestamp: m.timestamp(from, to),
+		Stale:     m.stale,
+	}, nil
+}
+
+// missing explains why rate of the pair is not cached,
+// must be called under the lock
+func (m *MCache) missing(from, to string) error {
+	for _, symbol := range []string{from, to} {
+		if _, ok := m.currencies[symbol]; !ok {
+			return fmt.Errorf("%w: %s", storage.ErrUnknownSymbol, symbol)
 		}
 	}
 
-	return model.ExchangeRate{}, fmt.Errorf("invalid conversion for pair: %s/%s", from, to)
+	return fmt.Errorf("%w: %s/%s", storage.ErrUnsupportedPair, from, to)
+}
+
+// Currency implements storage.Cache.
+func (m *MCache) Currency(symbol string) (model.Currency, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	c, ok := m.currencies[m.resolve(symbol)]
+	return c, ok
+}
+
+// resolve maps alias or chain qualified
+// symbol to the symbol of the currency,
+// must be called under the lock
+func (m *MCache) resolve(symbol string) string {
+	symbol = strings.ToUpper(symbol)
+	if resolved, ok := m.symbols[symbol]; ok {
+		return resolved
+	}
+
+	return symbol
+}
+
+// currency returns metadata of the served currency or
+// the template of unknown one, must be called under the lock
+func (m *MCache) currency(symbol string) model.Currency {
+	if c, ok := m.currencies[symbol]; ok {
+		return c
+	}
+
+	c := unknown
+	c.Symbol = symbol
+	c.Decimals = model.DefaultDecimals(c.CurrencyType)
+
+	return c
+}
+
+// timestamp returns time rate of the pair was obtained,
+// must be called under the lock
+func (m *MCache) timestamp(from, to string) time.Time {
+	if t, ok := m.timestamps[from+"/"+to]; ok {
+		return t
+	}
+
+	if t, ok := m.timestamps[to+"/"+from]; ok {
+		return t
+	}
+
+	return m.updatedAt
+}
+
+// Snapshot implements storage.Cache.
+// Maps are replaced on every refresh and
+// never modified, so they are shared as is
+func (m *MCache) Snapshot() model.RateSnapshot {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return model.RateSnapshot{
+		Rates:      m.rates,
+		Timestamp:  m.updatedAt,
+		Timestamps: m.timestamps,
+		MaxAge:     m.maxSnapshotAge,
+		Stale:      m.stale,
+	}
+}
+
+// Subscribe implements storage.Cache.
+func (m *MCache) Subscribe() (<-chan struct{}, func()) {
+	// buffered by one so that a slow listener
+	// only misses intermediate refreshes
+	updatesC := make(chan struct{}, 1)
+
+	m.subsLock.Lock()
+	m.subscribers[updatesC] = struct{}{}
+	m.subsLock.Unlock()
+
+	var once sync.Once
+	cancelFn := func() {
+		once.Do(func() {
+			m.subsLock.Lock()
+			delete(m.subscribers, updatesC)
+			m.subsLock.Unlock()
+		})
+	}
+
+	return updatesC, cancelFn
+}
+
+// notify signals all subscribers without blocking
+func (m *MCache) notify() {
+	m.subsLock.Lock()
+	defer m.subsLock.Unlock()
+
+	for updatesC := range m.subscribers {
+		select {
+		case updatesC <- struct{}{}:
+		default:
+		}
+	}
 }
 
 func (m *MCache) init() error {
+	tick := refreshInterval
+	if m.scheduler != nil {
+		tick = scheduleTick
+	}
+
+	interval := tick
+
 	// initialize cache
 	if err := m.loadAndCache(); err != nil {
-		return err
+		if !m.warmStart(err) {
+			return err
+		}
+
+		// scheduler retries failed pairs on its own
+		if m.scheduler == nil {
+			interval = m.retryInterval
+		}
 	}
 
-	m.ticker = time.NewTicker(refreshInterval)
+	var changesC <-chan struct{}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+
+	if m.currencyFeed != nil {
+		var err error
+		if changesC, err = m.currencyFeed.WatchCurrencies(ctx); err != nil {
+			cancelFn()
+			return err
+		}
+	}
+
+	m.ticker = time.NewTicker(interval)
 
 	go func() {
+		defer cancelFn()
+
 		for {
 			select {
 			case <-m.doneC:
 				return
 
+			case <-changesC:
+				if err := m.reload(time.Now()); err != nil {
+					log.Error().Err(err).Msg("unable to apply currency changes")
+				}
+
 			case t := <-m.ticker.C:
-				if err := m.loadAndCache(); err != nil {
-					log.Error().Err(err).Str("time", t.String()).Msg("unable to update cache, retry in 1 minute")
+				if m.snapshots != nil {
+					m.save(t)
+				}
+
+				if err := m.refresh(t); err != nil {
+					log.Error().Err(err).Str("time", t.String()).Dur("retry", interval).Msg("unable to update cache")
+					continue
+				}
+
+				if interval != tick {
+					log.Info().Msg("upstream recovered, stale snapshot replaced")
+					interval = tick
+					m.ticker.Reset(interval)
 				}
 			}
 		}
@@ -118,29 +362,427 @@ func (m *MCache) init() error {
 	return nil
 }
 
-func (m *MCache) loadAndCache() error {
-	fiats, cryptos, err := m.persistenceStorage.Load(context.Background())
-	if err != nil {
-		return err
+// refresh refreshes either every pair or
+// only pairs due according to the scheduler
+func (m *MCache) refresh(now time.Time) error {
+	if m.scheduler == nil {
+		return m.loadAndCache()
+	}
+
+	return m.refreshDue(now)
+}
+
+// warmStart serves rates from the saved snapshot after
+// the initial refresh failed, reports whether it did
+func (m *MCache) warmStart(refreshErr error) bool {
+	if m.snapshots == nil {
+		return false
 	}
 
 	ctx, cancelFn := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancelFn()
 
-	lookup := m.exchangeClient.GetAllRates(ctx, cryptos, fiats)
-
-	if lookup.CryptoLookupErr != nil {
-		return lookup.CryptoLookupErr
+	snapshot, err := m.snapshots.LoadCacheSnapshot(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load cache snapshot")
+		return false
 	}
 
-	if lookup.FiatLookupErr != nil {
-		return lookup.FiatLookupErr
+	age := time.Since(snapshot.Timestamp)
+	if m.maxSnapshotAge > 0 && age > m.maxSnapshotAge {
+		log.Error().Dur("age", age).Dur("maxAge", m.maxSnapshotAge).Msg("cache snapshot is too old to be served")
+		return false
 	}
 
+	m.restore(snapshot, true)
+
+	log.Warn().Err(refreshErr).Time("timestamp", snapshot.Timestamp).Dur("retry", m.retryInterval).
+		Msg("upstream is unavailable, serving stale cache snapshot")
+
+	return true
+}
+
+// restore serves rates and currencies of the snapshot,
+// subscribers are notified unless the snapshot is stale
+func (m *MCache) restore(snapshot model.CacheSnapshot, stale bool) {
+	served, symbols := registry(snapshot.Currencies)
+
 	m.lock.Lock()
-	m.cryptoToFiat = lookup.CryptoToFiat
-	m.fiatToCrypto = lookup.FiatToCrypto
+	m.rates = snapshot.Rates
+	m.timestamps = snapshot.Timestamps
+	m.currencies = served
+	m.symbols = symbols
+	m.updatedAt = snapshot.Timestamp
+	m.stale = stale
 	m.lock.Unlock()
 
+	if !stale {
+		m.notify()
+	}
+}
+
+// pairs returns pairs of the currencies obtained upstream,
+// sides derived by the reconciler are left out
+func (m *MCache) pairs(currencies []model.Currency) []service.Pair {
+	pairs := service.Pairs(currencies)
+	if m.reconciler != nil {
+		pairs = m.reconciler.Pairs(pairs)
+	}
+
+	return pairs
+}
+
+// loadCurrencies loads served currencies within loadTimeout
+func (m *MCache) loadCurrencies(ctx context.Context) ([]model.Currency, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, loadTimeout)
+	defer cancelFn()
+
+	return m.persistenceStorage.Load(ctx)
+}
+
+func (m *MCache) loadAndCache() (err error) {
+	ctx, span := telemetry.Tracer().Start(context.Background(), "cache.refresh",
+		trace.WithAttributes(attribute.String("refresh.mode", "full")))
+	defer func() { telemetry.End(span, err) }()
+
+	currencies, err := m.loadCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+
+	// lookup is bounded by the exchange client
+	// according to the number of pairs fetched
+	pairs := m.pairs(currencies)
+	lookup := m.exchangeClient.GetPairRates(ctx, pairs)
+
+	span.SetAttributes(
+		attribute.Int("refresh.currencies", len(currencies)),
+		attribute.Int("refresh.failed", len(lookup.PairErrors)),
+	)
+
+	if lookup.LookupErr != nil {
+		return lookup.LookupErr
+	}
+
+	for pair, err := range lookup.PairErrors {
+		log.Warn().Err(err).Str("pair", pair).Msg("unable to refresh rate")
+	}
+
+	if m.scheduler != nil {
+		now := time.Now()
+
+		m.scheduler.Update(pairs, now)
+		m.scheduler.Refreshed(pairs, lookup.PairErrors, now)
+		m.loaded, m.loadedAt = currencies, now
+	}
+
+	m.update(currencies, lookup.Rates, false)
+
 	return nil
 }
+
+// refreshDue refreshes pairs due according to the scheduler
+// and merges them into the cached rates, currencies are
+// reloaded and rescheduled every refresh interval
+func (m *MCache) refreshDue(now time.Time) error {
+	if now.Sub(m.loadedAt) >= refreshInterval {
+		currencies, err := m.loadCurrencies(context.Background())
+		if err != nil {
+			return err
+		}
+
+		m.scheduler.Update(m.pairs(currencies), now)
+		m.loaded, m.loadedAt = currencies, now
+	}
+
+	due := m.scheduler.Due(now)
+	if len(due) == 0 {
+		return nil
+	}
+
+	return m.refreshPairs(due, now)
+}
+
+// refreshPairs refreshes due pairs within the span of the refresh
+func (m *MCache) refreshPairs(due []service.Pair, now time.Time) (err error) {
+	ctx, span := telemetry.Tracer().Start(context.Background(), "cache.refresh",
+		trace.WithAttributes(attribute.String("refresh.mode", "scheduled"), attribute.Int("refresh.pairs", len(due))))
+	defer func() { telemetry.End(span, err) }()
+
+	lookup := m.exchangeClient.GetPairRates(ctx, due)
+
+	failed := lookup.PairErrors
+	if lookup.LookupErr != nil {
+		failed = make(map[string]error, len(due))
+		for _, pair := range due {
+			failed[pair.String()] = lookup.LookupErr
+		}
+	}
+
+	m.scheduler.Refreshed(due, failed, now)
+	span.SetAttributes(attribute.Int("refresh.failed", len(failed)))
+
+	if lookup.LookupErr != nil {
+		return lookup.LookupErr
+	}
+
+	for pair, err := range lookup.PairErrors {
+		log.Warn().Err(err).Str("pair", pair).Msg("unable to refresh rate")
+	}
+
+	m.update(m.loaded, lookup.Rates, true)
+
+	return nil
+}
+
+// reload applies changes of the currency catalog, pairs of
+// the added currencies are fetched while the rest are kept
+func (m *MCache) reload(now time.Time) (err error) {
+	ctx, span := telemetry.Tracer().Start(context.Background(), "cache.reload")
+	defer func() { telemetry.End(span, err) }()
+
+	m.lock.RLock()
+	served, stale := m.currencies, m.stale
+	m.lock.RUnlock()
+
+	// every pair is fetched once upstream recovers
+	if stale {
+		return nil
+	}
+
+	currencies, err := m.loadCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+
+	var added []service.Pair
+
+	for _, pair := range m.pairs(currencies) {
+		_, baseServed := served[strings.ToUpper(pair.Base.Symbol)]
+		_, targetServed := served[strings.ToUpper(pair.Target.Symbol)]
+
+		if !baseServed || !targetServed {
+			added = append(added, pair)
+		}
+	}
+
+	if m.scheduler != nil {
+		m.scheduler.Update(m.pairs(currencies), now)
+	}
+
+	rates := make(model.Rates)
+
+	if len(added) > 0 {
+		lookup := m.exchangeClient.GetPairRates(ctx, added)
+
+		failed := lookup.PairErrors
+		if lookup.LookupErr != nil {
+			failed = make(map[string]error, len(added))
+			for _, pair := range added {
+				failed[pair.String()] = lookup.LookupErr
+			}
+		}
+
+		// failed pairs are retried by the next refresh
+		for pair, err := range failed {
+			log.Warn().Err(err).Str("pair", pair).Msg("unable to obtain rate of the added currency")
+		}
+
+		if m.scheduler != nil {
+			m.scheduler.Refreshed(added, failed, now)
+		}
+
+		if lookup.Rates != nil {
+			rates = lookup.Rates
+		}
+	}
+
+	m.loaded, m.loadedAt = currencies, now
+
+	span.SetAttributes(attribute.Int("reload.currencies", len(currencies)), attribute.Int("reload.added", len(added)))
+	log.Info().Int("currencies", len(currencies)).Int("added", len(added)).Msg("currency changes applied")
+
+	m.update(currencies, rates, true)
+
+	return nil
+}
+
+// update validates and reconciles obtained rates and serves them,
+// partial update keeps cached rates of the pairs not obtained
+func (m *MCache) update(currencies []model.Currency, rates model.Rates, partial bool) {
+	m.lock.RLock()
+	previous, timestamps, previousAt := m.rates, m.timestamps, m.updatedAt
+	m.lock.RUnlock()
+
+	var substituted []string
+	if m.validator != nil {
+		rates, substituted = m.validator.Validate(previous, rates)
+	}
+
+	obtained := fresh(rates, substituted)
+	updatedAt := time.Now().UTC()
+
+	switch {
+	case partial:
+		merged, times := merge(currencies, previous, rates, timestamps, previousAt, updatedAt)
+		rates, timestamps = merged, keep(times, substituted, timestamps, previousAt)
+	case len(substituted) > 0:
+		timestamps = keep(obtainedAt(rates, updatedAt), substituted, timestamps, previousAt)
+	default:
+		timestamps = nil
+	}
+
+	if m.reconciler != nil {
+		rates = m.reconciler.Reconcile(currencies, rates, obtained)
+	}
+
+	served, symbols := registry(currencies)
+
+	m.lock.Lock()
+	m.rates = rates
+	m.timestamps = timestamps
+	m.currencies = served
+	m.symbols = symbols
+	m.updatedAt = updatedAt
+	m.stale = false
+	m.lock.Unlock()
+
+	m.notify()
+
+	if m.snapshots != nil {
+		m.unsaved = &model.CacheSnapshot{Rates: rates, Currencies: currencies, Timestamp: updatedAt, Timestamps: timestamps}
+		m.save(updatedAt)
+	}
+}
+
+// save saves the latest snapshot unless the previous one was saved
+// within saveInterval, the refresh loop saves it once the interval
+// passes. Replicas reload every saved snapshot, so that frequent
+// scheduled refreshes are saved together, refresh loop only
+func (m *MCache) save(now time.Time) {
+	if m.unsaved == nil || now.Sub(m.savedAt) < saveInterval {
+		return
+	}
+
+	saveCtx, cancelFn := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancelFn()
+
+	if err := m.snapshots.SaveCacheSnapshot(saveCtx, *m.unsaved); err != nil {
+		log.Error().Err(err).Msg("unable to save cache snapshot")
+		return
+	}
+
+	m.unsaved, m.savedAt = nil, now
+}
+
+// merge returns cached rates of the served currencies updated by the
+// obtained ones along with the time every pair was obtained, cached
+// pairs without time were obtained by the refresh at `since`. Cached
+// maps are shared with readers and therefore copied, not modified
+func merge(currencies []model.Currency, cached, obtained model.Rates, timestamps map[string]time.Time, since, now time.Time) (model.Rates, map[string]time.Time) {
+	served := make(map[string]bool, len(currencies))
+	for _, c := range currencies {
+		served[strings.ToUpper(c.Symbol)] = true
+	}
+
+	rates := make(model.Rates, len(cached))
+	times := make(map[string]time.Time, len(timestamps))
+
+	for base, targets := range cached {
+		for target, rate := range targets {
+			if !served[base] || !served[target] {
+				continue
+			}
+
+			rates.Put(base, target, rate)
+
+			times[base+"/"+target] = since
+			if t, ok := timestamps[base+"/"+target]; ok {
+				times[base+"/"+target] = t
+			}
+		}
+	}
+
+	for base, targets := range obtained {
+		for target, rate := range targets {
+			rates.Put(base, target, rate)
+			times[base+"/"+target] = now
+		}
+	}
+
+	return rates, times
+}
+
+// obtainedAt returns time every pair of the rates was obtained at
+func obtainedAt(rates model.Rates, now time.Time) map[string]time.Time {
+	times := make(map[string]time.Time)
+
+	for base, targets := range rates {
+		for target := range targets {
+			times[base+"/"+target] = now
+		}
+	}
+
+	return times
+}
+
+// fresh returns rates obtained by the refresh, leaving
+// out substituted pairs served at the last good rate
+func fresh(rates model.Rates, substituted []string) model.Rates {
+	if len(substituted) == 0 {
+		return rates
+	}
+
+	skip := make(map[string]bool, len(substituted))
+	for _, pair := range substituted {
+		skip[pair] = true
+	}
+
+	result := make(model.Rates, len(rates))
+
+	for base, targets := range rates {
+		for target, rate := range targets {
+			if !skip[base+"/"+target] {
+				result.Put(base, target, rate)
+			}
+		}
+	}
+
+	return result
+}
+
+// keep restores time the substituted pairs were obtained at, they
+// are served at the last good rate rather than refreshed. Cached pairs
+// without time were obtained by the refresh at `since`
+func keep(times map[string]time.Time, substituted []string, timestamps map[string]time.Time, since time.Time) map[string]time.Time {
+	for _, pair := range substituted {
+		times[pair] = since
+		if t, ok := timestamps[pair]; ok {
+			times[pair] = t
+		}
+	}
+
+	return times
+}
+
+// registry indexes currencies by symbol and maps their aliases
+// and chain qualified symbols, e.g. XBT or USDT-TRC20, to the symbol
+func registry(list []model.Currency) (map[string]model.Currency, map[string]string) {
+	currencies := make(map[string]model.Currency, len(list))
+	symbols := make(map[string]string)
+
+	for _, c := range list {
+		c.Symbol = strings.ToUpper(c.Symbol)
+		currencies[c.Symbol] = c
+
+		for _, alias := range c.Aliases {
+			symbols[strings.ToUpper(alias)] = c.Symbol
+		}
+
+		for _, chain := range c.Chains {
+			symbols[c.Symbol+"-"+strings.ToUpper(chain)] = c.Symbol
+		}
+	}
+
+	return currencies, symbols
+}
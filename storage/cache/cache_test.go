@@ -0,0 +1,1000 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kylycht/exchange/internal/fake"
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service/anomaly"
+	"github.com/kylycht/exchange/service/reconcile"
+	"github.com/kylycht/exchange/service/schedule"
+	"github.com/kylycht/exchange/storage"
+	"github.com/kylycht/exchange/storage/redis"
+)
+
+// pair returns pair of the symbols, tests
+// shadow the storage package with fakes
+func pair(from, to string) storage.Pair {
+	return storage.Pair{From: from, To: to}
+}
+
+func TestGet(t *testing.T) {
+	m := &MCache{
+		rates: model.Rates{
+			"BTC": {"USD": 60000},
+			"ETH": {"USD": 3000},
+			"USD": {"BTC": 0.00002},
+			"EUR": {"BTC": 0.000025, "ETH": 0.0004},
+		},
+	}
+	m.currencies, m.symbols = registry([]model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto},
+		{Symbol: "ETH", CurrencyType: model.Crypto},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+		{Symbol: "EUR", CurrencyType: model.Fiat},
+	})
+
+	tests := []struct {
+		name     string
+		from, to string
+		rate     float64
+		err      error
+	}{
+		{name: "direct C2F", from: "BTC", to: "USD", rate: 60000},
+		{name: "lower case symbols", from: "btc", to: "usd", rate: 60000},
+		{name: "C2F fallback to inverted F2C", from: "BTC", to: "EUR", rate: 1.0 / 0.000025},
+		{name: "C2F fallback to F2C for unknown crypto", from: "ETH", to: "EUR", rate: 1.0 / 0.0004},
+		{name: "direct F2C", from: "USD", to: "BTC", rate: 0.00002},
+		{name: "F2C fallback to inverted C2F", from: "USD", to: "ETH", rate: 1.0 / 3000},
+		{name: "unknown crypto target", from: "USD", to: "DOGE", err: storage.ErrUnknownSymbol},
+		{name: "unknown symbol", from: "XXX", to: "USD", err: storage.ErrUnknownSymbol},
+		{name: "fiat to fiat", from: "USD", to: "EUR", err: storage.ErrUnsupportedPair},
+		{name: "crypto to crypto", from: "BTC", to: "ETH", err: storage.ErrUnsupportedPair},
+		{name: "empty", err: storage.ErrUnknownSymbol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := m.Get(context.Background(), pair(tt.from, tt.to))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %+v, %v", tt.err, rate, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rate.Rate != tt.rate {
+				t.Errorf("expected rate %f, got %f", tt.rate, rate.Rate)
+			}
+		})
+	}
+}
+
+func TestGetUnavailable(t *testing.T) {
+	rates := model.Rates{"BTC": {"USD": 60000}}
+	currencies, symbols := registry([]model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto},
+		{Symbol: "USD", CurrencyType: model.Fiat},
+	})
+
+	cancelled, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		m    *MCache
+		err  error
+	}{
+		{
+			name: "nothing obtained yet",
+			ctx:  context.Background(),
+			m:    &MCache{},
+			err:  storage.ErrProviderDown,
+		},
+		{
+			name: "snapshot older than max age",
+			ctx:  context.Background(),
+			m:    &MCache{rates: rates, currencies: currencies, symbols: symbols, stale: true, updatedAt: time.Now().Add(-time.Hour), maxSnapshotAge: time.Minute},
+			err:  storage.ErrStale,
+		},
+		{
+			name: "cancelled lookup",
+			ctx:  cancelled,
+			m:    &MCache{rates: rates, currencies: currencies, symbols: symbols},
+			err:  context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rate, err := tt.m.Get(tt.ctx, pair("BTC", "USD")); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %+v, %v", tt.err, rate, err)
+			}
+		})
+	}
+
+	// snapshot within max age is served as stale
+	m := &MCache{rates: rates, currencies: currencies, symbols: symbols, stale: true, updatedAt: time.Now(), maxSnapshotAge: time.Minute}
+
+	rate, err := m.Get(context.Background(), pair("BTC", "USD"))
+	if err != nil || !rate.Stale {
+		t.Errorf("expected stale rate, got %+v, %v", rate, err)
+	}
+}
+
+func TestGetCurrencyTypes(t *testing.T) {
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "XAU", CurrencyType: model.Metal, IsAvailable: true},
+		model.Currency{Symbol: "USDT", CurrencyType: model.Stablecoin, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{
+		"BTC/USD": 60000, "USD/BTC": 0.00002,
+		"XAU/USD":  2300,
+		"USDT/USD": 1, "USD/USDT": 1,
+	})
+
+	c, err := New(exchange, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.(*MCache).Close()
+
+	tests := []struct {
+		from, to     string
+		base, target model.Currency
+		rate         float64
+	}{
+		{from: "BTC", to: "USD", base: model.Currency{CurrencyType: model.Crypto}, target: model.Currency{CurrencyType: model.Fiat}, rate: 60000},
+		{from: "USD", to: "BTC", base: model.Currency{CurrencyType: model.Fiat}, target: model.Currency{CurrencyType: model.Crypto}, rate: 0.00002},
+		{from: "XAU", to: "USD", base: model.Currency{CurrencyType: model.Metal}, target: model.Currency{CurrencyType: model.Fiat}, rate: 2300},
+		{from: "USD", to: "XAU", base: model.Currency{CurrencyType: model.Fiat}, target: model.Currency{CurrencyType: model.Metal}, rate: 1.0 / 2300},
+		{from: "USDT", to: "USD", base: model.Currency{CurrencyType: model.Stablecoin}, target: model.Currency{CurrencyType: model.Fiat}, rate: 1},
+	}
+
+	for _, tt := range tests {
+		rate, err := c.Get(context.Background(), pair(tt.from, tt.to))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rate.Rate != tt.rate {
+			t.Errorf("%s/%s: expected rate %f, got %f", tt.from, tt.to, tt.rate, rate.Rate)
+		}
+
+		if rate.Base.CurrencyType != tt.base.CurrencyType || rate.Target.CurrencyType != tt.target.CurrencyType {
+			t.Errorf("%s/%s: unexpected types %s/%s", tt.from, tt.to, rate.Base.CurrencyType, rate.Target.CurrencyType)
+		}
+	}
+
+	if _, err := c.Get(context.Background(), pair("XAU", "BTC")); err == nil {
+		t.Error("expected no rate between non fiat currencies")
+	}
+}
+
+func TestNew(t *testing.T) {
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 0.00002})
+
+	c, err := New(exchange, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.(*MCache).Close()
+
+	rate, err := c.Get(context.Background(), pair("BTC", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rate.Rate != 60000 {
+		t.Errorf("expected rate 60000, got %f", rate.Rate)
+	}
+}
+
+func TestNewFailures(t *testing.T) {
+	currencies := []model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	}
+
+	t.Run("storage", func(t *testing.T) {
+		storage := fake.NewStorage(currencies...)
+		storage.Err = errors.New("db is down")
+
+		if _, err := New(fake.NewExchange(nil), storage); err == nil {
+			t.Fatal("expected storage error")
+		}
+	})
+
+	t.Run("exchange", func(t *testing.T) {
+		exchange := fake.NewExchange(nil)
+		exchange.SetErr(errors.New("upstream is down"))
+
+		if _, err := New(exchange, fake.NewStorage(currencies...)); err == nil {
+			t.Fatal("expected exchange error")
+		}
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 0.00002})
+
+	c, err := New(exchange, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.(*MCache)
+	defer m.Close()
+
+	updatesC, cancelFn := m.Subscribe()
+
+	exchange.SetRate("BTC", "USD", 61000)
+	if err := m.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-updatesC:
+	default:
+		t.Fatal("expected subscriber to be notified")
+	}
+
+	if rate, _ := m.Get(context.Background(), pair("BTC", "USD")); rate.Rate != 61000 {
+		t.Errorf("expected refreshed rate 61000, got %f", rate.Rate)
+	}
+
+	cancelFn()
+
+	if err := m.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-updatesC:
+		t.Fatal("expected cancelled subscriber not to be notified")
+	default:
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 0.00002})
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+
+	c, err := New(exchange, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.(*MCache).Close()
+
+	snapshot := c.Snapshot()
+	if snapshot.Rates["BTC"]["USD"] != 60000 || snapshot.Rates["USD"]["BTC"] != 0.00002 {
+		t.Errorf("unexpected snapshot: %+v", snapshot)
+	}
+
+	rate, err := c.Get(context.Background(), pair("BTC", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.Timestamp.IsZero() || !snapshot.Timestamp.Equal(rate.Timestamp) {
+		t.Errorf("expected snapshot time %v to match rate time %v", snapshot.Timestamp, rate.Timestamp)
+	}
+
+	// snapshot is not affected by the following refresh
+	exchange.SetRate("BTC", "USD", 70000)
+	if err := c.(*MCache).loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.Rates["BTC"]["USD"] != 60000 {
+		t.Errorf("snapshot changed after refresh: %+v", snapshot)
+	}
+
+	if latest := c.Snapshot(); latest.Rates["BTC"]["USD"] != 70000 {
+		t.Errorf("expected refreshed snapshot, got %+v", latest)
+	}
+}
+
+func TestCurrencyMetadata(t *testing.T) {
+	btc := model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true, Decimals: 8, DisplaySymbol: "₿", Aliases: []string{"XBT"}}
+	usdt := model.Currency{Symbol: "USDT", CurrencyType: model.Stablecoin, IsAvailable: true, Decimals: 6, Chains: []string{"ERC20", "TRC20"}}
+	eur := model.Currency{Symbol: "EUR", CurrencyType: model.Fiat, IsAvailable: true, NumericCode: 978, Decimals: 2, DisplaySymbol: "€"}
+	retired := model.Currency{Symbol: "DEM", CurrencyType: model.Fiat, IsAvailable: true, Decimals: 2, ActiveUntil: time.Date(2002, 3, 1, 0, 0, 0, 0, time.UTC)}
+
+	exchange := fake.NewExchange(map[string]float64{"BTC/EUR": 50000, "USDT/EUR": 0.9, "EUR/BTC": 0.00002, "EUR/USDT": 1.1, "BTC/DEM": 100000})
+
+	c, err := New(exchange, fake.NewStorage(btc, usdt, eur, retired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.(*MCache).Close()
+
+	tests := []struct {
+		name     string
+		from, to string
+		base     model.Currency
+		rate     float64
+		wantErr  bool
+	}{
+		{name: "symbol", from: "BTC", to: "EUR", base: btc, rate: 50000},
+		{name: "alias", from: "xbt", to: "EUR", base: btc, rate: 50000},
+		{name: "chain qualified symbol", from: "usdt-trc20", to: "EUR", base: usdt, rate: 0.9},
+		{name: "unknown chain", from: "USDT-BEP20", to: "EUR", wantErr: true},
+		{name: "inactive currency", from: "BTC", to: "DEM", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := c.Get(context.Background(), pair(tt.from, tt.to))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", rate)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rate.Rate != tt.rate || rate.Base.Symbol != tt.base.Symbol || rate.Base.Decimals != tt.base.Decimals {
+				t.Errorf("unexpected rate: %+v", rate)
+			}
+
+			if rate.Target.NumericCode != 978 || rate.Target.DisplaySymbol != "€" {
+				t.Errorf("expected EUR metadata, got %+v", rate.Target)
+			}
+		})
+	}
+
+	if currency, ok := c.Currency("USDT-ERC20"); !ok || currency.Symbol != "USDT" {
+		t.Errorf("expected USDT, got %+v", currency)
+	}
+
+	if _, ok := c.Currency("DEM"); ok {
+		t.Error("expected inactive currency to be unknown")
+	}
+}
+
+func TestValidator(t *testing.T) {
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+	detector := anomaly.New()
+
+	c, err := New(exchange, storage, WithValidator(detector))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.(*MCache)
+	defer m.Close()
+
+	exchange.SetRate("BTC", "USD", 0)
+	exchange.SetRate("USD", "BTC", 0)
+	if err := m.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, symbols := range [][2]string{{"BTC", "USD"}, {"USD", "BTC"}} {
+		rate, err := m.Get(context.Background(), pair(symbols[0], symbols[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if math.IsInf(rate.Rate, 0) || rate.Rate == 0 {
+			t.Fatalf("expected last good rate, got %f", rate.Rate)
+		}
+	}
+
+	if quarantined := detector.Quarantined(); len(quarantined) != 2 {
+		t.Errorf("expected both pairs quarantined, got %+v", quarantined)
+	}
+}
+
+func TestValidatorKeepsTimestamp(t *testing.T) {
+	store := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+
+	c, err := New(exchange, store, WithValidator(anomaly.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.(*MCache)
+	defer m.Close()
+
+	obtainedAt := time.Now().Add(-2 * time.Hour).UTC()
+
+	m.lock.Lock()
+	m.updatedAt, m.maxSnapshotAge = obtainedAt, time.Hour
+	m.lock.Unlock()
+
+	// upstream keeps rejected rate, the last good one is served with its time
+	exchange.SetRate("BTC", "USD", 0)
+
+	currencies, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, partial := range []bool{false, true} {
+		m.update(currencies, exchange.GetAllRates(context.Background(), currencies).Rates, partial)
+
+		if _, err := m.Get(context.Background(), pair("BTC", "USD")); !errors.Is(err, storage.ErrStale) {
+			t.Fatalf("partial %t: expected substituted rate to age, got %v", partial, err)
+		}
+
+		rate, err := m.Get(context.Background(), pair("USD", "BTC"))
+		if err != nil || rate.Timestamp.Equal(obtainedAt) {
+			t.Fatalf("partial %t: expected refreshed rate, got %+v, %v", partial, rate, err)
+		}
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true, Aliases: []string{"XBT"}},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+	snapshots := fake.NewSnapshotStorage(nil)
+
+	c, err := New(exchange, storage, WithSnapshots(snapshots, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*MCache).Close()
+
+	exchange.SetErr(errors.New("upstream is down"))
+	exchange.SetRate("BTC", "USD", 61000)
+
+	// restart while upstream is down
+	m := &MCache{
+		exchangeClient:     exchange,
+		persistenceStorage: storage,
+		subscribers:        make(map[chan struct{}]struct{}),
+		doneC:              make(chan struct{}),
+		snapshots:          snapshots,
+		maxSnapshotAge:     time.Hour,
+		retryInterval:      time.Millisecond * 10,
+	}
+
+	if err := m.init(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	rate, err := m.Get(context.Background(), pair("XBT", "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rate.Rate != 60000 || !rate.Stale || !m.Snapshot().Stale {
+		t.Fatalf("expected stale rate 60000, got %+v", rate)
+	}
+
+	exchange.SetErr(nil)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for rate.Stale && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+		rate, _ = m.Get(context.Background(), pair("BTC", "USD"))
+	}
+
+	if rate.Stale || rate.Rate != 61000 {
+		t.Errorf("expected fresh rate 61000 after upstream recovered, got %+v", rate)
+	}
+}
+
+func TestSnapshotTimestamps(t *testing.T) {
+	store := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+	snapshots := fake.NewSnapshotStorage(nil)
+
+	leader := &MCache{
+		exchangeClient:     exchange,
+		persistenceStorage: store,
+		subscribers:        make(map[chan struct{}]struct{}),
+		validator:          anomaly.New(),
+		snapshots:          snapshots,
+		maxSnapshotAge:     time.Hour,
+	}
+
+	if err := leader.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	// leader keeps the last good rate obtained long ago
+	obtainedAt := time.Now().Add(-2 * time.Hour).UTC()
+	leader.updatedAt = obtainedAt
+	leader.savedAt = time.Time{}
+	exchange.SetRate("BTC", "USD", 0)
+
+	if err := leader.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := snapshots.LoadCacheSnapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follower := &MCache{subscribers: make(map[chan struct{}]struct{}), maxSnapshotAge: time.Hour}
+	follower.restore(snapshot, false)
+
+	if _, err := follower.Get(context.Background(), pair("BTC", "USD")); !errors.Is(err, storage.ErrStale) {
+		t.Errorf("expected pair obtained long ago to be stale, got %v", err)
+	}
+
+	if rate, err := follower.Get(context.Background(), pair("USD", "BTC")); err != nil || !rate.Timestamp.Equal(snapshot.Timestamp) {
+		t.Errorf("expected pair obtained by the latest refresh, got %+v, %v", rate, err)
+	}
+}
+
+func TestSnapshotSaveInterval(t *testing.T) {
+	store := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+	snapshots := fake.NewSnapshotStorage(nil)
+
+	m := &MCache{
+		exchangeClient:     exchange,
+		persistenceStorage: store,
+		subscribers:        make(map[chan struct{}]struct{}),
+		snapshots:          snapshots,
+		scheduler:          schedule.New(schedule.WithJitter(0), schedule.WithInterval(time.Second)),
+	}
+
+	if err := m.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	// refreshes within the interval are saved together
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		exchange.SetRate("BTC", "USD", 60000+float64(i))
+
+		if err := m.refreshDue(start.Add(time.Second * time.Duration(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := snapshots.Saves(); n != 1 {
+		t.Fatalf("expected single save within the interval, got %d", n)
+	}
+
+	m.save(m.savedAt.Add(saveInterval))
+
+	snapshot, err := snapshots.LoadCacheSnapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := snapshots.Saves(); n != 2 || snapshot.Rates["BTC"]["USD"] != 60003 {
+		t.Fatalf("expected the latest rates saved once interval passed, got %d saves of %v", n, snapshot.Rates)
+	}
+}
+
+func TestWarmStartFailures(t *testing.T) {
+	currencies := []model.Currency{
+		{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	}
+
+	exchange := fake.NewExchange(nil)
+	exchange.SetErr(errors.New("upstream is down"))
+
+	t.Run("no snapshot", func(t *testing.T) {
+		if _, err := New(exchange, fake.NewStorage(currencies...), WithSnapshots(fake.NewSnapshotStorage(nil), 0)); err == nil {
+			t.Fatal("expected exchange error")
+		}
+	})
+
+	t.Run("too old", func(t *testing.T) {
+		snapshots := fake.NewSnapshotStorage(&model.CacheSnapshot{
+			Rates:      model.Rates{"BTC": {"USD": 60000}},
+			Currencies: currencies,
+			Timestamp:  time.Now().Add(-time.Hour * 2),
+		})
+
+		if _, err := New(exchange, fake.NewStorage(currencies...), WithSnapshots(snapshots, time.Hour)); err == nil {
+			t.Fatal("expected exchange error")
+		}
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "ETH", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{
+		"BTC/USD": 60000, "USD/BTC": 1.0 / 60000,
+		"ETH/USD": 3000, "USD/ETH": 1.0 / 3000,
+		"XRP/USD": 0.5, "USD/XRP": 2,
+	})
+
+	m := &MCache{
+		exchangeClient:     exchange,
+		persistenceStorage: storage,
+		subscribers:        make(map[chan struct{}]struct{}),
+		scheduler: schedule.New(
+			schedule.WithJitter(0),
+			schedule.WithIntervals(map[string]time.Duration{"BTC/USD": time.Second * 10}),
+		),
+	}
+
+	if err := m.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	exchange.SetRate("BTC", "USD", 61000)
+	exchange.SetRate("ETH", "USD", 3100)
+	calls := exchange.CallCount()
+
+	if err := m.refreshDue(start.Add(time.Second * 11)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := exchange.CallCount() - calls; n != 2 {
+		t.Errorf("expected only BTC/USD pairs to be refreshed, got %d calls", n)
+	}
+
+	btc, _ := m.Get(context.Background(), pair("BTC", "USD"))
+	eth, _ := m.Get(context.Background(), pair("ETH", "USD"))
+
+	if btc.Rate != 61000 || eth.Rate != 3000 || !btc.Timestamp.After(eth.Timestamp) {
+		t.Errorf("unexpected rates after scheduled refresh: %+v, %+v", btc, eth)
+	}
+
+	// currencies are reloaded every refresh interval
+	storage.Currencies[1].IsAvailable = false
+	storage.Currencies = append(storage.Currencies, model.Currency{Symbol: "XRP", CurrencyType: model.Crypto, IsAvailable: true})
+
+	if err := m.refreshDue(start.Add(refreshInterval + time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rate, err := m.Get(context.Background(), pair("XRP", "USD")); err != nil || rate.Rate != 0.5 {
+		t.Errorf("expected added currency to be served, got %+v, %v", rate, err)
+	}
+
+	if _, err := m.Get(context.Background(), pair("ETH", "USD")); err == nil {
+		t.Error("expected removed currency not to be served")
+	}
+
+	// requests are counted for both directions of the pair
+	for _, p := range m.scheduler.Stats(time.Now()).Pairs {
+		if (p.Pair == "BTC/USD" || p.Pair == "USD/BTC") && p.Requests != 1 {
+			t.Errorf("expected single request of %s, got %d", p.Pair, p.Requests)
+		}
+	}
+}
+
+func TestSchedulerValidatesInverse(t *testing.T) {
+	store := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+	detector := anomaly.New()
+
+	// single pair per tick used to split the directions over ticks
+	m := &MCache{
+		exchangeClient:     exchange,
+		persistenceStorage: store,
+		subscribers:        make(map[chan struct{}]struct{}),
+		validator:          detector,
+		scheduler:          schedule.New(schedule.WithMaxPairs(1), schedule.WithInterval(time.Second*10)),
+	}
+
+	if err := m.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	// within max deviation, but off the inverted opposite rate by 9%
+	exchange.SetRate("USD", "BTC", 1.0/55000)
+
+	start := time.Now()
+	for _, tick := range []time.Duration{time.Second * 12, time.Second * 24} {
+		if err := m.refreshDue(start.Add(tick)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rate, err := m.Get(context.Background(), pair("USD", "BTC"))
+	if err != nil || rate.Rate != 1.0/60000 {
+		t.Fatalf("expected outlier to be rejected, got %+v, %v", rate, err)
+	}
+
+	if quarantined := detector.Quarantined(); len(quarantined) != 2 {
+		t.Errorf("expected both directions quarantined, got %+v", quarantined)
+	}
+}
+
+func TestSchedulerReconciles(t *testing.T) {
+	store := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 59400})
+	reconciler := reconcile.New(reconcile.PolicyC2F)
+
+	m := &MCache{
+		exchangeClient:     exchange,
+		persistenceStorage: store,
+		subscribers:        make(map[chan struct{}]struct{}),
+		reconciler:         reconciler,
+		scheduler:          schedule.New(schedule.WithJitter(0), schedule.WithInterval(time.Second*10)),
+	}
+
+	if err := m.loadAndCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	exchange.SetRate("BTC", "USD", 61000)
+
+	if err := m.refreshDue(time.Now().Add(time.Second * 11)); err != nil {
+		t.Fatal(err)
+	}
+
+	// derived side is neither scheduled nor fetched
+	if n := exchange.CallCount(); n != 2 {
+		t.Errorf("expected only BTC/USD to be fetched, got %d calls", n)
+	}
+
+	rate, err := m.Get(context.Background(), pair("USD", "BTC"))
+	if err != nil || rate.Rate != 1.0/61000 {
+		t.Errorf("expected derived rate, got %+v, %v", rate, err)
+	}
+
+	if latest := reconciler.Latest(); len(latest.Pairs) != 0 {
+		t.Errorf("expected no divergence of the derived side, got %+v", latest.Pairs)
+	}
+}
+
+func TestReplicated(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true, Aliases: []string{"XBT"}},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000, "USD/BTC": 1.0 / 60000})
+
+	replica := func(id string) *Replicated {
+		t.Helper()
+
+		r := &Replicated{
+			local: &MCache{
+				subscribers: make(map[chan struct{}]struct{}),
+				doneC:       make(chan struct{}),
+			},
+			elector:            redis.NewElector(client, "exchange:leader", id, time.Second),
+			feed:               redis.NewFeed(client, "exchange:snapshot", "exchange:snapshots"),
+			exchangeClient:     exchange,
+			persistenceStorage: storage,
+			campaignInterval:   time.Millisecond * 50,
+			doneC:              make(chan struct{}),
+		}
+
+		if err := r.init(); err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	awaitRate := func(r *Replicated, expected float64) {
+		t.Helper()
+
+		var rate model.ExchangeRate
+
+		deadline := time.Now().Add(time.Second * 5)
+		for rate.Rate != expected && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 10)
+			rate, _ = r.Get(context.Background(), pair("XBT", "USD"))
+		}
+
+		if rate.Rate != expected {
+			t.Fatalf("expected rate %v, got %+v", expected, rate)
+		}
+	}
+
+	leader := replica("leader")
+	defer leader.Close()
+
+	follower := replica("follower")
+	defer follower.Close()
+
+	if leader.leader == nil {
+		t.Fatal("expected first replica to lead")
+	}
+
+	// both directions of the single pair
+	if exchange.CallCount() != 2 {
+		t.Errorf("expected upstream to be called by the leader only, got %d calls", exchange.CallCount())
+	}
+
+	awaitRate(follower, 60000)
+
+	// follower takes over refresh once the leader is gone
+	exchange.SetRate("BTC", "USD", 61000)
+	leader.Close()
+
+	awaitRate(follower, 61000)
+}
+
+func TestCurrencyFeed(t *testing.T) {
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{
+		"BTC/USD": 60000, "USD/BTC": 1.0 / 60000,
+		"ETH/USD": 3000, "USD/ETH": 1.0 / 3000,
+	})
+	feed := fake.NewCurrencyFeed()
+
+	c, err := New(exchange, storage, WithCurrencyFeed(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.(*MCache).Close()
+
+	await := func(condition func() bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(time.Second * 5)
+		for !condition() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		if !condition() {
+			t.Fatal("currency change was not applied")
+		}
+	}
+
+	if err := storage.AddCurrency(context.Background(), model.Currency{Symbol: "ETH", CurrencyType: model.Crypto, IsAvailable: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	feed.Notify()
+
+	await(func() bool {
+		rate, err := c.Get(context.Background(), pair("ETH", "USD"))
+		return err == nil && rate.Rate == 3000
+	})
+
+	// only pairs of the added currency are fetched
+	if calls := exchange.CallCount(); calls != 4 {
+		t.Errorf("expected 4 upstream calls, got %d", calls)
+	}
+
+	if rate, err := c.Get(context.Background(), pair("BTC", "USD")); err != nil || rate.Rate != 60000 {
+		t.Errorf("expected cached BTC/USD rate 60000, got %+v, %v", rate, err)
+	}
+
+	if err := storage.DisableCurrency(context.Background(), "BTC"); err != nil {
+		t.Fatal(err)
+	}
+
+	feed.Notify()
+
+	await(func() bool {
+		_, err := c.Get(context.Background(), pair("BTC", "USD"))
+		_, known := c.Currency("BTC")
+		return err != nil && !known
+	})
+
+	if calls := exchange.CallCount(); calls != 4 {
+		t.Errorf("expected no upstream calls on removal, got %d", calls-4)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	storage := fake.NewStorage(
+		model.Currency{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true},
+		model.Currency{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true},
+	)
+	exchange := fake.NewExchange(map[string]float64{"BTC/USD": 60000})
+
+	c, err := New(exchange, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.(*MCache).Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "convert")
+	if _, err := c.Get(ctx, pair("BTC", "USD")); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range exporter.GetSpans().Snapshots() {
+		spans[span.Name()] = span
+	}
+
+	attributes := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		attributes := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			attributes[kv.Key] = kv.Value
+		}
+
+		return attributes
+	}
+
+	refresh, ok := spans["cache.refresh"]
+	if !ok {
+		t.Fatal("expected refresh span")
+	}
+
+	// USD/BTC is not quoted by the exchange
+	if a := attributes(refresh); a["refresh.mode"].AsString() != "full" || a["refresh.failed"].AsInt64() != 1 {
+		t.Errorf("unexpected refresh attributes %v", refresh.Attributes())
+	}
+
+	get, ok := spans["cache.Get"]
+	if !ok {
+		t.Fatal("expected get span")
+	}
+
+	if get.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected get span of the caller, got parent %s", get.Parent().SpanID())
+	}
+
+	if a := attributes(get); a["pair"].AsString() != "BTC/USD" || a["rate.stale"].AsBool() {
+		t.Errorf("unexpected get attributes %v", get.Attributes())
+	}
+}
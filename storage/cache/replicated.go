@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/service"
+	"github.com/kylycht/exchange/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	campaignInterval = time.Second * 5  // interval leadership is acquired or renewed at
+	campaignTimeout  = time.Second * 3  // timeout of the single campaign
+	syncTimeout      = time.Second * 10 // timeout of loading snapshot from the feed
+)
+
+// Replicated is storage.Cache shared by replicas of the service.
+// Only the elected leader runs MCache refreshing rates from upstream,
+// which saves every refresh to the feed. Every replica, the leader
+// included, serves rates of the latest snapshot from the feed
+type Replicated struct {
+	local              *MCache              // passive cache serving rates of the feed
+	leader             *MCache              // refreshing cache while the instance leads, nil otherwise
+	elector            storage.Elector      // election of the replica refreshing rates
+	feed               storage.SnapshotFeed // distribution of the rates from the leader
+	exchangeClient     service.Exchange     // exchange client used by the leader
+	persistenceStorage storage.Storage      // persistence provider used by the leader
+	opts               []Option             // options of the leader cache
+	campaignInterval   time.Duration        // interval leadership is acquired or renewed at
+	cancelFn           func()               // stops watching the feed
+	doneC              chan struct{}        // chan to signal loop stoppage
+	closeOnce          sync.Once            // guards doneC from being closed twice
+	wg                 sync.WaitGroup       // waits for the loop on close
+}
+
+// NewReplicated creates cache shared by replicas, options configure
+// cache of the leader, scheduler is shared by both so that requests
+// served by the instance are accounted once it becomes the leader
+func NewReplicated(elector storage.Elector, feed storage.SnapshotFeed, exchangeClient service.Exchange, storage storage.Storage, opts ...Option) (storage.Cache, error) {
+	local := &MCache{
+		subscribers: make(map[chan struct{}]struct{}),
+		doneC:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(local)
+	}
+
+	r := &Replicated{
+		local:              local,
+		elector:            elector,
+		feed:               feed,
+		exchangeClient:     exchangeClient,
+		persistenceStorage: storage,
+		opts:               opts,
+		campaignInterval:   campaignInterval,
+		doneC:              make(chan struct{}),
+	}
+
+	return r, r.init()
+}
+
+// Get implements storage.Cache.
+func (r *Replicated) Get(ctx context.Context, pair storage.Pair) (model.ExchangeRate, error) {
+	return r.local.Get(ctx, pair)
+}
+
+// Currency implements storage.Cache.
+func (r *Replicated) Currency(symbol string) (model.Currency, bool) {
+	return r.local.Currency(symbol)
+}
+
+// Snapshot implements storage.Cache.
+func (r *Replicated) Snapshot() model.RateSnapshot {
+	return r.local.Snapshot()
+}
+
+// Subscribe implements storage.Cache.
+// Subscribers are notified on every snapshot from the feed
+func (r *Replicated) Subscribe() (<-chan struct{}, func()) {
+	return r.local.Subscribe()
+}
+
+// Close stops refresh if the instance leads
+// and releases leadership for the followers
+func (r *Replicated) Close() {
+	r.closeOnce.Do(func() {
+		close(r.doneC)
+		r.wg.Wait()
+		r.cancelFn()
+
+		r.stepDown()
+	})
+}
+
+func (r *Replicated) init() error {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	r.cancelFn = cancelFn
+
+	// watch before the first campaign so that
+	// snapshot of the new leader is not missed
+	updatesC, err := r.feed.Watch(ctx)
+	if err != nil {
+		cancelFn()
+		return err
+	}
+
+	leadErr := r.campaign()
+
+	if err := r.sync(); err != nil {
+		if leadErr != nil {
+			cancelFn()
+			return errors.Join(leadErr, err)
+		}
+
+		// followers start empty until the leader saves rates
+		log.Warn().Err(err).Msg("unable to load rates from the feed")
+	}
+
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.campaignInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.doneC:
+				return
+
+			case <-ticker.C:
+				_ = r.campaign()
+
+			case <-updatesC:
+				if err := r.sync(); err != nil {
+					log.Error().Err(err).Msg("unable to load rates from the feed")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// campaign acquires or renews leadership, cache of the leader is
+// started once elected and stopped once the leadership is lost.
+// Error is returned if the leader was elected but failed to start
+func (r *Replicated) campaign() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), campaignTimeout)
+	defer cancelFn()
+
+	isLeader, err := r.elector.Campaign(ctx)
+	if err != nil {
+		// lease is not renewed and will be taken by
+		// another replica, stop refresh to avoid two leaders
+		log.Error().Err(err).Msg("unable to campaign for leadership")
+		isLeader = false
+	}
+
+	switch {
+	case isLeader && r.leader == nil:
+		leader, err := r.newLeader()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to start refresh as the leader, resigning")
+
+			if err := r.elector.Resign(ctx); err != nil {
+				log.Error().Err(err).Msg("unable to resign leadership")
+			}
+
+			return err
+		}
+
+		r.leader = leader
+		log.Info().Msg("elected as the leader, refreshing rates")
+
+	case !isLeader && r.leader != nil:
+		r.leader.Close()
+		r.leader = nil
+		log.Warn().Msg("leadership lost, following")
+	}
+
+	return nil
+}
+
+// newLeader starts cache refreshing rates into the feed
+func (r *Replicated) newLeader() (*MCache, error) {
+	m := &MCache{
+		exchangeClient:     r.exchangeClient,
+		persistenceStorage: r.persistenceStorage,
+		subscribers:        make(map[chan struct{}]struct{}),
+		doneC:              make(chan struct{}),
+		retryInterval:      retryInterval,
+	}
+
+	for _, opt := range r.opts {
+		opt(m)
+	}
+
+	// feed replaces other snapshot storages,
+	// max age of the snapshot is kept
+	m.snapshots = r.feed
+
+	return m, m.init()
+}
+
+// stepDown stops refresh and releases leadership
+func (r *Replicated) stepDown() {
+	if r.leader == nil {
+		return
+	}
+
+	r.leader.Close()
+	r.leader = nil
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), campaignTimeout)
+	defer cancelFn()
+
+	if err := r.elector.Resign(ctx); err != nil {
+		log.Error().Err(err).Msg("unable to resign leadership")
+	}
+}
+
+// sync serves the latest snapshot of the feed
+func (r *Replicated) sync() error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancelFn()
+
+	snapshot, err := r.feed.LoadCacheSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.local.restore(snapshot, false)
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/kylycht/exchange/storage"
+)
+
+const currencyChannel = "currency_changed" // channel notified by the trigger on every currency change
+
+// CurrencyFeed announces changes of the currency table
+// made by the trigger, listener is the same as of SnapshotFeed
+type CurrencyFeed struct {
+	dsn string // connection string of the listener
+}
+
+func NewCurrencyFeed(dsn string) storage.CurrencyFeed {
+	return &CurrencyFeed{
+		dsn: dsn,
+	}
+}
+
+// WatchCurrencies implements storage.CurrencyFeed.
+// Reconnect of the listener is signalled as well,
+// since changes made meanwhile are not announced
+func (f *CurrencyFeed) WatchCurrencies(ctx context.Context) (<-chan struct{}, error) {
+	return listen(ctx, f.dsn, currencyChannel)
+}
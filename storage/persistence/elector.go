@@ -0,0 +1,83 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/kylycht/exchange/storage"
+)
+
+// Elector elects the leader by session level advisory lock,
+// lock is held by the dedicated connection and is released
+// by the database as soon as the session of the leader ends
+type Elector struct {
+	dbConn *sql.DB    // pool the lock connection is taken from
+	key    string     // name of the lock, hashed to the lock id
+	lock   sync.Mutex // guards conn
+	conn   *sql.Conn  // connection holding the lock, nil unless the leader
+}
+
+func NewElector(dbConn *sql.DB, key string) storage.Elector {
+	return &Elector{
+		dbConn: dbConn,
+		key:    key,
+	}
+}
+
+// Campaign implements storage.Elector.
+// Leadership is renewed by checking the session holding the lock
+func (e *Elector) Campaign(ctx context.Context) (bool, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.conn != nil {
+		if err := e.conn.PingContext(ctx); err != nil {
+			// lock is gone together with the session
+			e.conn.Close()
+			e.conn = nil
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	conn, err := e.dbConn.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, e.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, err
+	}
+
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+
+	e.conn = conn
+
+	return true, nil
+}
+
+// Resign implements storage.Elector.
+func (e *Elector) Resign(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+
+	defer func() {
+		e.conn.Close()
+		e.conn = nil
+	}()
+
+	_, err := e.conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, e.key)
+	return err
+}
@@ -0,0 +1,81 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kylycht/exchange/storage"
+)
+
+const (
+	snapshotChannel      = "cache_snapshot" // channel notified by the trigger on every saved snapshot
+	minReconnectInterval = time.Second      // listener reconnects no sooner than that
+	maxReconnectInterval = time.Second * 30 // listener backs off to that at most
+	listenerPingInterval = time.Second * 90 // listener checks connection if idle for that long
+)
+
+// SnapshotFeed is the snapshot table announced by trigger,
+// announcements are received by LISTEN on the dedicated
+// connection which is reestablished once broken
+type SnapshotFeed struct {
+	SnapshotStore
+
+	dsn string // connection string of the listener
+}
+
+func NewSnapshotFeed(dbConn *sql.DB, dsn string) storage.SnapshotFeed {
+	return &SnapshotFeed{
+		SnapshotStore: SnapshotStore{dbConn: dbConn},
+		dsn:           dsn,
+	}
+}
+
+// Watch implements storage.SnapshotFeed.
+// Reconnect of the listener is signalled as well,
+// since snapshots saved meanwhile are not announced
+func (f *SnapshotFeed) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return listen(ctx, f.dsn, snapshotChannel)
+}
+
+// listen forwards notifications of the channel,
+// notifications not consumed yet are coalesced
+func listen(ctx context.Context, dsn string, channel string) (<-chan struct{}, error) {
+	listener := pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Error().Err(err).Str("channel", channel).Msg("listener connection failed")
+		}
+	})
+
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	updatesC := make(chan struct{}, 1)
+
+	go func() {
+		defer listener.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-listener.Notify:
+				select {
+				case updatesC <- struct{}{}:
+				default:
+				}
+
+			case <-time.After(listenerPingInterval):
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return updatesC, nil
+}
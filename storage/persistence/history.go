@@ -0,0 +1,121 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+const historyBatchSize = 1000 // rates inserted by a single statement
+
+type HistoryStore struct {
+	dbConn *sql.DB
+}
+
+func NewHistoryStore(dbConn *sql.DB) storage.HistoryStorage {
+	return &HistoryStore{
+		dbConn: dbConn,
+	}
+}
+
+// SaveSnapshot implements storage.HistoryStorage.
+func (h *HistoryStore) SaveSnapshot(ctx context.Context, snapshot model.RateSnapshot) error {
+	var rows [][]interface{}
+
+	for base, rates := range snapshot.Rates {
+		for target, rate := range rates {
+			rows = append(rows, []interface{}{snapshot.Timestamp, base, target, rate})
+		}
+	}
+
+	tx, err := h.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(rows); start += historyBatchSize {
+		end := start + historyBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var (
+			placeholders []string
+			args         []interface{}
+		)
+
+		for _, row := range rows[start:end] {
+			params := make([]string, len(row))
+			for i := range row {
+				params[i] = fmt.Sprintf("$%d", len(args)+i+1)
+			}
+
+			placeholders = append(placeholders, "("+strings.Join(params, ", ")+")")
+			args = append(args, row...)
+		}
+
+		// replicas archive the same snapshot, the first one wins
+		saveQuery := `INSERT INTO rate_history(taken_at, base_symbol, target_symbol, rate)
+					 VALUES ` + strings.Join(placeholders, ", ") + `
+					 ON CONFLICT (taken_at, base_symbol, target_symbol) DO NOTHING`
+
+		if _, err := tx.ExecContext(ctx, saveQuery, args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SnapshotAt implements storage.HistoryStorage.
+func (h *HistoryStore) SnapshotAt(ctx context.Context, at time.Time) (model.RateSnapshot, error) {
+	snapshot := model.RateSnapshot{
+		Rates: make(model.Rates),
+	}
+
+	takenAtQuery := `SELECT MAX(taken_at) FROM rate_history WHERE taken_at <= $1`
+
+	var takenAt sql.NullTime
+
+	err := retry(ctx, func(ctx context.Context) error {
+		return h.dbConn.QueryRowContext(ctx, takenAtQuery, at).Scan(&takenAt)
+	})
+	if err != nil {
+		return snapshot, err
+	}
+
+	if !takenAt.Valid {
+		return snapshot, storage.ErrNotFound
+	}
+
+	snapshot.Timestamp = takenAt.Time
+
+	ratesQuery := `SELECT base_symbol, target_symbol, rate FROM rate_history WHERE taken_at = $1`
+
+	rows, err := query(ctx, h.dbConn, ratesQuery, takenAt.Time)
+	if err != nil {
+		return snapshot, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			base, target string
+			rate         float64
+		)
+
+		if err := rows.Scan(&base, &target, &rate); err != nil {
+			return snapshot, err
+		}
+
+		snapshot.Rates.Put(base, target, rate)
+	}
+
+	return snapshot, rows.Err()
+}
@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+type LedgerStore struct {
+	dbConn *sql.DB
+}
+
+func NewLedgerStore(dbConn *sql.DB) storage.LedgerStorage {
+	return &LedgerStore{
+		dbConn: dbConn,
+	}
+}
+
+// SaveConversions implements storage.LedgerStorage.
+func (l *LedgerStore) SaveConversions(ctx context.Context, records []model.ConversionRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	const columns = 9
+
+	var (
+		placeholders = make([]string, 0, len(records))
+		args         = make([]interface{}, 0, len(records)*columns)
+	)
+
+	for i, r := range records {
+		params := make([]string, columns)
+		for j := range params {
+			params[j] = fmt.Sprintf("$%d", i*columns+j+1)
+		}
+
+		placeholders = append(placeholders, "("+strings.Join(params, ", ")+")")
+		args = append(args, r.RequestID, r.Client, r.From, r.To, r.Amount, r.Rate, r.Result, r.RateTime, r.CreatedAt)
+	}
+
+	saveQuery := `INSERT INTO conversions(request_id, client, from_symbol, to_symbol, amount, rate, result, rate_time, created_at)
+				 VALUES ` + strings.Join(placeholders, ", ")
+
+	_, err := l.dbConn.ExecContext(ctx, saveQuery, args...)
+	return err
+}
+
+// FindConversions implements storage.LedgerStorage.
+func (l *LedgerStore) FindConversions(ctx context.Context, filter model.ConversionFilter) ([]model.ConversionRecord, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	if filter.Client != "" {
+		args = append(args, filter.Client)
+		conditions = append(conditions, fmt.Sprintf("client = $%d", len(args)))
+	}
+
+	findQuery := `SELECT request_id, client, from_symbol, to_symbol, amount, rate, result, rate_time, created_at
+				 FROM conversions`
+
+	if len(conditions) > 0 {
+		findQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	findQuery += " ORDER BY created_at"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		findQuery += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	var records []model.ConversionRecord
+
+	rows, err := query(ctx, l.dbConn, findQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := model.ConversionRecord{}
+
+		err := rows.Scan(
+			&r.RequestID,
+			&r.Client,
+			&r.From,
+			&r.To,
+			&r.Amount,
+			&r.Rate,
+			&r.Result,
+			&r.RateTime,
+			&r.CreatedAt,
+		)
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
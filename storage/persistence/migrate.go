@@ -0,0 +1,28 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+)
+
+// schema creates every table used by the persistence
+// providers and adds columns missing in older installations
+//
+//go:embed schema.sql
+var schema string
+
+// Migrate applies the schema within single transaction
+func Migrate(ctx context.Context, dbConn *sql.DB) error {
+	tx, err := dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -3,13 +3,30 @@ package persistence
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/kylycht/exchange/model"
 	"github.com/kylycht/exchange/storage"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
 )
 
+// currencyColumns are selected for every currency query
+const currencyColumns = `name, symbol, currency_type, is_available, numeric_code, decimals,
+				 display_symbol, aliases, chains, active_from, active_until`
+
+// errUnknownType is returned for currency of the type this version
+// does not support, such rows are skipped instead of failing the query
+var errUnknownType = errors.New("unknown currency type")
+
 type Persistence struct {
-	dbConn *sql.DB
+	dbConn   *sql.DB
+	lock     sync.Mutex // guards rejected
+	rejected []string   // symbols of unknown type skipped by the latest query
 }
 
 func New(dbConn *sql.DB) storage.Storage {
@@ -19,34 +36,213 @@ func New(dbConn *sql.DB) storage.Storage {
 }
 
 // Load implements storage.Storage.
-func (p *Persistence) Load(ctx context.Context) ([]model.Currency, []model.Currency, error) {
-	loadQuery := `SELECT name, symbol, currency_type 
+// Currencies outside of their active range
+// or of unknown type are skipped
+func (p *Persistence) Load(ctx context.Context) ([]model.Currency, error) {
+	loadQuery := `SELECT ` + currencyColumns + `
 				 FROM currency 
 				 WHERE is_available=true`
 
-	var fiats []model.Currency
-	var cryptos []model.Currency
+	var (
+		currencies []model.Currency
+		rejected   []string
+	)
+	defer func() { p.reject(rejected) }()
 
-	rows, err := p.dbConn.Query(loadQuery)
+	rows, err := query(ctx, p.dbConn, loadQuery)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 
+	now := time.Now()
+
 	for rows.Next() {
-		c := model.Currency{}
+		c, err := scanCurrency(rows)
+		if errors.Is(err, errUnknownType) {
+			log.Ctx(ctx).Warn().Err(err).Msg("skipping currency")
+			rejected = append(rejected, c.Symbol)
+			continue
+		}
 
-		if err := rows.Scan(&c.Name, &c.Symbol, &c.CurrencyType); err != nil {
-			return fiats, cryptos, err
+		if err != nil {
+			return currencies, err
 		}
 
-		if c.CurrencyType == model.Fiat {
-			fiats = append(fiats, c)
+		if !c.ActiveAt(now) {
 			continue
 		}
 
-		cryptos = append(cryptos, c)
+		currencies = append(currencies, c)
+	}
+
+	return currencies, rows.Err()
+}
+
+// List implements storage.Storage.
+// Currencies of unknown type are skipped
+func (p *Persistence) List(ctx context.Context) ([]model.Currency, error) {
+	listQuery := `SELECT ` + currencyColumns + `
+				 FROM currency
+				 ORDER BY symbol`
+
+	var (
+		currencies []model.Currency
+		rejected   []string
+	)
+	defer func() { p.reject(rejected) }()
+
+	rows, err := query(ctx, p.dbConn, listQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCurrency(rows)
+		if errors.Is(err, errUnknownType) {
+			log.Ctx(ctx).Warn().Err(err).Msg("skipping currency")
+			rejected = append(rejected, c.Symbol)
+			continue
+		}
+
+		if err != nil {
+			return currencies, err
+		}
+
+		currencies = append(currencies, c)
+	}
+
+	return currencies, rows.Err()
+}
+
+// Rejected implements storage.Rejecter.
+func (p *Persistence) Rejected() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return append([]string(nil), p.rejected...)
+}
+
+// reject records symbols skipped by the latest query
+func (p *Persistence) reject(symbols []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.rejected = symbols
+}
+
+// AddCurrency implements storage.Storage.
+func (p *Persistence) AddCurrency(ctx context.Context, c model.Currency) error {
+	addQuery := `INSERT INTO currency(name, symbol, currency_type, is_available, numeric_code, decimals,
+				 display_symbol, aliases, chains, active_from, active_until)
+				 SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+				 WHERE NOT EXISTS (SELECT 1 FROM currency WHERE symbol=$2)`
+
+	res, err := p.dbConn.ExecContext(ctx, addQuery,
+		c.Name,
+		strings.ToUpper(c.Symbol),
+		string(c.CurrencyType),
+		c.IsAvailable,
+		sql.NullInt64{Int64: int64(c.NumericCode), Valid: c.NumericCode != 0},
+		c.Decimals,
+		sql.NullString{String: c.DisplaySymbol, Valid: c.DisplaySymbol != ""},
+		pq.Array(nonNil(c.Aliases)),
+		pq.Array(nonNil(c.Chains)),
+		sql.NullTime{Time: c.ActiveFrom, Valid: !c.ActiveFrom.IsZero()},
+		sql.NullTime{Time: c.ActiveUntil, Valid: !c.ActiveUntil.IsZero()},
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return storage.ErrAlreadyExists
+	}
+
+	return nil
+}
+
+// DisableCurrency implements storage.Storage.
+func (p *Persistence) DisableCurrency(ctx context.Context, symbol string) error {
+	disableQuery := `UPDATE currency
+				 SET is_available=false
+				 WHERE symbol=$1`
+
+	res, err := p.dbConn.ExecContext(ctx, disableQuery, strings.ToUpper(symbol))
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+// nonNil replaces nil slice with the empty one
+// as array columns are not nullable
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+// scanCurrency reads currency from the row of currencyColumns,
+// optional columns fall back to defaults of the currency type
+func scanCurrency(rows *sql.Rows) (model.Currency, error) {
+	var (
+		c                       model.Currency
+		currencyType            string
+		numericCode, decimals   sql.NullInt64
+		displaySymbol           sql.NullString
+		activeFrom, activeUntil sql.NullTime
+	)
+
+	err := rows.Scan(
+		&c.Name,
+		&c.Symbol,
+		&currencyType,
+		&c.IsAvailable,
+		&numericCode,
+		&decimals,
+		&displaySymbol,
+		pq.Array(&c.Aliases),
+		pq.Array(&c.Chains),
+		&activeFrom,
+		&activeUntil,
+	)
+	if err != nil {
+		return c, err
+	}
+
+	c.CurrencyType, err = model.ParseCurrencyType(currencyType)
+	if err != nil {
+		return c, fmt.Errorf("currency %s: %w %q", c.Symbol, errUnknownType, currencyType)
+	}
+
+	c.NumericCode = int(numericCode.Int64)
+	c.DisplaySymbol = displaySymbol.String
+	c.ActiveFrom = activeFrom.Time
+	c.ActiveUntil = activeUntil.Time
+
+	c.Decimals = model.DefaultDecimals(c.CurrencyType)
+	if decimals.Valid {
+		c.Decimals = int(decimals.Int64)
 	}
 
-	return fiats, cryptos, nil
+	return c, nil
 }
@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+)
+
+// rowsConnector serves the same currency rows for every query
+type rowsConnector struct {
+	rows [][]driver.Value
+}
+
+func (c rowsConnector) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c rowsConnector) Driver() driver.Driver                        { return nil }
+func (c rowsConnector) Prepare(string) (driver.Stmt, error)          { return c, nil }
+func (c rowsConnector) Close() error                                 { return nil }
+func (c rowsConnector) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+func (c rowsConnector) NumInput() int                                { return -1 }
+
+func (c rowsConnector) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c rowsConnector) Query([]driver.Value) (driver.Rows, error) {
+	return &currencyRows{rows: c.rows}, nil
+}
+
+type currencyRows struct {
+	rows [][]driver.Value
+}
+
+func (r *currencyRows) Columns() []string {
+	return []string{"name", "symbol", "currency_type", "is_available", "numeric_code", "decimals",
+		"display_symbol", "aliases", "chains", "active_from", "active_until"}
+}
+
+func (r *currencyRows) Close() error { return nil }
+
+func (r *currencyRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+func TestLoadSkipsUnknownType(t *testing.T) {
+	db := sql.OpenDB(rowsConnector{rows: [][]driver.Value{
+		{"BITCOIN", "BTC", "CRYPTO", true, nil, nil, nil, "{XBT}", "{}", nil, nil},
+		{"SHARE", "AAPL", "EQUITY", true, nil, nil, nil, "{}", "{}", nil, nil},
+		{"DOLLAR", "USD", "FIAT", true, int64(840), int64(2), "$", "{}", "{}", nil, nil},
+	}})
+	defer db.Close()
+
+	p := New(db).(*Persistence)
+
+	for name, load := range map[string]func(context.Context) error{
+		"load": func(ctx context.Context) error { _, err := p.Load(ctx); return err },
+		"list": func(ctx context.Context) error { _, err := p.List(ctx); return err },
+	} {
+		if err := load(context.Background()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if rejected := p.Rejected(); len(rejected) != 1 || rejected[0] != "AAPL" {
+			t.Errorf("%s: expected AAPL to be rejected, got %v", name, rejected)
+		}
+	}
+
+	currencies, err := p.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(currencies) != 2 || currencies[0].Symbol != "BTC" || currencies[1].Symbol != "USD" || currencies[1].NumericCode != 840 {
+		t.Errorf("expected currency of unknown type to be excluded, got %+v", currencies)
+	}
+}
@@ -0,0 +1,74 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+type PricingStore struct {
+	dbConn *sql.DB
+}
+
+func NewPricingStore(dbConn *sql.DB) storage.PricingStorage {
+	return &PricingStore{
+		dbConn: dbConn,
+	}
+}
+
+// LoadPricingRules implements storage.PricingStorage.
+func (p *PricingStore) LoadPricingRules(ctx context.Context) ([]model.PricingRule, error) {
+	loadQuery := `SELECT COALESCE(from_symbol, ''), COALESCE(to_symbol, ''),
+					COALESCE(from_type, ''), COALESCE(to_type, ''),
+					spread, fixed_fee, percent_fee, min_fee
+				 FROM pricing_rule`
+
+	var rules []model.PricingRule
+
+	rows, err := query(ctx, p.dbConn, loadQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			r                model.PricingRule
+			fromType, toType string
+		)
+
+		err := rows.Scan(
+			&r.From,
+			&r.To,
+			&fromType,
+			&toType,
+			&r.Spread,
+			&r.FixedFee,
+			&r.PercentFee,
+			&r.MinFee,
+		)
+		if err != nil {
+			return rules, err
+		}
+
+		// empty types match any currency
+		if fromType != "" {
+			if r.FromType, err = model.ParseCurrencyType(fromType); err != nil {
+				return rules, fmt.Errorf("pricing rule %s/%s: %w", r.From, r.To, err)
+			}
+		}
+
+		if toType != "" {
+			if r.ToType, err = model.ParseCurrencyType(toType); err != nil {
+				return rules, fmt.Errorf("pricing rule %s/%s: %w", r.From, r.To, err)
+			}
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, rows.Err()
+}
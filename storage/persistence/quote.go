@@ -0,0 +1,106 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+	"github.com/lib/pq"
+)
+
+type QuoteStore struct {
+	dbConn *sql.DB
+}
+
+func NewQuoteStore(dbConn *sql.DB) storage.QuoteStorage {
+	return &QuoteStore{
+		dbConn: dbConn,
+	}
+}
+
+// CreateQuote implements storage.QuoteStorage.
+func (q *QuoteStore) CreateQuote(ctx context.Context, quote model.Quote) error {
+	createQuery := `INSERT INTO quote(id, from_symbol, to_symbol, amount, mid_rate, rate, gross, fee, result, status, created_at, expires_at)
+				   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	_, err := q.dbConn.ExecContext(ctx, createQuery,
+		quote.ID,
+		quote.From,
+		quote.To,
+		quote.Amount,
+		quote.MidRate,
+		quote.Rate,
+		quote.Gross,
+		quote.Fee,
+		quote.Net,
+		quote.Status,
+		quote.CreatedAt,
+		quote.ExpiresAt,
+	)
+
+	return err
+}
+
+// GetQuote implements storage.QuoteStorage.
+func (q *QuoteStore) GetQuote(ctx context.Context, id string) (model.Quote, error) {
+	getQuery := `SELECT id, from_symbol, to_symbol, amount, mid_rate, rate, gross, fee, result, status, created_at, expires_at
+				FROM quote
+				WHERE id=$1`
+
+	quote := model.Quote{}
+
+	err := retry(ctx, func(ctx context.Context) error {
+		return q.dbConn.QueryRowContext(ctx, getQuery, id).Scan(
+			&quote.ID,
+			&quote.From,
+			&quote.To,
+			&quote.Amount,
+			&quote.MidRate,
+			&quote.Rate,
+			&quote.Gross,
+			&quote.Fee,
+			&quote.Net,
+			&quote.Status,
+			&quote.CreatedAt,
+			&quote.ExpiresAt,
+		)
+	})
+	if errors.Is(err, sql.ErrNoRows) || invalidID(err) {
+		return quote, storage.ErrNotFound
+	}
+
+	return quote, err
+}
+
+// invalidID reports whether the id was rejected by the uuid column
+func invalidID(err error) bool {
+	var pqErr *pq.Error
+
+	// invalid_text_representation
+	return errors.As(err, &pqErr) && pqErr.Code == "22P02"
+}
+
+// SettleQuote implements storage.QuoteStorage.
+func (q *QuoteStore) SettleQuote(ctx context.Context, quote model.Quote) error {
+	settleQuery := `UPDATE quote
+				   SET status=$2
+				   WHERE id=$1 AND status=$3`
+
+	res, err := q.dbConn.ExecContext(ctx, settleQuery, quote.ID, quote.Status, model.QuotePending)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return storage.ErrQuoteNotPending
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/lib/pq"
+)
+
+// retries of the idempotent queries failed by transient errors
+var transientRetrier = retrier.New(retrier.ExponentialBackoff(3, time.Millisecond*100), transient{})
+
+// transient classifies errors of the broken connection
+// and of the server temporarily unable to serve as retriable
+type transient struct{}
+
+func (transient) Classify(err error) retrier.Action {
+	if err == nil {
+		return retrier.Succeed
+	}
+
+	if IsTransient(err) {
+		return retrier.Retry
+	}
+
+	return retrier.Fail
+}
+
+// IsTransient reports whether the query may succeed once retried
+func IsTransient(err error) bool {
+	// context errors are timeouts as well, but final ones
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"53300", // too_many_connections
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+
+		// connection_exception
+		return pqErr.Code.Class() == "08"
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+// retry runs the idempotent query again while it fails by transient error
+func retry(ctx context.Context, query func(ctx context.Context) error) error {
+	return transientRetrier.RunCtx(ctx, query)
+}
+
+// query runs the query retrying transient errors
+func query(ctx context.Context, dbConn *sql.DB, q string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+
+	err := retry(ctx, func(ctx context.Context) error {
+		var err error
+		rows, err = dbConn.QueryContext(ctx, q, args...)
+		return err
+	})
+
+	return rows, err
+}
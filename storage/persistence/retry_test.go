@@ -0,0 +1,62 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{err: driver.ErrBadConn, transient: true},
+		{err: fmt.Errorf("load: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), transient: true},
+		{err: &pq.Error{Code: "08006"}, transient: true},
+		{err: &pq.Error{Code: "40001"}, transient: true},
+		{err: &pq.Error{Code: "57P03"}, transient: true},
+		{err: &pq.Error{Code: "23505"}, transient: false},
+		{err: &pq.Error{Code: "57014"}, transient: false},
+		{err: sql.ErrNoRows, transient: false},
+		{err: context.DeadlineExceeded, transient: false},
+		{err: context.Canceled, transient: false},
+	}
+
+	for _, tt := range tests {
+		if transient := IsTransient(tt.err); transient != tt.transient {
+			t.Errorf("%v: expected transient %v, got %v", tt.err, tt.transient, transient)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+
+	err := retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success on the 3rd call, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+
+	err = retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return sql.ErrNoRows
+	})
+	if !errors.Is(err, sql.ErrNoRows) || calls != 1 {
+		t.Fatalf("expected single call failed by %v, got %v after %d calls", sql.ErrNoRows, err, calls)
+	}
+}
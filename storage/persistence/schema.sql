@@ -0,0 +1,121 @@
+-- Schema is applied by `exchange migrate`, every statement
+-- is idempotent so that it is safe to apply on every release
+
+CREATE TABLE IF NOT EXISTS currency (
+    name          VARCHAR(64) NOT NULL,
+    symbol        VARCHAR(16) NOT NULL,
+    currency_type VARCHAR(16) NOT NULL,
+    is_available  BOOLEAN NOT NULL DEFAULT true
+);
+
+ALTER TABLE currency
+    ADD COLUMN IF NOT EXISTS numeric_code   INTEGER,
+    ADD COLUMN IF NOT EXISTS decimals       SMALLINT,
+    ADD COLUMN IF NOT EXISTS display_symbol VARCHAR(8),
+    ADD COLUMN IF NOT EXISTS aliases        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS chains         TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS active_from    TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS active_until   TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS currency_symbol_idx ON currency(symbol);
+
+CREATE TABLE IF NOT EXISTS quote (
+    id          UUID PRIMARY KEY,
+    from_symbol VARCHAR(16) NOT NULL,
+    to_symbol   VARCHAR(16) NOT NULL,
+    amount      DOUBLE PRECISION NOT NULL,
+    rate        DOUBLE PRECISION NOT NULL,
+    result      DOUBLE PRECISION NOT NULL,
+    status      VARCHAR(16) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+-- result holds net amount of the priced quote
+ALTER TABLE quote
+    ADD COLUMN IF NOT EXISTS mid_rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS gross    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS fee      DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS pricing_rule (
+    from_symbol VARCHAR(16),
+    to_symbol   VARCHAR(16),
+    from_type   VARCHAR(16),
+    to_type     VARCHAR(16),
+    spread      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    fixed_fee   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    percent_fee DOUBLE PRECISION NOT NULL DEFAULT 0,
+    min_fee     DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS conversions (
+    request_id  VARCHAR(64) NOT NULL,
+    client      VARCHAR(128) NOT NULL,
+    from_symbol VARCHAR(16) NOT NULL,
+    to_symbol   VARCHAR(16) NOT NULL,
+    amount      DOUBLE PRECISION NOT NULL,
+    rate        DOUBLE PRECISION NOT NULL,
+    result      DOUBLE PRECISION NOT NULL,
+    rate_time   TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS conversions_created_at_idx ON conversions(created_at);
+CREATE INDEX IF NOT EXISTS conversions_client_idx ON conversions(client, created_at);
+
+CREATE TABLE IF NOT EXISTS rate_history (
+    taken_at      TIMESTAMPTZ NOT NULL,
+    base_symbol   VARCHAR(16) NOT NULL,
+    target_symbol VARCHAR(16) NOT NULL,
+    rate          DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_history_taken_at_idx ON rate_history(taken_at);
+
+-- every replica archives the same snapshots, rows
+-- archived twice before the index existed are dropped
+DO $$
+BEGIN
+    IF to_regclass('rate_history_pair_idx') IS NULL THEN
+        DELETE FROM rate_history a USING rate_history b
+         WHERE a.ctid > b.ctid
+           AND a.taken_at = b.taken_at
+           AND a.base_symbol = b.base_symbol
+           AND a.target_symbol = b.target_symbol;
+
+        CREATE UNIQUE INDEX rate_history_pair_idx ON rate_history(taken_at, base_symbol, target_symbol);
+    END IF;
+END;
+$$;
+
+CREATE TABLE IF NOT EXISTS cache_snapshot (
+    id       BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    taken_at TIMESTAMPTZ NOT NULL,
+    payload  JSONB NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION notify_cache_snapshot() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('cache_snapshot', NEW.taken_at::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS cache_snapshot_notify ON cache_snapshot;
+CREATE TRIGGER cache_snapshot_notify AFTER INSERT OR UPDATE ON cache_snapshot
+    FOR EACH ROW EXECUTE FUNCTION notify_cache_snapshot();
+
+CREATE OR REPLACE FUNCTION notify_currency_changed() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('currency_changed', OLD.symbol);
+    ELSE
+        PERFORM pg_notify('currency_changed', NEW.symbol);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS currency_changed_notify ON currency;
+CREATE TRIGGER currency_changed_notify AFTER INSERT OR UPDATE OR DELETE ON currency
+    FOR EACH ROW EXECUTE FUNCTION notify_currency_changed();
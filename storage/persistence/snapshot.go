@@ -0,0 +1,63 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+type SnapshotStore struct {
+	dbConn *sql.DB
+}
+
+func NewSnapshotStore(dbConn *sql.DB) storage.SnapshotStorage {
+	return &SnapshotStore{
+		dbConn: dbConn,
+	}
+}
+
+// SaveCacheSnapshot implements storage.SnapshotStorage.
+// Table holds single row replaced on every save
+func (s *SnapshotStore) SaveCacheSnapshot(ctx context.Context, snapshot model.CacheSnapshot) error {
+	saveQuery := `INSERT INTO cache_snapshot(id, taken_at, payload)
+				 VALUES (true, $1, $2)
+				 ON CONFLICT (id) DO UPDATE SET taken_at=EXCLUDED.taken_at, payload=EXCLUDED.payload`
+
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return retry(ctx, func(ctx context.Context) error {
+		_, err := s.dbConn.ExecContext(ctx, saveQuery, snapshot.Timestamp, payload)
+		return err
+	})
+}
+
+// LoadCacheSnapshot implements storage.SnapshotStorage.
+func (s *SnapshotStore) LoadCacheSnapshot(ctx context.Context) (model.CacheSnapshot, error) {
+	loadQuery := `SELECT payload
+				 FROM cache_snapshot
+				 WHERE id=true`
+
+	snapshot := model.CacheSnapshot{}
+
+	var payload []byte
+
+	err := retry(ctx, func(ctx context.Context) error {
+		return s.dbConn.QueryRowContext(ctx, loadQuery).Scan(&payload)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return snapshot, storage.ErrNotFound
+	}
+
+	if err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, json.Unmarshal(payload, &snapshot)
+}
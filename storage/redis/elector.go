@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/kylycht/exchange/storage"
+)
+
+var (
+	// renew prolongs the lease if it is held by the instance
+	renew = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// release deletes the lease if it is held by the instance
+	release = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Elector elects the leader by the lease key expiring after ttl,
+// the key holds id of the leader and is renewed by it only
+type Elector struct {
+	client goredis.UniversalClient // redis connection
+	key    string                  // key of the lease
+	id     string                  // id of the instance
+	ttl    time.Duration           // lease expires unless renewed within
+}
+
+func NewElector(client goredis.UniversalClient, key string, id string, ttl time.Duration) storage.Elector {
+	return &Elector{
+		client: client,
+		key:    key,
+		id:     id,
+		ttl:    ttl,
+	}
+}
+
+// Campaign implements storage.Elector.
+func (e *Elector) Campaign(ctx context.Context) (bool, error) {
+	acquired, err := e.client.SetNX(ctx, e.key, e.id, e.ttl).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if acquired {
+		return true, nil
+	}
+
+	renewed, err := renew.Run(ctx, e.client, []string{e.key}, e.id, e.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return renewed == 1, nil
+}
+
+// Resign implements storage.Elector.
+func (e *Elector) Resign(ctx context.Context) error {
+	return release.Run(ctx, e.client, []string{e.key}, e.id).Err()
+}
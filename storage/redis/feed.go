@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+// Feed keeps the latest cache snapshot under the key
+// and announces every saved one on the channel
+type Feed struct {
+	client  goredis.UniversalClient // redis connection
+	key     string                  // key of the snapshot
+	channel string                  // channel of the announcements
+}
+
+func NewFeed(client goredis.UniversalClient, key string, channel string) storage.SnapshotFeed {
+	return &Feed{
+		client:  client,
+		key:     key,
+		channel: channel,
+	}
+}
+
+// SaveCacheSnapshot implements storage.SnapshotStorage.
+// Snapshot is stored and announced in a single transaction
+func (f *Feed) SaveCacheSnapshot(ctx context.Context, snapshot model.CacheSnapshot) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, f.key, payload, 0)
+		pipe.Publish(ctx, f.channel, snapshot.Timestamp.UnixNano())
+		return nil
+	})
+
+	return err
+}
+
+// LoadCacheSnapshot implements storage.SnapshotStorage.
+func (f *Feed) LoadCacheSnapshot(ctx context.Context) (model.CacheSnapshot, error) {
+	snapshot := model.CacheSnapshot{}
+
+	payload, err := f.client.Get(ctx, f.key).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return snapshot, storage.ErrNotFound
+	}
+
+	if err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, json.Unmarshal(payload, &snapshot)
+}
+
+// Watch implements storage.SnapshotFeed.
+// Announcements received while the previous one is not
+// consumed yet are coalesced, as only the latest is loaded
+func (f *Feed) Watch(ctx context.Context) (<-chan struct{}, error) {
+	pubsub := f.client.Subscribe(ctx, f.channel)
+
+	// wait for confirmation, so that snapshots
+	// saved after Watch returns are not missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	updatesC := make(chan struct{}, 1)
+	messagesC := pubsub.Channel()
+
+	go func() {
+		defer pubsub.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case _, ok := <-messagesC:
+				if !ok {
+					return
+				}
+
+				select {
+				case updatesC <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return updatesC, nil
+}
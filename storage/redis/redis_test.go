@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+func newClient(t *testing.T) (*miniredis.Miniredis, goredis.UniversalClient) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+func TestElector(t *testing.T) {
+	server, client := newClient(t)
+	ctx := context.Background()
+
+	first := NewElector(client, "leader", "first", time.Second*10)
+	second := NewElector(client, "leader", "second", time.Second*10)
+
+	campaign := func(e storage.Elector, expected bool) {
+		t.Helper()
+
+		isLeader, err := e.Campaign(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if isLeader != expected {
+			t.Fatalf("expected leadership %v, got %v", expected, isLeader)
+		}
+	}
+
+	campaign(first, true)
+	campaign(second, false)
+
+	// renewal prolongs the lease
+	server.FastForward(time.Second * 8)
+	campaign(first, true)
+	server.FastForward(time.Second * 8)
+	campaign(second, false)
+
+	// resignation of the follower keeps the lease
+	if err := second.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	campaign(first, true)
+
+	// expired lease is taken over
+	server.FastForward(time.Second * 11)
+	campaign(second, true)
+	campaign(first, false)
+
+	if err := second.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	campaign(first, true)
+}
+
+func TestFeed(t *testing.T) {
+	_, client := newClient(t)
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	feed := NewFeed(client, "snapshot", "snapshots")
+
+	if _, err := feed.LoadCacheSnapshot(ctx); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected %v, got %v", storage.ErrNotFound, err)
+	}
+
+	updatesC, err := feed.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := model.CacheSnapshot{
+		Rates: model.Rates{"BTC": {"USD": 60000}},
+		Currencies: []model.Currency{
+			{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true, Decimals: 8, Aliases: []string{"XBT"}},
+			{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true, Decimals: 2},
+		},
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := feed.SaveCacheSnapshot(ctx, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-updatesC:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected announcement of the saved snapshot")
+	}
+
+	loaded, err := feed.LoadCacheSnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded, snapshot) {
+		t.Errorf("expected %+v, got %+v", snapshot, loaded)
+	}
+}
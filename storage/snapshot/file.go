@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+// File keeps the latest cache snapshot as JSON file
+type File struct {
+	path string // path of the snapshot file
+}
+
+func NewFile(path string) storage.SnapshotStorage {
+	return &File{
+		path: path,
+	}
+}
+
+// SaveCacheSnapshot implements storage.SnapshotStorage.
+// Snapshot is written to the temporary file renamed over
+// the previous one, so that crash never leaves partial file
+func (f *File) SaveCacheSnapshot(ctx context.Context, snapshot model.CacheSnapshot) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// LoadCacheSnapshot implements storage.SnapshotStorage.
+func (f *File) LoadCacheSnapshot(ctx context.Context) (model.CacheSnapshot, error) {
+	snapshot := model.CacheSnapshot{}
+
+	content, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return snapshot, storage.ErrNotFound
+	}
+
+	if err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, json.Unmarshal(content, &snapshot)
+}
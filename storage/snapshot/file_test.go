@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kylycht/exchange/model"
+	"github.com/kylycht/exchange/storage"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFile(filepath.Join(dir, "snapshot.json"))
+
+	if _, err := f.LoadCacheSnapshot(context.Background()); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected %v, got %v", storage.ErrNotFound, err)
+	}
+
+	for _, rate := range []float64{60000, 61000} {
+		snapshot := model.CacheSnapshot{
+			Rates: model.Rates{"BTC": {"USD": rate}},
+			Currencies: []model.Currency{
+				{Symbol: "BTC", CurrencyType: model.Crypto, IsAvailable: true, Decimals: 8, Aliases: []string{"XBT"}},
+				{Symbol: "USD", CurrencyType: model.Fiat, IsAvailable: true, Decimals: 2},
+			},
+			Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+
+		if err := f.SaveCacheSnapshot(context.Background(), snapshot); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := f.LoadCacheSnapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(loaded, snapshot) {
+			t.Errorf("expected %+v, got %+v", snapshot, loaded)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, got %d entries", len(entries))
+	}
+}
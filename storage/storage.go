@@ -2,24 +2,173 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/kylycht/exchange/model"
 )
 
+var (
+	// ErrNotFound is returned when requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrQuoteNotPending is returned on attempt to change status of settled quote
+	ErrQuoteNotPending = errors.New("quote is not pending")
+	// ErrAlreadyExists is returned on attempt to create existing entity
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrUnknownSymbol is returned when currency of the pair is not served
+	ErrUnknownSymbol = errors.New("unknown symbol")
+	// ErrUnsupportedPair is returned when both currencies are served but not quoted against each other
+	ErrUnsupportedPair = errors.New("unsupported pair")
+	// ErrStale is returned when cached rates are older than they may be served
+	ErrStale = errors.New("rates are stale")
+	// ErrProviderDown is returned when no rates were obtained from upstream yet
+	ErrProviderDown = errors.New("exchange provider is down")
+)
+
+// Pair is a pair of currency symbols,
+// aliases or chain qualified symbols
+type Pair struct {
+	From string
+	To   string
+}
+
+// String returns pair as FROM/TO
+func (p Pair) String() string {
+	return p.From + "/" + p.To
+}
+
 // Storage interface describes methods of
 // persistence storage
 type Storage interface {
 	// Load loads all available currencies
-	// from the storage
-	// First slice contains all fiat currencies
-	// followed by crypto
-	Load(ctx context.Context) ([]model.Currency, []model.Currency, error)
+	// of every type from the storage
+	Load(ctx context.Context) ([]model.Currency, error)
+
+	// List returns every known currency
+	// regardless of its availability
+	List(ctx context.Context) ([]model.Currency, error)
+
+	// AddCurrency stores new currency, ErrAlreadyExists
+	// is returned if the symbol is already known
+	AddCurrency(ctx context.Context, currency model.Currency) error
+
+	// DisableCurrency makes currency unavailable for
+	// conversions or returns ErrNotFound if there is none
+	DisableCurrency(ctx context.Context, symbol string) error
+}
+
+// Rejecter interface describes storage skipping
+// currencies of the types it does not support
+type Rejecter interface {
+	// Rejected returns symbols of the currencies
+	// skipped by the latest Load or List
+	Rejected() []string
 }
 
 // Cache interface describes non-persistent cache
 // storage for the exchange rates
 type Cache interface {
-	// Get retrives latest exchange rate
-	// for given pair
-	Get(from, to string) (model.ExchangeRate, error)
+	// Get retrives latest exchange rate for given pair.
+	// ErrUnknownSymbol, ErrUnsupportedPair, ErrStale or
+	// ErrProviderDown is returned if the rate cannot be served,
+	// ctx error is returned if the lookup was cancelled
+	Get(ctx context.Context, pair Pair) (model.ExchangeRate, error)
+
+	// Subscribe returns channel which receives
+	// a signal after every cache refresh and
+	// a function to cancel the subscription
+	Subscribe() (<-chan struct{}, func())
+
+	// Snapshot returns all rates obtained by the
+	// latest refresh, maps must not be modified
+	Snapshot() model.RateSnapshot
+
+	// Currency resolves symbol, alias or chain qualified
+	// symbol (e.g. USDT-TRC20) into the served currency
+	Currency(symbol string) (model.Currency, bool)
+}
+
+// QuoteStorage interface describes persistence
+// storage for the conversion quotes
+type QuoteStorage interface {
+	// CreateQuote stores new quote
+	CreateQuote(ctx context.Context, quote model.Quote) error
+
+	// GetQuote returns quote by its ID
+	// or ErrNotFound if there is none
+	GetQuote(ctx context.Context, id string) (model.Quote, error)
+
+	// SettleQuote moves pending quote into the status of given quote,
+	// ErrQuoteNotPending is returned if quote was already settled
+	SettleQuote(ctx context.Context, quote model.Quote) error
+}
+
+// PricingStorage interface describes persistence
+// storage for the pricing rules
+type PricingStorage interface {
+	// LoadPricingRules loads all pricing rules
+	LoadPricingRules(ctx context.Context) ([]model.PricingRule, error)
+}
+
+// LedgerStorage interface describes persistence
+// storage for the served conversions
+type LedgerStorage interface {
+	// SaveConversions stores batch of served conversions
+	SaveConversions(ctx context.Context, records []model.ConversionRecord) error
+
+	// FindConversions returns served conversions matching
+	// the filter ordered by the time they were served
+	FindConversions(ctx context.Context, filter model.ConversionFilter) ([]model.ConversionRecord, error)
+}
+
+// HistoryStorage interface describes persistence
+// storage for the historical rates
+type HistoryStorage interface {
+	// SaveSnapshot stores all rates of the snapshot
+	SaveSnapshot(ctx context.Context, snapshot model.RateSnapshot) error
+
+	// SnapshotAt returns latest snapshot taken at or
+	// before given time or ErrNotFound if there is none
+	SnapshotAt(ctx context.Context, at time.Time) (model.RateSnapshot, error)
+}
+
+// SnapshotStorage interface describes persistence
+// storage for the latest state of the cache
+type SnapshotStorage interface {
+	// SaveCacheSnapshot replaces previously saved snapshot
+	SaveCacheSnapshot(ctx context.Context, snapshot model.CacheSnapshot) error
+
+	// LoadCacheSnapshot returns the latest saved
+	// snapshot or ErrNotFound if there is none
+	LoadCacheSnapshot(ctx context.Context) (model.CacheSnapshot, error)
+}
+
+// Elector interface describes election of the
+// single leader among replicas of the service
+type Elector interface {
+	// Campaign acquires or renews leadership and
+	// reports whether the instance is the leader
+	Campaign(ctx context.Context) (bool, error)
+
+	// Resign releases leadership if held
+	Resign(ctx context.Context) error
+}
+
+// SnapshotFeed interface describes distribution of
+// the cache state from the leader to the followers
+type SnapshotFeed interface {
+	SnapshotStorage
+
+	// Watch returns channel which receives a signal after every
+	// saved snapshot, watching stops once ctx is done
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// CurrencyFeed interface describes
+// changes of the currency catalog
+type CurrencyFeed interface {
+	// WatchCurrencies returns channel which receives a signal after
+	// currencies were added, removed or changed, watching stops once
+	// ctx is done
+	WatchCurrencies(ctx context.Context) (<-chan struct{}, error)
 }